@@ -3,11 +3,13 @@ package api
 import (
 	"time"
 
+	"go.sia.tech/renterd/auth"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/renterd/object"
 	rhpv2 "go.sia.tech/renterd/rhp/v2"
 	rhpv3 "go.sia.tech/renterd/rhp/v3"
 	"go.sia.tech/renterd/slab"
+	"go.sia.tech/renterd/wallet"
 	"go.sia.tech/siad/types"
 )
 
@@ -31,8 +33,9 @@ func (t *paramTime) UnmarshalText(b []byte) error { return (*time.Time)(t).Unmar
 
 // WalletFundRequest is the request type for the /wallet/fund endpoint.
 type WalletFundRequest struct {
-	Transaction types.Transaction `json:"transaction"`
-	Amount      types.Currency    `json:"amount"`
+	Transaction types.Transaction  `json:"transaction"`
+	Amount      types.Currency     `json:"amount"`
+	Priority    wallet.FeePriority `json:"priority,omitempty"`
 }
 
 // WalletFundResponse is the response type for the /wallet/fund endpoint.
@@ -49,6 +52,51 @@ type WalletSignRequest struct {
 	CoveredFields types.CoveredFields `json:"coveredFields"`
 }
 
+// WalletSendRequest is the request type for the /wallet/send endpoint.
+type WalletSendRequest struct {
+	Outputs []types.SiacoinOutput `json:"outputs"`
+	// Fee is the miner fee to pay. If it is zero, the fee is derived from the
+	// transaction pool's recommended fee, according to Priority and the
+	// wallet's fee policy.
+	Fee      types.Currency     `json:"fee"`
+	Priority wallet.FeePriority `json:"priority,omitempty"`
+}
+
+// WalletFeeEstimateRequest is the request type for the /wallet/fee/estimate
+// endpoint.
+type WalletFeeEstimateRequest struct {
+	TransactionSet []types.Transaction `json:"transactionSet"`
+	Priority       wallet.FeePriority  `json:"priority,omitempty"`
+}
+
+// WalletFeeEstimateResponse is the response type for the /wallet/fee/estimate
+// endpoint.
+type WalletFeeEstimateResponse struct {
+	// Size is the encoded size of the transaction set, in bytes.
+	Size       uint64         `json:"size"`
+	FeePerByte types.Currency `json:"feePerByte"`
+	// Fee is the total fee the set should pay, and Paid is the total fee it
+	// pays already.
+	Fee  types.Currency `json:"fee"`
+	Paid types.Currency `json:"paid"`
+}
+
+// WalletBumpRequest is the request type for the /wallet/bump endpoint.
+type WalletBumpRequest struct {
+	ID       types.TransactionID `json:"id"`
+	Priority wallet.FeePriority  `json:"priority,omitempty"`
+}
+
+// WalletDefragRequest is the request type for the /wallet/defrag endpoint.
+type WalletDefragRequest struct {
+	// Threshold is the number of spendable outputs above which the wallet is
+	// defragmented. If it is zero, wallet.DefaultDefragThreshold is used.
+	Threshold int `json:"threshold"`
+	// BatchSize is the maximum number of outputs merged by each transaction.
+	// If it is zero, wallet.DefaultDefragBatchSize is used.
+	BatchSize int `json:"batchSize"`
+}
+
 // WalletPrepareFormRequest is the request type for the /wallet/prepare/form
 // endpoint.
 type WalletPrepareFormRequest RHPPrepareFormRequest
@@ -218,8 +266,68 @@ type SlabsMigrateRequest struct {
 	CurrentHeight uint64      `json:"currentHeight"`
 }
 
+// SlabsGCRequest is the request type for the /slabs/gc endpoint.
+type SlabsGCRequest struct {
+	Contracts []Contract `json:"contracts"`
+}
+
+// A ContractGCResult reports the unreferenced sectors that were deleted from a
+// contract during garbage collection.
+type ContractGCResult struct {
+	ContractID     types.FileContractID `json:"contractID"`
+	HostKey        PublicKey            `json:"hostKey"`
+	Sectors        uint64               `json:"sectors"`
+	ReclaimedBytes uint64               `json:"reclaimedBytes"`
+	Error          string               `json:"error,omitempty"`
+}
+
+// SlabsGCResponse is the response type for the /slabs/gc endpoint.
+type SlabsGCResponse struct {
+	Contracts []ContractGCResult `json:"contracts"`
+	Remaining uint64             `json:"remaining"`
+}
+
+// AuthKeyCreateRequest is the request type for the POST /auth/keys endpoint.
+type AuthKeyCreateRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Bucket, if set, limits the objects that the object scopes allow the key
+	// to access to those in the bucket.
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix, if set, limits the objects that the objects:write scope allows
+	// the key to modify.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// AuthKeyCreateResponse is the response type for the POST /auth/keys endpoint.
+// The secret is not stored by the node, and cannot be retrieved later.
+type AuthKeyCreateResponse struct {
+	Key    auth.Key `json:"key"`
+	Secret string   `json:"secret"`
+}
+
+// WebhookRegisterRequest is the request type for the POST /webhooks endpoint.
+type WebhookRegisterRequest struct {
+	URL string `json:"url"`
+	// Events lists the event types to deliver; if it is empty, every event is
+	// delivered.
+	Events []string `json:"events,omitempty"`
+	// Secret keys the HMAC signature of each delivery. If it is empty, the node
+	// generates one.
+	Secret string `json:"secret,omitempty"`
+}
+
 // ObjectsResponse is the response type for the /objects endpoint.
 type ObjectsResponse struct {
-	Entries []string       `json:"entries,omitempty"`
-	Object  *object.Object `json:"object,omitempty"`
+	Entries    []object.Entry   `json:"entries,omitempty"`
+	NextMarker string           `json:"nextMarker,omitempty"`
+	Object     *object.Object   `json:"object,omitempty"`
+	Versions   []object.Version `json:"versions,omitempty"`
+}
+
+// ObjectsDeleteResponse is the response type for recursive deletions via the
+// /objects endpoint.
+type ObjectsDeleteResponse struct {
+	Keys []string `json:"keys"`
+	Size int64    `json:"size"`
 }
@@ -3,14 +3,19 @@ package api_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
-	"go.sia.tech/jape"
 	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/auth"
+	"go.sia.tech/renterd/events"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/renterd/internal/slabutil"
 	"go.sia.tech/renterd/internal/stores"
@@ -19,6 +24,8 @@ import (
 	rhpv3 "go.sia.tech/renterd/rhp/v3"
 	"go.sia.tech/renterd/slab"
 	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/renterd/webhooks"
+	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/types"
 	"lukechampine.com/frand"
 )
@@ -112,13 +119,18 @@ func (sm *mockSlabMover) MigrateSlabs(ctx context.Context, slabs []slab.Slab, cu
 }
 
 type node struct {
-	w   *wallet.SingleAddressWallet
+	w   *wallet.SeedWallet
+	ws  *stores.EphemeralWalletStore
 	hdb *stores.EphemeralHostDB
 	cs  *stores.EphemeralContractStore
 	os  *stores.EphemeralObjectStore
 	sm  *mockSlabMover
+	eb  *events.Bus
+	wm  *webhooks.Manager
+	km  *auth.Manager
 
-	walletKey consensus.PrivateKey
+	walletSeed wallet.Seed
+	addr       string // of the API, once served
 }
 
 func (n *node) addHost() consensus.PublicKey {
@@ -128,13 +140,17 @@ func (n *node) addHost() consensus.PublicKey {
 }
 
 func newTestNode() *node {
-	walletKey := consensus.GeneratePrivateKey()
-	w := wallet.NewSingleAddressWallet(walletKey, stores.NewEphemeralWalletStore(wallet.StandardAddress(walletKey.PublicKey())))
+	walletSeed := wallet.Seed(frand.Entropy256())
+	ws := stores.NewEphemeralSeedStore(walletSeed.Address, wallet.DefaultGapLimit)
+	w := wallet.NewSeedWallet(walletSeed, ws)
 	hdb := stores.NewEphemeralHostDB()
 	cs := stores.NewEphemeralContractStore()
 	os := stores.NewEphemeralObjectStore()
 	sm := &mockSlabMover{}
-	return &node{w, hdb, cs, os, sm, walletKey}
+	eb := events.NewBus(events.DefaultBacklog)
+	wm := webhooks.NewManager(stores.NewEphemeralWebhookStore(), eb, 1, 0)
+	km := auth.NewManager(stores.NewEphemeralAuthStore(), "password")
+	return &node{w, ws, hdb, cs, os, sm, eb, wm, km, walletSeed, ""}
 }
 
 func runServer(n *node) (*api.Client, func()) {
@@ -143,24 +159,16 @@ func runServer(n *node) (*api.Client, func()) {
 		panic(err)
 	}
 	go func() {
-		srv := api.NewServer(mockSyncer{}, mockChainManager{}, mockTxPool{}, n.w, n.hdb, mockRHP{}, n.cs, n.sm, n.os)
-		http.Serve(l, jape.AuthMiddleware(srv, "password"))
+		srv := api.NewServer(mockSyncer{}, mockChainManager{}, mockTxPool{}, n.w, n.hdb, mockRHP{}, n.cs, n.sm, n.os, nil, n.eb, n.wm, n.km)
+		http.Serve(l, srv)
 	}()
-	c := api.NewClient("http://"+l.Addr().String(), "password")
+	n.addr = "http://" + l.Addr().String()
+	c := api.NewClient(n.addr, "password")
 	return c, func() { l.Close() }
 }
 
-func TestObject(t *testing.T) {
-	n := newTestNode()
-	c, shutdown := runServer(n)
-	defer shutdown()
-
-	hosts := make([]consensus.PublicKey, 3)
-	for i := range hosts {
-		hosts[i] = n.addHost()
-	}
-
-	// form contracts
+func formContracts(t *testing.T, c *api.Client, hosts []consensus.PublicKey) []api.Contract {
+	t.Helper()
 	var contracts []api.Contract
 	for _, hostKey := range hosts {
 		const hostIP = ""
@@ -195,6 +203,177 @@ func TestObject(t *testing.T) {
 			RenterKey: renterKey,
 		})
 	}
+	return contracts
+}
+
+// fund adds an output worth sc to the node's wallet.
+func (n *node) fund(sc types.Currency) {
+	cc := modules.ConsensusChange{AppliedBlocks: []types.Block{{}}}
+	cc.SiacoinOutputDiffs = []modules.SiacoinOutputDiff{{
+		Direction: modules.DiffApply,
+		ID:        frand.Entropy256(),
+		SiacoinOutput: types.SiacoinOutput{
+			Value:      sc,
+			UnlockHash: n.w.Address(),
+		},
+	}}
+	n.ws.ProcessConsensusChange(cc)
+}
+
+func TestWalletOfflineSigning(t *testing.T) {
+	n := newTestNode()
+	n.ws = stores.NewEphemeralWalletStore(n.walletSeed.Address(0))
+	n.w = wallet.NewWatchOnlyWallet(n.walletSeed.PublicKey(0), n.ws)
+	c, shutdown := runServer(n)
+	defer shutdown()
+	n.fund(types.SiacoinPrecision.Mul64(10))
+
+	// a watch-only wallet can't sign
+	outputs := []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash(frand.Entropy256())}}
+	if _, err := c.WalletSend(outputs, types.ZeroCurrency, ""); err == nil {
+		t.Fatal("watch-only wallet should not be able to send")
+	}
+
+	// prepare a bundle, sign it offline, then broadcast it
+	b, err := c.WalletPrepareSend(outputs, types.SiacoinPrecision.Div64(1000), "")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(b.Transaction.TransactionSignatures) != 0 || len(b.ToSign) != 1 {
+		t.Fatal("bundle should contain an unsigned, funded transaction")
+	} else if change := b.Transaction.SiacoinOutputs[1]; change.UnlockHash != n.walletSeed.Address(0) {
+		t.Fatal("change should be sent to the watched address")
+	}
+	if err := b.Sign(n.walletSeed.PrivateKey(1)); err == nil {
+		t.Fatal("bundle should not be signable by the wrong key")
+	} else if err := b.Sign(n.walletSeed.PrivateKey(0)); err != nil {
+		t.Fatal(err)
+	}
+	var pk consensus.PublicKey
+	var sig consensus.Signature
+	copy(pk[:], b.Transaction.SiacoinInputs[0].UnlockConditions.PublicKeys[0].Key)
+	copy(sig[:], b.Transaction.TransactionSignatures[0].Signature)
+	if !pk.VerifyHash(b.State.InputSigHash(b.Transaction, 0), sig) {
+		t.Fatal("signature is invalid")
+	}
+	txn, err := c.WalletBroadcast(b)
+	if err != nil {
+		t.Fatal(err)
+	} else if txn.ID() != b.Transaction.ID() {
+		t.Fatal("wrong transaction broadcast")
+	}
+	if pts, err := c.WalletPending(); err != nil {
+		t.Fatal(err)
+	} else if len(pts) != 1 || pts[0].ID != txn.ID() {
+		t.Fatal("broadcast transaction should be pending:", pts)
+	}
+}
+
+func TestWalletSend(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+	n.fund(types.SiacoinPrecision.Mul64(10))
+
+	addr := types.UnlockHash(frand.Entropy256())
+	outputs := []types.SiacoinOutput{
+		{Value: types.SiacoinPrecision, UnlockHash: addr},
+		{Value: types.SiacoinPrecision.Mul64(2), UnlockHash: addr},
+	}
+	fee := types.SiacoinPrecision.Div64(1000)
+	txn, err := c.WalletSend(outputs, fee, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(txn.SiacoinInputs) != 1 || len(txn.TransactionSignatures) != 1 {
+		t.Fatal("transaction should spend the wallet's output")
+	} else if len(txn.MinerFees) != 1 || !txn.MinerFees[0].Equals(fee) {
+		t.Fatal("transaction should pay the requested fee")
+	} else if len(txn.SiacoinOutputs) != 3 {
+		t.Fatal("transaction should pay each recipient, plus change")
+	}
+	for i, sco := range outputs {
+		if got := txn.SiacoinOutputs[i]; got.UnlockHash != sco.UnlockHash || !got.Value.Equals(sco.Value) {
+			t.Fatal("wrong recipient output:", got)
+		}
+	}
+	if change := txn.SiacoinOutputs[2]; !n.w.OwnsAddress(change.UnlockHash) || !change.Value.Equals(types.SiacoinPrecision.Mul64(7).Sub(fee)) {
+		t.Fatal("wrong change output:", change)
+	}
+
+	// the transaction should be tracked until it confirms
+	if pts, err := c.WalletPending(); err != nil {
+		t.Fatal(err)
+	} else if len(pts) != 1 || pts[0].ID != txn.ID() || pts[0].Status != wallet.PendingStatusPending {
+		t.Fatal("sent transaction should be pending:", pts)
+	}
+
+	// the wallet's only output is now in use
+	if _, err := c.WalletSend(outputs[:1], types.ZeroCurrency, ""); err == nil {
+		t.Fatal("expected send to fail with insufficient balance")
+	}
+	if _, err := c.WalletSend(nil, types.ZeroCurrency, ""); err == nil {
+		t.Fatal("expected send without outputs to fail")
+	}
+}
+
+func TestWalletSendDefaultFee(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+	n.fund(types.SiacoinPrecision.Mul64(2))
+	n.fund(types.SiacoinPrecision.Mul64(2))
+	feePerByte := types.SiacoinPrecision.Div64(1e6)
+	n.w.SetFeePolicy(wallet.FeePolicy{MinFeePerByte: feePerByte})
+
+	// the fee should cover the signed transaction, including the inputs and
+	// change output added by funding
+	outputs := []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(3), UnlockHash: types.UnlockHash(frand.Entropy256())}}
+	txn, err := c.WalletSend(outputs, types.ZeroCurrency, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(txn.SiacoinInputs) != 2 || len(txn.SiacoinOutputs) != 2 {
+		t.Fatal("transaction should spend both of the wallet's outputs and send change")
+	} else if required := feePerByte.Mul64(uint64(txn.MarshalSiaSize())); len(txn.MinerFees) != 1 || txn.MinerFees[0].Cmp(required) < 0 {
+		t.Fatalf("transaction pays a fee of %v, expected at least %v", txn.MinerFees, required)
+	}
+	var out types.Currency
+	for _, sco := range txn.SiacoinOutputs {
+		out = out.Add(sco.Value)
+	}
+	if !types.SiacoinPrecision.Mul64(4).Equals(out.Add(txn.MinerFees[0])) {
+		t.Fatal("transaction inputs and outputs are unbalanced")
+	}
+}
+
+func TestStatelessUpload(t *testing.T) {
+	sm := &mockSlabMover{}
+	for i := 0; i < 3; i++ {
+		sm.hosts = append(sm.hosts, slabutil.NewMockHost())
+	}
+	srv := httptest.NewServer(api.NewStatelessServer(mockRHP{}, sm))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "")
+
+	// a stateless server has no object store in which to record the slabs
+	data := frand.Bytes(12345)
+	slabs, err := c.UploadSlabs(bytes.NewReader(data), 2, 3, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(slabs) == 0 {
+		t.Fatal("no slabs uploaded")
+	}
+}
+
+func TestObject(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+
+	hosts := make([]consensus.PublicKey, 3)
+	for i := range hosts {
+		hosts[i] = n.addHost()
+	}
+
+	contracts := formContracts(t, c, hosts)
 
 	// upload
 	data := frand.Bytes(12345)
@@ -216,12 +395,12 @@ func TestObject(t *testing.T) {
 	}
 
 	// store object
-	if err := c.AddObject("foo", o); err != nil {
+	if err := c.AddObject(object.DefaultBucket, "foo", o); err != nil {
 		t.Fatal(err)
 	}
 
 	// retrieve object
-	o, err = c.Object("foo")
+	o, err = c.Object(object.DefaultBucket, "foo")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -243,10 +422,327 @@ func TestObject(t *testing.T) {
 	}
 
 	// delete object
-	if err := c.DeleteObject("foo"); err != nil {
+	if err := c.DeleteObject(object.DefaultBucket, "foo"); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := c.Object("foo"); err == nil {
+	if _, err := c.Object(object.DefaultBucket, "foo"); err == nil {
 		t.Error("object should no longer be retrievable")
 	}
 }
+
+func TestEvents(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+
+	es, err := c.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddObject(object.DefaultBucket, "foo", object.Object{Key: object.GenerateEncryptionKey()}); err != nil {
+		t.Fatal(err)
+	}
+	e, err := es.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj events.Object
+	if err := json.Unmarshal(e.Data, &obj); err != nil {
+		t.Fatal(err)
+	} else if e.Type != events.TypeObjectCreated || obj.Bucket != object.DefaultBucket || obj.Key != "/foo" {
+		t.Fatalf("unexpected event: %+v", e)
+	} else if es.LastID != e.ID {
+		t.Fatal("stream should record the last event ID")
+	}
+	es.Close()
+
+	// events published while disconnected should be received on resumption
+	if err := c.DeleteObject(object.DefaultBucket, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	es, err = c.EventsSince(e.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := es.Next(); err != nil {
+		t.Fatal(err)
+	} else if e.Type != events.TypeObjectDeleted {
+		t.Fatalf("expected missed deletion, got %+v", e)
+	}
+	es.Close()
+
+	// resuming from an event the node did not publish, e.g. before it
+	// restarted, should begin with a reset marker
+	es, err = c.EventsSince(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer es.Close()
+	if e, err := es.Next(); err != nil {
+		t.Fatal(err)
+	} else if e.Type != events.TypeReset {
+		t.Fatalf("expected reset marker, got %+v", e)
+	} else if e, err := es.Next(); err != nil {
+		t.Fatal(err)
+	} else if e.Type != events.TypeObjectCreated {
+		t.Fatalf("expected retained events after reset, got %+v", e)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+
+	n.fund(types.SiacoinPrecision.Mul64(5))
+	hosts := []consensus.PublicKey{n.addHost(), n.addHost()}
+	contracts := formContracts(t, c, hosts)
+	if _, err := c.UploadSlabs(bytes.NewReader(frand.Bytes(100)), 1, 2, 0, contracts); err != nil {
+		t.Fatal(err)
+	}
+
+	var rev types.FileContractRevision
+	rev.NewValidProofOutputs = []types.SiacoinOutput{{Value: types.SiacoinPrecision.Mul64(3)}}
+	if err := n.cs.AddContract(rhpv2.Contract{Revision: rev}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Metrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"renterd_consensus_height 0",
+		"renterd_contracts 1",
+		"renterd_contract_funds_siacoins 3",
+		"renterd_wallet_balance_siacoins 5",
+		`renterd_api_request_duration_seconds_count{route="POST /slabs/upload"}`,
+		`renterd_slab_transfer_bytes_total{direction="upload"}`,
+		`renterd_slab_transfer_duration_seconds_count{direction="upload"}`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("metrics missing %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestAuthKeys(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+
+	if _, _, err := c.CreateAuthKey("bad", []string{"everything"}, "", ""); err == nil {
+		t.Fatal("expected unknown scope to be rejected")
+	}
+	key, secret, err := c.CreateAuthKey("uploader", []string{auth.ScopeObjectsRead, auth.ScopeObjectsWrite}, "", "uploads/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := c.AuthKeys(); err != nil {
+		t.Fatal(err)
+	} else if len(keys) != 1 || keys[0].ID != key.ID || keys[0].Hash != "" {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	uc := api.NewClient(n.addr, secret)
+	o := object.Object{Key: object.GenerateEncryptionKey()}
+	if err := uc.AddObject(object.DefaultBucket, "uploads/foo", o); err != nil {
+		t.Fatal(err)
+	} else if _, err := uc.Object(object.DefaultBucket, "uploads/foo"); err != nil {
+		t.Fatal(err)
+	} else if err := uc.AddObject(object.DefaultBucket, "private/foo", o); err == nil {
+		t.Fatal("key should not be able to write outside its prefix")
+	} else if err := c.SetBucket("photos", object.BucketSettings{}); err != nil {
+		t.Fatal(err)
+	} else if err := uc.AddObject("photos", "uploads/foo", o); err == nil {
+		t.Fatal("key should not be able to write outside its bucket")
+	} else if _, err := uc.WalletBalance(); err == nil {
+		t.Fatal("key should not be able to access the wallet")
+	} else if _, err := uc.AuthKeys(); err == nil {
+		t.Fatal("key should not be able to manage keys")
+	} else if _, err := uc.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a key confined to a bucket should not be able to read other buckets
+	_, secret, err = c.CreateAuthKey("reader", []string{auth.ScopeObjectsRead}, "photos", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := api.NewClient(n.addr, secret)
+	if _, err := rc.Bucket("photos"); err != nil {
+		t.Fatal(err)
+	} else if _, err := rc.Object(object.DefaultBucket, "uploads/foo"); err == nil {
+		t.Fatal("key should not be able to read outside its bucket")
+	}
+
+	if err := c.DeleteAuthKey(key.ID); err != nil {
+		t.Fatal(err)
+	} else if _, err := uc.Object(object.DefaultBucket, "uploads/foo"); err == nil {
+		t.Fatal("deleted key should be rejected")
+	} else if _, err := api.NewClient(n.addr, "wrong").WalletBalance(); err == nil {
+		t.Fatal("invalid password should be rejected")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+
+	var got []events.Event
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var e events.Event
+		json.NewDecoder(req.Body).Decode(&e)
+		got = append(got, e)
+	}))
+	defer srv.Close()
+
+	if _, err := c.RegisterWebhook("not a url", nil, ""); err == nil {
+		t.Fatal("expected invalid URL to be rejected")
+	}
+	wh, err := c.RegisterWebhook(srv.URL, []string{events.TypeObjectDeleted}, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if wh.Secret == "" {
+		t.Fatal("node should generate a secret")
+	}
+	if err := c.TestWebhook(wh.ID); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(got) != 1 || got[0].Type != webhooks.TypeTest {
+		t.Fatal("expected test delivery:", got)
+	}
+	mu.Unlock()
+	if whs, err := c.Webhooks(); err != nil {
+		t.Fatal(err)
+	} else if len(whs) != 1 || whs[0].ID != wh.ID {
+		t.Fatal("webhook should be listed:", whs)
+	}
+	if err := c.DeleteWebhook(wh.ID); err != nil {
+		t.Fatal(err)
+	} else if whs, err := c.Webhooks(); err != nil {
+		t.Fatal(err)
+	} else if len(whs) != 0 {
+		t.Fatal("webhook should be deleted")
+	}
+	if dls, err := c.DeadLetters(); err != nil {
+		t.Fatal(err)
+	} else if len(dls) != 0 {
+		t.Fatal("expected no dead letters")
+	}
+}
+
+func TestSlabsGC(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+
+	hosts := make([]consensus.PublicKey, 3)
+	for i := range hosts {
+		hosts[i] = n.addHost()
+	}
+	contracts := formContracts(t, c, hosts)
+
+	// upload an object and store it under two names
+	data := frand.Bytes(12345)
+	key := object.GenerateEncryptionKey()
+	slabs, err := c.UploadSlabs(key.Encrypt(bytes.NewReader(data)), 2, 3, 0, contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := object.Object{
+		Key:   key,
+		Slabs: []slab.Slice{{Slab: slabs[0], Offset: 0, Length: uint32(len(data))}},
+	}
+	if err := c.AddObject(object.DefaultBucket, "foo", o); err != nil {
+		t.Fatal(err)
+	} else if err := c.AddObject(object.DefaultBucket, "bar", o); err != nil {
+		t.Fatal(err)
+	}
+
+	// deleting one object should not free any sectors
+	if err := c.DeleteObject(object.DefaultBucket, "foo"); err != nil {
+		t.Fatal(err)
+	} else if sectors, err := c.GarbageSectors(); err != nil {
+		t.Fatal(err)
+	} else if len(sectors) != 0 {
+		t.Fatalf("expected no garbage sectors, got %v", len(sectors))
+	}
+
+	// deleting the other should
+	if err := c.DeleteObject(object.DefaultBucket, "bar"); err != nil {
+		t.Fatal(err)
+	} else if sectors, err := c.GarbageSectors(); err != nil {
+		t.Fatal(err)
+	} else if len(sectors) != len(hosts) {
+		t.Fatalf("expected %v garbage sectors, got %v", len(hosts), len(sectors))
+	}
+
+	// collect garbage on all but one host; the remaining sector should stay
+	// queued
+	resp, err := c.CollectGarbage(contracts[1:])
+	if err != nil {
+		t.Fatal(err)
+	} else if len(resp.Contracts) != len(hosts)-1 || resp.Remaining != 1 {
+		t.Fatalf("unexpected GC response: %+v", resp)
+	}
+	for _, res := range resp.Contracts {
+		if res.Error != "" {
+			t.Fatal(res.Error)
+		} else if res.Sectors != 1 || res.ReclaimedBytes != rhpv2.SectorSize {
+			t.Fatalf("unexpected GC result: %+v", res)
+		}
+	}
+	if sectors, err := c.GarbageSectors(); err != nil {
+		t.Fatal(err)
+	} else if len(sectors) != 1 || sectors[0].Host != hosts[0] {
+		t.Fatalf("expected one garbage sector on first host, got %v", sectors)
+	}
+
+	// retry with the remaining contract
+	if resp, err := c.CollectGarbage(contracts); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Contracts) != 1 || resp.Remaining != 0 {
+		t.Fatalf("unexpected GC response: %+v", resp)
+	}
+	if err := c.DownloadSlabs(ioutil.Discard, o.Slabs, 0, o.Size(), contracts); err == nil {
+		t.Error("slabs should no longer be retrievable")
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	n := newTestNode()
+	c, shutdown := runServer(n)
+	defer shutdown()
+
+	for _, name := range []string{"dir/a", "dir/b"} {
+		if err := c.AddObject(object.DefaultBucket, name, object.Object{Key: object.GenerateEncryptionKey()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the zero value lists everything
+	entries, marker, err := c.ListObjects(object.DefaultBucket, "dir/", object.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 2 || marker != "" {
+		t.Fatalf("unexpected page: %v, marker %q", entries, marker)
+	}
+	entries, marker, err = c.ListObjects(object.DefaultBucket, "dir/", object.ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || marker != entries[0].Name {
+		t.Fatalf("unexpected page: %v, marker %q", entries, marker)
+	}
+	entries, marker, err = c.ListObjects(object.DefaultBucket, "dir/", object.ListOptions{Marker: marker})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || marker != "" {
+		t.Fatalf("unexpected page: %v, marker %q", entries, marker)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -9,9 +10,14 @@ import (
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.sia.tech/jape"
+	"go.sia.tech/renterd/auth"
+	"go.sia.tech/renterd/events"
 	"go.sia.tech/renterd/hostdb"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/renterd/object"
@@ -19,6 +25,7 @@ import (
 	rhpv3 "go.sia.tech/renterd/rhp/v3"
 	"go.sia.tech/renterd/slab"
 	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/renterd/webhooks"
 	"go.sia.tech/siad/types"
 )
 
@@ -62,18 +69,38 @@ func (c *Client) WalletBalance() (bal types.Currency, err error) {
 	return
 }
 
-// WalletAddress returns an address controlled by the wallet.
+// WalletAddress returns the primary address of the wallet, which does not
+// change as new addresses are issued.
 func (c *Client) WalletAddress() (resp types.UnlockHash, err error) {
 	err = c.c.GET("/wallet/address", &resp)
 	return
 }
 
+// WalletAddresses returns the addresses that the wallet has issued.
+func (c *Client) WalletAddresses() (resp []wallet.AddressInfo, err error) {
+	err = c.c.GET("/wallet/addresses", &resp)
+	return
+}
+
+// WalletNextAddress generates a new receive address.
+func (c *Client) WalletNextAddress() (resp wallet.AddressInfo, err error) {
+	err = c.c.POST("/wallet/addresses", nil, &resp)
+	return
+}
+
 // WalletOutputs returns the set of unspent outputs controlled by the wallet.
 func (c *Client) WalletOutputs() (resp []wallet.SiacoinElement, err error) {
 	err = c.c.GET("/wallet/outputs", &resp)
 	return
 }
 
+// WalletReserved returns the outputs reserved by funded transactions that
+// have not been confirmed, released, or expired.
+func (c *Client) WalletReserved() (resp []wallet.Reservation, err error) {
+	err = c.c.GET("/wallet/reserved", &resp)
+	return
+}
+
 // WalletTransactions returns all transactions relevant to the wallet.
 func (c *Client) WalletTransactions(since time.Time, max int) (resp []wallet.Transaction, err error) {
 	err = c.c.GET(fmt.Sprintf("/wallet/transactions?since=%s&max=%d", paramTime(since), max), &resp)
@@ -105,6 +132,51 @@ func (c *Client) WalletSign(txn *types.Transaction, toSign []types.OutputID, cf
 	return c.c.POST("/wallet/sign", req, txn)
 }
 
+// WalletSend funds, signs, and broadcasts a transaction paying the provided
+// outputs. If fee is zero, the node chooses a fee.
+func (c *Client) WalletSend(outputs []types.SiacoinOutput, fee types.Currency, priority wallet.FeePriority) (txn types.Transaction, err error) {
+	err = c.c.POST("/wallet/send", WalletSendRequest{Outputs: outputs, Fee: fee, Priority: priority}, &txn)
+	return
+}
+
+// WalletPrepareSend funds a transaction paying the specified outputs without
+// signing it, returning a bundle that can be signed offline. If fee is zero,
+// the recommended fee is used.
+func (c *Client) WalletPrepareSend(outputs []types.SiacoinOutput, fee types.Currency, priority wallet.FeePriority) (b wallet.SigningBundle, err error) {
+	err = c.c.POST("/wallet/prepare/send", WalletSendRequest{Outputs: outputs, Fee: fee, Priority: priority}, &b)
+	return
+}
+
+// WalletBroadcast broadcasts the transaction of a signed bundle, along with
+// its parents.
+func (c *Client) WalletBroadcast(b wallet.SigningBundle) (txn types.Transaction, err error) {
+	err = c.c.POST("/wallet/broadcast", b, &txn)
+	return
+}
+
+// WalletFeeEstimate returns the fee that txnSet should pay, given the
+// specified priority and the wallet's fee policy.
+func (c *Client) WalletFeeEstimate(txnSet []types.Transaction, priority wallet.FeePriority) (resp WalletFeeEstimateResponse, err error) {
+	err = c.c.POST("/wallet/fee/estimate", WalletFeeEstimateRequest{TransactionSet: txnSet, Priority: priority}, &resp)
+	return
+}
+
+// WalletBump bumps the fee of a pool transaction using child-pays-for-parent,
+// returning the broadcast child transaction, which spends the transaction's
+// change output.
+func (c *Client) WalletBump(id types.TransactionID, priority wallet.FeePriority) (child types.Transaction, err error) {
+	err = c.c.POST("/wallet/bump", WalletBumpRequest{ID: id, Priority: priority}, &child)
+	return
+}
+
+// WalletDefrag merges the wallet's smallest outputs if it has more than
+// threshold spendable outputs, returning the broadcast transactions. Zero
+// values select the defaults.
+func (c *Client) WalletDefrag(threshold, batchSize int) (txns []types.Transaction, err error) {
+	err = c.c.POST("/wallet/defrag", WalletDefragRequest{Threshold: threshold, BatchSize: batchSize}, &txns)
+	return
+}
+
 // WalletDiscard discards the provided txn, make its inputs usable again. This
 // should only be called on transactions that will never be broadcast.
 func (c *Client) WalletDiscard(txn types.Transaction) error {
@@ -143,9 +215,9 @@ func (c *Client) WalletPrepareRenew(contract types.FileContractRevision, renterK
 	return resp.TransactionSet, resp.FinalPayment, err
 }
 
-// WalletPending returns the txpool transactions that are relevant to the
-// wallet.
-func (c *Client) WalletPending() (resp []types.Transaction, err error) {
+// WalletPending returns the transaction sets originating from the wallet that
+// are pending, along with those that recently confirmed or failed.
+func (c *Client) WalletPending() (resp []wallet.PendingTransaction, err error) {
 	err = c.c.GET("/wallet/pending", &resp)
 	return
 }
@@ -444,35 +516,376 @@ func (c *Client) DeleteSlabs(slabs []slab.Slab, contracts []Contract) (err error
 	return
 }
 
-func (c *Client) objects(path string) (or ObjectsResponse, err error) {
-	err = c.c.GET(fmt.Sprintf("/objects/%s", path), &or)
+// GarbageSectors returns the sectors that are no longer referenced by any
+// object and are queued for deletion.
+func (c *Client) GarbageSectors() (sectors []slab.Sector, err error) {
+	err = c.c.GET("/slabs/gc", &sectors)
+	return
+}
+
+// CollectGarbage deletes unreferenced sectors from the hosts of the supplied
+// contracts, returning the number of bytes reclaimed from each contract.
+func (c *Client) CollectGarbage(contracts []Contract) (resp SlabsGCResponse, err error) {
+	err = c.c.POST("/slabs/gc", SlabsGCRequest{Contracts: contracts}, &resp)
+	return
+}
+
+// Backup writes an encrypted snapshot of the node's metadata to dst.
+func (c *Client) Backup(dst io.Writer) (err error) {
+	c.c.Custom("GET", "/backup", nil, (*[]byte)(nil))
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%v%v", c.c.BaseURL, "/backup"), nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.Password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(ioutil.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		err, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(string(err))
+	}
+	_, err = io.Copy(dst, resp.Body)
+	return
+}
+
+// Metrics writes the node's metrics to dst, in the Prometheus text exposition
+// format.
+func (c *Client) Metrics(dst io.Writer) (err error) {
+	c.c.Custom("GET", "/metrics", nil, (*[]byte)(nil))
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%v%v", c.c.BaseURL, "/metrics"), nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.Password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(ioutil.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		err, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(string(err))
+	}
+	_, err = io.Copy(dst, resp.Body)
+	return
+}
+
+// RestoreBackup loads a snapshot created by Backup into the node, which must
+// not have any objects or contracts.
+func (c *Client) RestoreBackup(r io.Reader) (err error) {
+	c.c.Custom("POST", "/backup/restore", (*[]byte)(nil), nil)
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%v%v", c.c.BaseURL, "/backup/restore"), r)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.SetBasicAuth("", c.c.Password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(ioutil.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		err, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(string(err))
+	}
+	return nil
+}
+
+// An EventStream reads events from the /events endpoint.
+type EventStream struct {
+	body io.ReadCloser
+	r    *bufio.Reader
+	// LastID is the ID of the last event sent by the server. If the stream is
+	// interrupted, it can be resumed with EventsSince.
+	LastID uint64
+}
+
+// Next blocks until the next event is received.
+func (es *EventStream) Next() (events.Event, error) {
+	var data []byte
+	for {
+		line, err := es.r.ReadString('\n')
+		if err != nil {
+			return events.Event{}, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && data != nil:
+			var e events.Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				return events.Event{}, err
+			}
+			return e, nil
+		case strings.HasPrefix(line, "id: "):
+			if es.LastID, err = strconv.ParseUint(line[len("id: "):], 10, 64); err != nil {
+				return events.Event{}, err
+			}
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, line[len("data: "):]...)
+		}
+	}
+}
+
+// Close closes the stream.
+func (es *EventStream) Close() error {
+	return es.body.Close()
+}
+
+func (c *Client) events(lastID string) (*EventStream, error) {
+	c.c.Custom("GET", "/events", nil, (*[]events.Event)(nil))
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%v%v", c.c.BaseURL, "/events"), nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.Password)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		err, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.New(string(err))
+	}
+	return &EventStream{body: resp.Body, r: bufio.NewReader(resp.Body)}, nil
+}
+
+// Events returns a stream of the events published by the node from now on.
+func (c *Client) Events() (*EventStream, error) {
+	return c.events("")
+}
+
+// EventsSince returns a stream of the events published by the node after the
+// event with the specified ID, including those that were missed, as far as
+// the node retains them. If some were not retained, the stream begins with an
+// event of type events.TypeReset.
+func (c *Client) EventsSince(lastID uint64) (*EventStream, error) {
+	return c.events(strconv.FormatUint(lastID, 10))
+}
+
+// Webhooks returns the registered webhooks, without their secrets.
+func (c *Client) Webhooks() (whs []webhooks.Webhook, err error) {
+	err = c.c.GET("/webhooks", &whs)
+	return
+}
+
+// RegisterWebhook registers a webhook that receives events of the specified
+// types, or all events if types is empty. If secret is empty, the node
+// generates one; the returned webhook includes it.
+func (c *Client) RegisterWebhook(url string, types []string, secret string) (wh webhooks.Webhook, err error) {
+	err = c.c.POST("/webhooks", WebhookRegisterRequest{URL: url, Events: types, Secret: secret}, &wh)
+	return
+}
+
+// AuthKeys returns the node's API keys, without their secrets.
+func (c *Client) AuthKeys() (keys []auth.Key, err error) {
+	err = c.c.GET("/auth/keys", &keys)
+	return
+}
+
+// CreateAuthKey creates an API key with the specified scopes, returning the key
+// and its secret, which the node does not store. If bucket is set, the object
+// scopes only allow the key to access objects in it. If prefix is set, the
+// objects:write scope only allows the key to modify objects whose keys begin
+// with it, in bucket or else the default bucket.
+func (c *Client) CreateAuthKey(name string, scopes []string, bucket, prefix string) (auth.Key, string, error) {
+	var resp AuthKeyCreateResponse
+	err := c.c.POST("/auth/keys", AuthKeyCreateRequest{Name: name, Scopes: scopes, Bucket: bucket, Prefix: prefix}, &resp)
+	return resp.Key, resp.Secret, err
+}
+
+// DeleteAuthKey revokes the API key with the specified ID.
+func (c *Client) DeleteAuthKey(id string) (err error) {
+	err = c.c.DELETE("/auth/keys/" + id)
+	return
+}
+
+// DeleteWebhook removes the webhook with the specified ID.
+func (c *Client) DeleteWebhook(id string) (err error) {
+	err = c.c.DELETE("/webhooks/" + id)
+	return
+}
+
+// TestWebhook delivers a test event to the webhook with the specified ID.
+func (c *Client) TestWebhook(id string) (err error) {
+	err = c.c.POST("/webhooks/"+id+"/test", nil, nil)
+	return
+}
+
+// DeadLetters returns the events that could not be delivered to webhooks.
+func (c *Client) DeadLetters() (dls []webhooks.DeadLetter, err error) {
+	err = c.c.GET("/deadletters", &dls)
+	return
+}
+
+// RetryDeadLetter attempts to deliver a dead letter again, removing it if the
+// delivery succeeds.
+func (c *Client) RetryDeadLetter(id string) (err error) {
+	err = c.c.POST("/deadletters/"+id+"/retry", nil, nil)
+	return
+}
+
+// DiscardDeadLetter removes a dead letter without delivering it.
+func (c *Client) DiscardDeadLetter(id string) (err error) {
+	err = c.c.DELETE("/deadletters/" + id)
+	return
+}
+
+// Buckets returns all buckets.
+func (c *Client) Buckets() (buckets []object.Bucket, err error) {
+	err = c.c.GET("/buckets", &buckets)
+	return
+}
+
+// Bucket returns the bucket with the given name.
+func (c *Client) Bucket(name string) (b object.Bucket, err error) {
+	err = c.c.GET(fmt.Sprintf("/buckets/%s", name), &b)
+	return
+}
+
+// SetBucket creates the bucket with the given name, or updates its settings if
+// it already exists.
+func (c *Client) SetBucket(name string, settings object.BucketSettings) (err error) {
+	err = c.c.PUT(fmt.Sprintf("/buckets/%s", name), settings)
+	return
+}
+
+// DeleteBucket deletes the bucket with the given name, which must be empty.
+func (c *Client) DeleteBucket(name string) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/buckets/%s", name))
+	return
+}
+
+func objectsPath(bucket, path string, values url.Values) string {
+	if values == nil {
+		values = url.Values{}
+	}
+	values.Set("bucket", bucket)
+	return fmt.Sprintf("/objects/%s?%s", path, values.Encode())
+}
+
+func (c *Client) objects(bucket, path string, values url.Values) (or ObjectsResponse, err error) {
+	err = c.c.GET(objectsPath(bucket, path, values), &or)
 	return
 }
 
 // Object returns the object with the given name.
-func (c *Client) Object(name string) (o object.Object, err error) {
-	or, err := c.objects(name)
+func (c *Client) Object(bucket, name string) (o object.Object, err error) {
+	or, err := c.objects(bucket, name, nil)
 	if err == nil {
 		o = *or.Object
 	}
 	return
 }
 
+// ObjectVersion returns the specified version of the object with the given
+// name.
+func (c *Client) ObjectVersion(bucket, name, versionID string) (o object.Object, err error) {
+	or, err := c.objects(bucket, name, url.Values{"version": {versionID}})
+	if err == nil {
+		o = *or.Object
+	}
+	return
+}
+
+// ObjectVersions returns the versions of the object with the given name,
+// newest first.
+func (c *Client) ObjectVersions(bucket, name string) (versions []object.Version, err error) {
+	or, err := c.objects(bucket, name, url.Values{"versions": {"true"}})
+	return or.Versions, err
+}
+
 // ObjectEntries returns the entries at the given path, which must end in /.
-func (c *Client) ObjectEntries(path string) (entries []string, err error) {
-	or, err := c.objects(path)
+func (c *Client) ObjectEntries(bucket, path string) (entries []object.Entry, err error) {
+	or, err := c.objects(bucket, path, nil)
 	return or.Entries, err
 }
 
+// ListObjects returns a page of the entries at the given path, which must end
+// in /. If more entries remain, the returned marker can be used to request the
+// next page.
+func (c *Client) ListObjects(bucket, path string, opts object.ListOptions) (entries []object.Entry, nextMarker string, err error) {
+	values := url.Values{}
+	values.Set("marker", opts.Marker)
+	values.Set("limit", fmt.Sprint(opts.Limit))
+	values.Set("sort", opts.SortBy)
+	values.Set("desc", fmt.Sprint(opts.Descending))
+	or, err := c.objects(bucket, path, values)
+	return or.Entries, or.NextMarker, err
+}
+
 // AddObject stores the provided object under the given name.
-func (c *Client) AddObject(name string, o object.Object) (err error) {
-	err = c.c.PUT(fmt.Sprintf("/objects/%s", name), o)
+func (c *Client) AddObject(bucket, name string, o object.Object) (err error) {
+	err = c.c.PUT(objectsPath(bucket, name, nil), o)
 	return
 }
 
 // DeleteObject deletes the object with the given name.
-func (c *Client) DeleteObject(name string) (err error) {
-	err = c.c.DELETE(fmt.Sprintf("/objects/%s", name))
+func (c *Client) DeleteObject(bucket, name string) (err error) {
+	err = c.c.DELETE(objectsPath(bucket, name, nil))
+	return
+}
+
+// DeleteObjects deletes all objects whose name begins with the given prefix,
+// which must end in /. If dryRun is true, the objects are not deleted; the
+// response merely reports which objects would have been.
+func (c *Client) DeleteObjects(bucket, prefix string, dryRun bool) (resp ObjectsDeleteResponse, err error) {
+	path := objectsPath(bucket, prefix, url.Values{"dryrun": {fmt.Sprint(dryRun)}})
+	c.c.Custom("DELETE", path, nil, &resp)
+
+	req, err := http.NewRequest("DELETE", c.c.BaseURL+path, nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.Password)
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ObjectsDeleteResponse{}, err
+	}
+	defer io.Copy(ioutil.Discard, r.Body)
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		err, _ := ioutil.ReadAll(r.Body)
+		return ObjectsDeleteResponse{}, errors.New(string(err))
+	}
+	err = json.NewDecoder(r.Body).Decode(&resp)
+	return
+}
+
+// VersioningPolicies returns the versioning policy of each prefix in the
+// given bucket.
+func (c *Client) VersioningPolicies(bucket string) (policies map[string]object.VersioningPolicy, err error) {
+	err = c.c.GET("/versioning?bucket="+url.QueryEscape(bucket), &policies)
+	return
+}
+
+// SetVersioningPolicy sets the versioning policy for objects in the given
+// bucket whose name begins with the given prefix. Setting the zero policy
+// removes it. Disabling or removing a policy removes the noncurrent versions it
+// retained.
+func (c *Client) SetVersioningPolicy(bucket, prefix string, policy object.VersioningPolicy) (err error) {
+	err = c.c.PUT(fmt.Sprintf("/versioning/%s?bucket=%s", prefix, url.QueryEscape(bucket)), policy)
+	return
+}
+
+// PruneVersions removes all noncurrent object versions that have outlived
+// their retention period. The node also does this periodically.
+func (c *Client) PruneVersions() (err error) {
+	err = c.c.POST("/versioning/prune", nil, nil)
 	return
 }
 
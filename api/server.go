@@ -3,20 +3,30 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log"
+	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gitlab.com/NebulousLabs/encoding"
 	"go.sia.tech/jape"
+	"go.sia.tech/renterd/auth"
+	"go.sia.tech/renterd/events"
 	"go.sia.tech/renterd/hostdb"
 	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/internal/metrics"
 	"go.sia.tech/renterd/object"
 	rhpv2 "go.sia.tech/renterd/rhp/v2"
 	rhpv3 "go.sia.tech/renterd/rhp/v3"
 	"go.sia.tech/renterd/slab"
 	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/renterd/webhooks"
 	"go.sia.tech/siad/types"
 )
 
@@ -46,11 +56,20 @@ type (
 	Wallet interface {
 		Balance() types.Currency
 		Address() types.UnlockHash
+		Addresses() ([]wallet.AddressInfo, error)
+		NextAddress() (wallet.AddressInfo, error)
+		OwnsAddress(addr types.UnlockHash) bool
 		UnspentOutputs() ([]wallet.SiacoinElement, error)
 		Transactions(since time.Time, max int) ([]wallet.Transaction, error)
+		Reservations() ([]wallet.Reservation, error)
 		FundTransaction(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction) ([]types.OutputID, error)
 		ReleaseInputs(txn types.Transaction)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.OutputID, cf types.CoveredFields) error
+		Defrag(cs consensus.State, threshold, batchSize int, feePerByte types.Currency, pool []types.Transaction) ([]types.Transaction, error)
+		TrackTransactionSet(txns []types.Transaction) error
+		PendingTransactions() ([]wallet.PendingTransaction, error)
+		FeePolicy() wallet.FeePolicy
+		BumpTransaction(cs consensus.State, parent types.Transaction, feePerByte types.Currency) (types.Transaction, error)
 	}
 
 	// A HostDB stores information about hosts.
@@ -96,13 +115,120 @@ type (
 
 	// An ObjectStore stores objects.
 	ObjectStore interface {
-		List(key string) []string
-		Get(key string) (object.Object, error)
-		Put(key string, o object.Object) error
-		Delete(key string) error
+		Buckets() ([]object.Bucket, error)
+		Bucket(name string) (object.Bucket, error)
+		SetBucket(name string, settings object.BucketSettings) error
+		DeleteBucket(name string) error
+		List(bucket, path string, opts object.ListOptions) ([]object.Entry, bool, error)
+		Get(bucket, key string) (object.Object, error)
+		GetVersion(bucket, key, versionID string) (object.Object, error)
+		Versions(bucket, key string) ([]object.Version, error)
+		Put(bucket, key string, o object.Object) error
+		AddSlabs(slabs []slab.Slab) error
+		Delete(bucket, key string) error
+		DeletePrefix(bucket, prefix string, dryRun bool) ([]string, int64, error)
+		GarbageSectors() ([]slab.Sector, error)
+		RemoveGarbageSectors(sectors []slab.Sector) error
+		VersioningPolicies(bucket string) (map[string]object.VersioningPolicy, error)
+		SetVersioningPolicy(bucket, prefix string, policy object.VersioningPolicy) error
+		PruneVersions() error
+	}
+
+	// A BackupStore creates and restores encrypted snapshots of the node's
+	// metadata.
+	BackupStore interface {
+		Backup() ([]byte, error)
+		Restore(backup []byte) error
+	}
+
+	// An EventBus distributes node events to subscribers.
+	EventBus interface {
+		Publish(typ string, data interface{})
+		Subscribe(lastID uint64) *events.Subscription
+	}
+
+	// A WebhookManager delivers node events to registered webhooks.
+	WebhookManager interface {
+		Webhooks() ([]webhooks.Webhook, error)
+		Register(url string, types []string, secret string) (webhooks.Webhook, error)
+		Delete(id string) error
+		Test(id string) error
+		DeadLetters() ([]webhooks.DeadLetter, error)
+		RetryDeadLetter(id string) error
+		DiscardDeadLetter(id string) error
+	}
+
+	// A KeyManager creates and authenticates scoped API keys.
+	KeyManager interface {
+		Keys() ([]auth.Key, error)
+		Create(name string, scopes []string, bucket, prefix string) (auth.Key, string, error)
+		Delete(id string) error
+		Authenticate(secret string) (auth.Key, bool)
 	}
 )
 
+// eventsKeepalive is the interval at which comments are sent on idle event
+// streams, so that proxies do not close them.
+const eventsKeepalive = 30 * time.Second
+
+// transferBuckets are the buckets of the slab transfer duration histogram.
+var transferBuckets = []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+var (
+	requestDurations = metrics.Default.NewHistogramVec("renterd_api_request_duration_seconds", "Duration of API requests.", metrics.DefaultBuckets, "route")
+	transferBytes    = metrics.Default.NewCounterVec("renterd_slab_transfer_bytes_total", "Slab data uploaded or downloaded through the API.", "direction")
+	transferDuration = metrics.Default.NewHistogramVec("renterd_slab_transfer_duration_seconds", "Duration of slab uploads and downloads.", transferBuckets, "direction")
+)
+
+// instrument wraps each handler in routes so that the latency of its route is
+// recorded.
+func instrument(routes map[string]jape.Handler) map[string]jape.Handler {
+	for route, h := range routes {
+		h, hist := h, requestDurations.With(strings.Join(strings.Fields(route), " "))
+		routes[route] = func(jc jape.Context) {
+			defer hist.ObserveSince(time.Now())
+			h(jc)
+		}
+	}
+	return routes
+}
+
+// recordTransfer records a slab upload or download that began at start.
+func recordTransfer(direction string, n int64, start time.Time) {
+	transferBytes.With(direction).Add(float64(n))
+	transferDuration.With(direction).ObserveSince(start)
+}
+
+// A countingReader counts the bytes read from an io.Reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// A countingWriter counts the bytes written to an io.Writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// siacoins converts c to a (possibly inexact) number of siacoins.
+func siacoins(c types.Currency) float64 {
+	f, _ := new(big.Rat).SetFrac(c.Big(), types.SiacoinPrecision.Big()).Float64()
+	return f
+}
+
 type server struct {
 	s   Syncer
 	cm  ChainManager
@@ -114,6 +240,80 @@ type server struct {
 	hss HostSetStore
 	sm  SlabMover
 	os  ObjectStore
+	bs  BackupStore
+	eb  EventBus
+	wm  WebhookManager
+	km  KeyManager
+
+	mu      sync.Mutex
+	offline map[PublicKey]bool
+}
+
+// requestBucket returns the bucket that a request accesses: the bucket named by
+// the route, if any, or else the bucket form value. Of the routes guarded by the
+// object scopes, only the bucket routes have a name parameter.
+func requestBucket(jc jape.Context) string {
+	if name := jc.PathParam("name"); name != "" {
+		return name
+	}
+	return bucketParam(jc)
+}
+
+// scoped wraps h so that it requires an API key that grants scope, passed as
+// the basic auth password, for the bucket accessed by the request. If the
+// server has no key manager, requests are not authenticated.
+func (s *server) scoped(scope string, h jape.Handler) jape.Handler {
+	return s.scopedTo(scope, requestBucket, h)
+}
+
+// unbucketed is like scoped, for routes that do not access a particular bucket.
+func (s *server) unbucketed(scope string, h jape.Handler) jape.Handler {
+	return s.scopedTo(scope, func(jape.Context) string { return "" }, h)
+}
+
+func (s *server) scopedTo(scope string, bucket func(jape.Context) string, h jape.Handler) jape.Handler {
+	if s.km == nil {
+		return h
+	}
+	return func(jc jape.Context) {
+		_, secret, ok := jc.Request.BasicAuth()
+		key, valid := s.km.Authenticate(secret)
+		if !ok || !valid {
+			http.Error(jc.ResponseWriter, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		} else if !key.Allows(scope, bucket(jc), jc.PathParam("key")) {
+			http.Error(jc.ResponseWriter, fmt.Sprintf("API key %q does not grant %v access to this route", key.Name, scope), http.StatusForbidden)
+			return
+		}
+		h(jc)
+	}
+}
+
+// publish publishes an event to the server's event bus, if it has one.
+func (s *server) publish(typ string, data interface{}) {
+	if s.eb != nil {
+		s.eb.Publish(typ, data)
+	}
+}
+
+// transferEvent returns the data of an event reporting the outcome of a
+// transfer.
+func transferEvent(slabs int, bytes int64, err error) events.Transfer {
+	e := events.Transfer{Slabs: slabs, Bytes: bytes}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// setOffline records whether a host responded to a scan, reporting whether it
+// was previously considered online.
+func (s *server) setOffline(hostKey PublicKey, offline bool) (wentOffline bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, known := s.offline[hostKey]
+	s.offline[hostKey] = offline
+	return offline && (!known || !prev)
 }
 
 func (s *server) syncerPeersHandler(jc jape.Context) {
@@ -137,8 +337,19 @@ func (s *server) txpoolTransactionsHandler(jc jape.Context) {
 
 func (s *server) txpoolBroadcastHandler(jc jape.Context) {
 	var txnSet []types.Transaction
-	if jc.Decode(&txnSet) == nil {
-		jc.Check("couldn't broadcast transaction set", s.tp.AddTransactionSet(txnSet))
+	if jc.Decode(&txnSet) != nil {
+		return
+	} else if jc.Check("couldn't broadcast transaction set", s.tp.AddTransactionSet(txnSet)) != nil {
+		return
+	}
+	// track sets that spend wallet outputs until they confirm
+	for _, txn := range txnSet {
+		for _, sci := range txn.SiacoinInputs {
+			if s.w.OwnsAddress(sci.UnlockConditions.UnlockHash()) {
+				jc.Check("couldn't track transaction set", s.w.TrackTransactionSet(txnSet))
+				return
+			}
+		}
 	}
 }
 
@@ -150,6 +361,20 @@ func (s *server) walletAddressHandler(jc jape.Context) {
 	jc.Encode(s.w.Address())
 }
 
+func (s *server) walletAddressesHandlerGET(jc jape.Context) {
+	addrs, err := s.w.Addresses()
+	if jc.Check("couldn't load addresses", err) == nil {
+		jc.Encode(addrs)
+	}
+}
+
+func (s *server) walletAddressesHandlerPOST(jc jape.Context) {
+	addr, err := s.w.NextAddress()
+	if jc.Check("couldn't generate address", err) == nil {
+		jc.Encode(addr)
+	}
+}
+
 func (s *server) walletTransactionsHandler(jc jape.Context) {
 	var since time.Time
 	max := -1
@@ -169,15 +394,29 @@ func (s *server) walletOutputsHandler(jc jape.Context) {
 	}
 }
 
+func (s *server) walletReservedHandler(jc jape.Context) {
+	rs, err := s.w.Reservations()
+	if jc.Check("couldn't load reservations", err) == nil {
+		jc.Encode(rs)
+	}
+}
+
+// feePerByte returns the fee per byte that transactions with the specified
+// priority should pay.
+func (s *server) feePerByte(priority wallet.FeePriority) types.Currency {
+	return s.w.FeePolicy().FeePerByte(s.tp.RecommendedFee(), priority)
+}
+
 func (s *server) walletFundHandler(jc jape.Context) {
 	var wfr WalletFundRequest
 	if jc.Decode(&wfr) != nil {
 		return
+	} else if err := wfr.Priority.Validate(); err != nil {
+		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
 	}
 	txn := wfr.Transaction
-	fee := s.tp.RecommendedFee().Mul64(uint64(len(encoding.Marshal(txn))))
-	txn.MinerFees = []types.Currency{fee}
-	toSign, err := s.w.FundTransaction(s.cm.TipState(), &txn, wfr.Amount.Add(txn.MinerFees[0]), s.tp.Transactions())
+	toSign, err := s.fundWithFee(s.cm.TipState(), &txn, wfr.Amount, s.feePerByte(wfr.Priority))
 	if jc.Check("couldn't fund transaction", err) != nil {
 		return
 	}
@@ -204,6 +443,227 @@ func (s *server) walletSignHandler(jc jape.Context) {
 	}
 }
 
+// validateSendRequest checks that wsr pays at least one output, and that no
+// output is empty.
+func validateSendRequest(wsr WalletSendRequest) error {
+	if len(wsr.Outputs) == 0 {
+		return errors.New("no outputs specified")
+	} else if err := wsr.Priority.Validate(); err != nil {
+		return err
+	}
+	for _, sco := range wsr.Outputs {
+		if sco.Value.IsZero() {
+			return errors.New("outputs must have a non-zero value")
+		}
+	}
+	return nil
+}
+
+// fundSendTransaction returns a transaction paying the outputs of wsr, funded
+// by the wallet.
+func (s *server) fundSendTransaction(cs consensus.State, wsr WalletSendRequest) (types.Transaction, []types.OutputID, error) {
+	var amount types.Currency
+	for _, sco := range wsr.Outputs {
+		amount = amount.Add(sco.Value)
+	}
+	txn := types.Transaction{
+		SiacoinOutputs: append([]types.SiacoinOutput(nil), wsr.Outputs...),
+	}
+	if wsr.Fee.IsZero() {
+		toSign, err := s.fundWithFee(cs, &txn, amount, s.feePerByte(wsr.Priority))
+		return txn, toSign, err
+	}
+	txn.MinerFees = []types.Currency{wsr.Fee}
+	toSign, err := s.w.FundTransaction(cs, &txn, amount.Add(wsr.Fee), s.tp.Transactions())
+	return txn, toSign, err
+}
+
+// fundWithFee funds txn with amount, plus a miner fee of feePerByte for each
+// byte of the signed transaction. Funding adds inputs, signatures, and possibly
+// a change output, so txn is refunded with a larger fee until the fee covers
+// the size of the funded transaction.
+func (s *server) fundWithFee(cs consensus.State, txn *types.Transaction, amount, feePerByte types.Currency) ([]types.OutputID, error) {
+	fee := feePerByte.Mul64(uint64(wallet.SignedSize(*txn, nil)))
+	for {
+		funded := *txn
+		funded.SiacoinInputs = append([]types.SiacoinInput(nil), txn.SiacoinInputs...)
+		funded.SiacoinOutputs = append([]types.SiacoinOutput(nil), txn.SiacoinOutputs...)
+		funded.MinerFees = []types.Currency{fee}
+		toSign, err := s.w.FundTransaction(cs, &funded, amount.Add(fee), s.tp.Transactions())
+		if err != nil {
+			return nil, err
+		}
+		required := feePerByte.Mul64(uint64(wallet.SignedSize(funded, toSign)))
+		if fee.Cmp(required) >= 0 {
+			*txn = funded
+			return toSign, nil
+		}
+		s.w.ReleaseInputs(funded)
+		fee = required
+	}
+}
+
+func (s *server) walletSendHandler(jc jape.Context) {
+	var wsr WalletSendRequest
+	if jc.Decode(&wsr) != nil {
+		return
+	} else if err := validateSendRequest(wsr); err != nil {
+		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cs := s.cm.TipState()
+	txn, toSign, err := s.fundSendTransaction(cs, wsr)
+	if jc.Check("couldn't fund transaction", err) != nil {
+		return
+	}
+	if err := s.w.SignTransaction(cs, &txn, toSign, types.FullCoveredFields); jc.Check("couldn't sign transaction", err) != nil {
+		s.w.ReleaseInputs(txn)
+		return
+	}
+	parents, err := s.tp.UnconfirmedParents(txn)
+	if jc.Check("couldn't load transaction dependencies", err) != nil {
+		s.w.ReleaseInputs(txn)
+		return
+	}
+	if err := s.tp.AddTransactionSet(append(parents, txn)); jc.Check("couldn't broadcast transaction", err) != nil {
+		s.w.ReleaseInputs(txn)
+		return
+	} else if jc.Check("couldn't track transaction", s.w.TrackTransactionSet(append(parents, txn))) != nil {
+		return
+	}
+	jc.Encode(txn)
+}
+
+func (s *server) walletPrepareSendHandler(jc jape.Context) {
+	var wsr WalletSendRequest
+	if jc.Decode(&wsr) != nil {
+		return
+	} else if err := validateSendRequest(wsr); err != nil {
+		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cs := s.cm.TipState()
+	txn, toSign, err := s.fundSendTransaction(cs, wsr)
+	if jc.Check("couldn't fund transaction", err) != nil {
+		return
+	}
+	parents, err := s.tp.UnconfirmedParents(txn)
+	if jc.Check("couldn't load transaction dependencies", err) != nil {
+		s.w.ReleaseInputs(txn)
+		return
+	}
+	jc.Encode(wallet.SigningBundle{
+		Transaction:   txn,
+		ToSign:        toSign,
+		CoveredFields: types.FullCoveredFields,
+		State:         cs,
+		Parents:       parents,
+	})
+}
+
+func (s *server) walletBroadcastHandler(jc jape.Context) {
+	var b wallet.SigningBundle
+	if jc.Decode(&b) != nil {
+		return
+	}
+	txnSet := append(b.Parents, b.Transaction)
+	if jc.Check("couldn't broadcast transaction", s.tp.AddTransactionSet(txnSet)) != nil {
+		return
+	} else if jc.Check("couldn't track transaction", s.w.TrackTransactionSet(txnSet)) != nil {
+		return
+	}
+	jc.Encode(b.Transaction)
+}
+
+func (s *server) walletFeeEstimateHandler(jc jape.Context) {
+	var wfer WalletFeeEstimateRequest
+	if jc.Decode(&wfer) != nil {
+		return
+	} else if err := wfer.Priority.Validate(); err != nil {
+		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var resp WalletFeeEstimateResponse
+	for _, txn := range wfer.TransactionSet {
+		resp.Size += uint64(len(encoding.Marshal(txn)))
+		for _, fee := range txn.MinerFees {
+			resp.Paid = resp.Paid.Add(fee)
+		}
+	}
+	resp.FeePerByte = s.feePerByte(wfer.Priority)
+	resp.Fee = resp.FeePerByte.Mul64(resp.Size)
+	jc.Encode(resp)
+}
+
+func (s *server) walletBumpHandler(jc jape.Context) {
+	var wbr WalletBumpRequest
+	if jc.Decode(&wbr) != nil {
+		return
+	} else if err := wbr.Priority.Validate(); err != nil {
+		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var parent *types.Transaction
+	pool := s.tp.Transactions()
+	for i := range pool {
+		if pool[i].ID() == wbr.ID {
+			parent = &pool[i]
+			break
+		}
+	}
+	if parent == nil {
+		http.Error(jc.ResponseWriter, "transaction is not in the transaction pool", http.StatusBadRequest)
+		return
+	}
+	child, err := s.w.BumpTransaction(s.cm.TipState(), *parent, s.feePerByte(wbr.Priority))
+	if jc.Check("couldn't bump transaction", err) != nil {
+		return
+	}
+	parents, err := s.tp.UnconfirmedParents(*parent)
+	if jc.Check("couldn't load transaction dependencies", err) != nil {
+		return
+	}
+	txnSet := append(parents, *parent, child)
+	if jc.Check("couldn't broadcast transaction", s.tp.AddTransactionSet(txnSet)) != nil {
+		return
+	} else if jc.Check("couldn't track transaction", s.w.TrackTransactionSet(txnSet)) != nil {
+		return
+	}
+	jc.Encode(child)
+}
+
+func (s *server) walletDefragHandler(jc jape.Context) {
+	var wdr WalletDefragRequest
+	if jc.Decode(&wdr) != nil {
+		return
+	}
+	if wdr.Threshold == 0 {
+		wdr.Threshold = wallet.DefaultDefragThreshold
+	}
+	if wdr.BatchSize == 0 {
+		wdr.BatchSize = wallet.DefaultDefragBatchSize
+	}
+	txns, err := s.w.Defrag(s.cm.TipState(), wdr.Threshold, wdr.BatchSize, s.feePerByte(wallet.FeePriorityLow), s.tp.Transactions())
+	if jc.Check("couldn't defragment wallet", err) != nil {
+		return
+	}
+	for i, txn := range txns {
+		parents, err := s.tp.UnconfirmedParents(txn)
+		if err == nil {
+			err = s.tp.AddTransactionSet(append(parents, txn))
+		}
+		if jc.Check("couldn't broadcast transaction", err) != nil {
+			for _, txn := range txns[i:] {
+				s.w.ReleaseInputs(txn)
+			}
+			return
+		} else if jc.Check("couldn't track transaction", s.w.TrackTransactionSet(append(parents, txn))) != nil {
+			return
+		}
+	}
+	jc.Encode(txns)
+}
+
 func (s *server) walletDiscardHandler(jc jape.Context) {
 	var txn types.Transaction
 	if jc.Decode(&txn) == nil {
@@ -221,7 +681,7 @@ func (s *server) walletPrepareFormHandler(jc jape.Context) {
 	txn := types.Transaction{
 		FileContracts: []types.FileContract{fc},
 	}
-	txn.MinerFees = []types.Currency{s.tp.RecommendedFee().Mul64(uint64(len(encoding.Marshal(txn))))}
+	txn.MinerFees = []types.Currency{s.feePerByte(wallet.FeePriorityMedium).Mul64(uint64(len(encoding.Marshal(txn))))}
 	toSign, err := s.w.FundTransaction(s.cm.TipState(), &txn, cost.Add(txn.MinerFees[0]), s.tp.Transactions())
 	if jc.Check("couldn't fund transaction", err) != nil {
 		return
@@ -254,7 +714,7 @@ func (s *server) walletPrepareRenewHandler(jc jape.Context) {
 	txn := types.Transaction{
 		FileContracts: []types.FileContract{fc},
 	}
-	txn.MinerFees = []types.Currency{s.tp.RecommendedFee().Mul64(uint64(len(encoding.Marshal(txn))))}
+	txn.MinerFees = []types.Currency{s.feePerByte(wallet.FeePriorityMedium).Mul64(uint64(len(encoding.Marshal(txn))))}
 	toSign, err := s.w.FundTransaction(s.cm.TipState(), &txn, cost.Add(txn.MinerFees[0]), s.tp.Transactions())
 	if jc.Check("couldn't fund transaction", err) != nil {
 		return
@@ -277,29 +737,10 @@ func (s *server) walletPrepareRenewHandler(jc jape.Context) {
 }
 
 func (s *server) walletPendingHandler(jc jape.Context) {
-	isRelevant := func(txn types.Transaction) bool {
-		addr := s.w.Address()
-		for _, sci := range txn.SiacoinInputs {
-			if sci.UnlockConditions.UnlockHash() == addr {
-				return true
-			}
-		}
-		for _, sco := range txn.SiacoinOutputs {
-			if sco.UnlockHash == addr {
-				return true
-			}
-		}
-		return false
-	}
-
-	txns := s.tp.Transactions()
-	relevant := txns[:0]
-	for _, txn := range txns {
-		if isRelevant(txn) {
-			relevant = append(relevant, txn)
-		}
+	pts, err := s.w.PendingTransactions()
+	if jc.Check("couldn't load pending transactions", err) == nil {
+		jc.Encode(pts)
 	}
-	jc.Encode(relevant)
 }
 
 func (s *server) hostsHandler(jc jape.Context) {
@@ -381,11 +822,30 @@ func (s *server) rhpScanHandler(jc jape.Context) {
 		return
 	}
 	settings, err := s.rhp.Settings(jc.Request.Context(), rsr.HostIP, rsr.HostKey)
+	if s.setOffline(rsr.HostKey, err != nil) {
+		s.publish(events.TypeHostOffline, events.HostOffline{
+			HostKey: rsr.HostKey,
+			HostIP:  rsr.HostIP,
+			Error:   err.Error(),
+		})
+	}
 	if jc.Check("couldn't scan host", err) == nil {
 		jc.Encode(settings)
 	}
 }
 
+// trackContractTransaction tracks the transaction set that formed or renewed
+// a contract. By then the contract has been paid for, so a failure is logged
+// instead of returned; otherwise the caller would never receive the contract.
+// Stateless servers have no wallet to track the set with.
+func (s *server) trackContractTransaction(id types.FileContractID, txnSet []types.Transaction) {
+	if s.w == nil {
+		return
+	} else if err := s.w.TrackTransactionSet(txnSet); err != nil {
+		log.Printf("WARN: couldn't track transaction set of contract %v: %v", id, err)
+	}
+}
+
 func (s *server) rhpFormHandler(jc jape.Context) {
 	var rfr RHPFormRequest
 	if jc.Decode(&rfr) != nil {
@@ -397,6 +857,12 @@ func (s *server) rhpFormHandler(jc jape.Context) {
 	if jc.Check("couldn't form contract", err) != nil {
 		return
 	}
+	s.trackContractTransaction(contract.ID(), txnSet)
+	s.publish(events.TypeContractFormed, events.Contract{
+		ID:        contract.ID(),
+		HostKey:   contract.HostKey(),
+		EndHeight: contract.EndHeight(),
+	})
 	jc.Encode(RHPFormResponse{
 		ContractID:     contract.ID(),
 		Contract:       contract,
@@ -415,6 +881,13 @@ func (s *server) rhpRenewHandler(jc jape.Context) {
 	if jc.Check("couldn't renew contract", err) != nil {
 		return
 	}
+	s.trackContractTransaction(contract.ID(), txnSet)
+	s.publish(events.TypeContractRenewed, events.Contract{
+		ID:          contract.ID(),
+		HostKey:     contract.HostKey(),
+		RenewedFrom: rrr.ContractID,
+		EndHeight:   contract.EndHeight(),
+	})
 	jc.Encode(RHPRenewResponse{
 		ContractID:     contract.ID(),
 		Contract:       contract,
@@ -550,10 +1023,20 @@ func (s *server) slabsUploadHandler(jc jape.Context) {
 		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
 		return
 	}
-	slabs, err := s.sm.UploadSlabs(jc.Request.Context(), f, sur.MinShards, sur.TotalShards, sur.CurrentHeight, sur.Contracts)
-	if jc.Check("couldn't upload slabs", err) == nil {
-		jc.Encode(slabs)
+	start := time.Now()
+	cr := &countingReader{r: f}
+	slabs, err := s.sm.UploadSlabs(jc.Request.Context(), cr, sur.MinShards, sur.TotalShards, sur.CurrentHeight, sur.Contracts)
+	recordTransfer("upload", cr.n, start)
+	s.publish(events.TypeUploadFinished, transferEvent(len(slabs), cr.n, err))
+	if jc.Check("couldn't upload slabs", err) != nil {
+		return
+	}
+	// record the uploaded slabs, so that their sectors are not orphaned if
+	// they never end up in an object; stateless servers have no object store
+	if s.os != nil && jc.Check("couldn't record uploaded slabs", s.os.AddSlabs(slabs)) != nil {
+		return
 	}
+	jc.Encode(slabs)
 }
 
 func (s *server) slabsDownloadHandler(jc jape.Context) {
@@ -571,7 +1054,11 @@ func (s *server) slabsDownloadHandler(jc jape.Context) {
 	// TODO: if we encounter an error halfway through the download, it's too
 	// late to change the response code and send an error message. Not sure how
 	// best to handle this.
-	err := s.sm.DownloadSlabs(jc.Request.Context(), jc.ResponseWriter, sdr.Slabs, sdr.Offset, sdr.Length, sdr.Contracts)
+	start := time.Now()
+	cw := &countingWriter{w: jc.ResponseWriter}
+	err := s.sm.DownloadSlabs(jc.Request.Context(), cw, sdr.Slabs, sdr.Offset, sdr.Length, sdr.Contracts)
+	recordTransfer("download", cw.n, start)
+	s.publish(events.TypeDownloadFinished, transferEvent(len(sdr.Slabs), sdr.Length, err))
 	jc.Check("couldn't download slabs", err)
 }
 
@@ -579,6 +1066,7 @@ func (s *server) slabsMigrateHandler(jc jape.Context) {
 	var smr SlabsMigrateRequest
 	if jc.Decode(&smr) == nil {
 		err := s.sm.MigrateSlabs(jc.Request.Context(), smr.Slabs, smr.CurrentHeight, smr.From, smr.To)
+		s.publish(events.TypeRepairFinished, transferEvent(len(smr.Slabs), 0, err))
 		jc.Check("couldn't migrate slabs", err)
 	}
 }
@@ -591,12 +1079,138 @@ func (s *server) slabsDeleteHandler(jc jape.Context) {
 	}
 }
 
+func (s *server) slabsGCHandlerGET(jc jape.Context) {
+	sectors, err := s.os.GarbageSectors()
+	if jc.Check("couldn't load unreferenced sectors", err) == nil {
+		jc.Encode(sectors)
+	}
+}
+
+func (s *server) slabsGCHandlerPOST(jc jape.Context) {
+	var sgr SlabsGCRequest
+	if jc.Decode(&sgr) != nil {
+		return
+	}
+	sectors, err := s.os.GarbageSectors()
+	if jc.Check("couldn't load unreferenced sectors", err) != nil {
+		return
+	}
+	byHost := make(map[PublicKey][]slab.Sector)
+	for _, sector := range sectors {
+		byHost[sector.Host] = append(byHost[sector.Host], sector)
+	}
+
+	// Delete each host's sectors in a single batch. If a host is offline (or
+	// no contract was supplied for it), its sectors remain queued, and will be
+	// retried on the next call.
+	resp := SlabsGCResponse{
+		Contracts: []ContractGCResult{},
+		Remaining: uint64(len(sectors)),
+	}
+	for _, c := range sgr.Contracts {
+		hostSectors, ok := byHost[c.HostKey]
+		if !ok {
+			continue
+		}
+		delete(byHost, c.HostKey)
+		res := ContractGCResult{
+			ContractID: c.ID,
+			HostKey:    c.HostKey,
+		}
+		err := s.sm.DeleteSlabs(jc.Request.Context(), []slab.Slab{{Shards: hostSectors}}, []Contract{c})
+		if err == nil {
+			err = s.os.RemoveGarbageSectors(hostSectors)
+		}
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Sectors = uint64(len(hostSectors))
+			res.ReclaimedBytes = res.Sectors * rhpv2.SectorSize
+			resp.Remaining -= res.Sectors
+		}
+		resp.Contracts = append(resp.Contracts, res)
+	}
+	jc.Encode(resp)
+}
+
+// bucketParam returns the bucket named by the request's "bucket" form value,
+// or the default bucket if none is specified.
+func bucketParam(jc jape.Context) string {
+	if b := jc.Request.FormValue("bucket"); b != "" {
+		return b
+	}
+	return object.DefaultBucket
+}
+
+func (s *server) bucketsHandler(jc jape.Context) {
+	buckets, err := s.os.Buckets()
+	if jc.Check("couldn't load buckets", err) == nil {
+		jc.Encode(buckets)
+	}
+}
+
+func (s *server) bucketsNameHandlerGET(jc jape.Context) {
+	b, err := s.os.Bucket(jc.PathParam("name"))
+	if jc.Check("couldn't load bucket", err) == nil {
+		jc.Encode(b)
+	}
+}
+
+func (s *server) bucketsNameHandlerPUT(jc jape.Context) {
+	var settings object.BucketSettings
+	if jc.Decode(&settings) == nil {
+		jc.Check("couldn't store bucket", s.os.SetBucket(jc.PathParam("name"), settings))
+	}
+}
+
+func (s *server) bucketsNameHandlerDELETE(jc jape.Context) {
+	jc.Check("couldn't delete bucket", s.os.DeleteBucket(jc.PathParam("name")))
+}
+
 func (s *server) objectsKeyHandlerGET(jc jape.Context) {
+	bucket := bucketParam(jc)
 	if strings.HasSuffix(jc.PathParam("key"), "/") {
-		jc.Encode(ObjectsResponse{Entries: s.os.List(jc.PathParam("key"))})
+		opts := object.ListOptions{
+			Marker: jc.Request.FormValue("marker"),
+			SortBy: jc.Request.FormValue("sort"),
+		}
+		if jc.DecodeForm("limit", &opts.Limit) != nil || jc.DecodeForm("desc", &opts.Descending) != nil {
+			return
+		}
+		switch opts.SortBy {
+		case "", object.SortByName, object.SortBySize, object.SortByModified:
+		default:
+			http.Error(jc.ResponseWriter, fmt.Sprintf("invalid sort field %q", opts.SortBy), http.StatusBadRequest)
+			return
+		}
+		entries, more, err := s.os.List(bucket, jc.PathParam("key"), opts)
+		if jc.Check("couldn't list objects", err) != nil {
+			return
+		}
+		resp := ObjectsResponse{Entries: entries}
+		if more && len(entries) > 0 {
+			resp.NextMarker = opts.NextMarker(entries[len(entries)-1])
+		}
+		jc.Encode(resp)
 		return
 	}
-	o, err := s.os.Get(jc.PathParam("key"))
+	var versions bool
+	if jc.DecodeForm("versions", &versions) != nil {
+		return
+	} else if versions {
+		vs, err := s.os.Versions(bucket, jc.PathParam("key"))
+		if jc.Check("couldn't load object versions", err) == nil {
+			jc.Encode(ObjectsResponse{Versions: vs})
+		}
+		return
+	}
+	var o object.Object
+	var err error
+	if id := jc.Request.FormValue("version"); id != "" {
+		o, err = s.os.GetVersion(bucket, jc.PathParam("key"), id)
+	} else {
+		o, err = s.os.Get(bucket, jc.PathParam("key"))
+	}
 	if jc.Check("couldn't load object", err) == nil {
 		jc.Encode(ObjectsResponse{Object: &o})
 	}
@@ -604,93 +1218,373 @@ func (s *server) objectsKeyHandlerGET(jc jape.Context) {
 
 func (s *server) objectsKeyHandlerPUT(jc jape.Context) {
 	var o object.Object
-	if jc.Decode(&o) == nil {
-		jc.Check("couldn't store object", s.os.Put(jc.PathParam("key"), o))
+	if jc.Decode(&o) != nil {
+		return
+	}
+	bucket, key := bucketParam(jc), jc.PathParam("key")
+	if jc.Check("couldn't store object", s.os.Put(bucket, key, o)) == nil {
+		s.publish(events.TypeObjectCreated, events.Object{Bucket: bucket, Key: key})
 	}
 }
 
 func (s *server) objectsKeyHandlerDELETE(jc jape.Context) {
-	jc.Check("couldn't delete object", s.os.Delete(jc.PathParam("key")))
+	bucket := bucketParam(jc)
+	if !strings.HasSuffix(jc.PathParam("key"), "/") {
+		if jc.Check("couldn't delete object", s.os.Delete(bucket, jc.PathParam("key"))) == nil {
+			s.publish(events.TypeObjectDeleted, events.Object{Bucket: bucket, Key: jc.PathParam("key")})
+		}
+		return
+	}
+	var dryRun bool
+	if jc.DecodeForm("dryrun", &dryRun) != nil {
+		return
+	}
+	keys, size, err := s.os.DeletePrefix(bucket, jc.PathParam("key"), dryRun)
+	if jc.Check("couldn't delete objects", err) == nil {
+		if !dryRun {
+			for _, key := range keys {
+				s.publish(events.TypeObjectDeleted, events.Object{Bucket: bucket, Key: key})
+			}
+		}
+		if keys == nil {
+			keys = []string{}
+		}
+		jc.Encode(ObjectsDeleteResponse{
+			Keys: keys,
+			Size: size,
+		})
+	}
 }
 
-// NewServer returns an HTTP handler that serves the renterd API.
-func NewServer(s Syncer, cm ChainManager, tp TransactionPool, w Wallet, hdb HostDB, rhp RHP, cs ContractStore, sm SlabMover, os ObjectStore) http.Handler {
-	srv := server{
-		s:   s,
-		cm:  cm,
-		tp:  tp,
-		w:   w,
-		hdb: hdb,
-		rhp: rhp,
-		cs:  cs,
-		sm:  sm,
-		os:  os,
+func (s *server) versioningHandler(jc jape.Context) {
+	policies, err := s.os.VersioningPolicies(bucketParam(jc))
+	if jc.Check("couldn't load versioning policies", err) == nil {
+		jc.Encode(policies)
 	}
-	return jape.Mux(map[string]jape.Handler{
-		"GET    /syncer/peers":   srv.syncerPeersHandler,
-		"POST   /syncer/connect": srv.syncerConnectHandler,
+}
 
-		"GET    /consensus/tip": srv.consensusTipHandler,
+func (s *server) versioningPrefixHandlerPUT(jc jape.Context) {
+	var policy object.VersioningPolicy
+	if jc.Decode(&policy) == nil {
+		jc.Check("couldn't store versioning policy", s.os.SetVersioningPolicy(bucketParam(jc), jc.PathParam("prefix"), policy))
+	}
+}
 
-		"GET    /txpool/transactions": srv.txpoolTransactionsHandler,
-		"POST   /txpool/broadcast":    srv.txpoolBroadcastHandler,
+func (s *server) versioningPruneHandler(jc jape.Context) {
+	jc.Check("couldn't prune versions", s.os.PruneVersions())
+}
 
-		"GET    /wallet/balance":       srv.walletBalanceHandler,
-		"GET    /wallet/address":       srv.walletAddressHandler,
-		"GET    /wallet/transactions":  srv.walletTransactionsHandler,
-		"GET    /wallet/outputs":       srv.walletOutputsHandler,
-		"POST   /wallet/fund":          srv.walletFundHandler,
-		"POST   /wallet/sign":          srv.walletSignHandler,
-		"POST   /wallet/discard":       srv.walletDiscardHandler,
-		"POST   /wallet/prepare/form":  srv.walletPrepareFormHandler,
-		"POST   /wallet/prepare/renew": srv.walletPrepareRenewHandler,
-		"GET    /wallet/pending":       srv.walletPendingHandler,
+func (s *server) backupHandlerGET(jc jape.Context) {
+	jc.Custom(nil, []byte{})
+	b, err := s.bs.Backup()
+	if jc.Check("couldn't create backup", err) == nil {
+		jc.ResponseWriter.Header().Set("Content-Type", "application/octet-stream")
+		jc.ResponseWriter.Write(b)
+	}
+}
 
-		"GET    /hosts":                     srv.hostsHandler,
-		"GET    /hosts/:pubkey":             srv.hostsPubkeyHandler,
-		"PUT    /hosts/:pubkey/score":       srv.hostsScoreHandler,
-		"POST   /hosts/:pubkey/interaction": srv.hostsInteractionHandler,
+func (s *server) backupRestoreHandler(jc jape.Context) {
+	jc.Custom([]byte{}, nil)
+	b, err := io.ReadAll(jc.Request.Body)
+	if err != nil {
+		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jc.Check("couldn't restore backup", s.bs.Restore(b))
+}
 
-		"POST   /rhp/prepare/form":    srv.rhpPrepareFormHandler,
-		"POST   /rhp/prepare/renew":   srv.rhpPrepareRenewHandler,
-		"POST   /rhp/prepare/payment": srv.rhpPreparePaymentHandler,
-		"POST   /rhp/scan":            srv.rhpScanHandler,
-		"POST   /rhp/form":            srv.rhpFormHandler,
-		"POST   /rhp/renew":           srv.rhpRenewHandler,
-		"POST   /rhp/fund":            srv.rhpFundHandler,
-		"POST   /rhp/registry/read":   srv.rhpRegistryReadHandler,
-		"POST   /rhp/registry/update": srv.rhpRegistryUpdateHandler,
+// writeEvent writes e to an event stream.
+func writeEvent(w io.Writer, e events.Event) {
+	js, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, js)
+}
 
-		"GET    /contracts":     srv.contractsHandler,
-		"GET    /contracts/:id": srv.contractsIDHandlerGET,
-		"PUT    /contracts/:id": srv.contractsIDHandlerPUT,
-		"DELETE /contracts/:id": srv.contractsIDHandlerDELETE,
+func (s *server) eventsHandler(jc jape.Context) {
+	jc.Custom(nil, []events.Event{})
+	// clients resume from the last event they received, identified by the
+	// standard header or, for clients that cannot set it, a query parameter
+	var lastID uint64
+	resume := jc.Request.Header.Get("Last-Event-ID")
+	if id := jc.Request.FormValue("lastEventID"); id != "" {
+		resume = id
+	}
+	if resume != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(resume, 10, 64); err != nil {
+			http.Error(jc.ResponseWriter, "invalid last event ID", http.StatusBadRequest)
+			return
+		}
+	}
+	flusher, ok := jc.ResponseWriter.(http.Flusher)
+	if !ok {
+		http.Error(jc.ResponseWriter, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
 
-		"GET    /hostsets":                 srv.hostsetsHandler,
-		"GET    /hostsets/:name":           srv.hostsetsNameHandlerGET,
-		"PUT    /hostsets/:name":           srv.hostsetsNameHandlerPUT,
-		"GET    /hostsets/:name/contracts": srv.hostsetsContractsHandler,
-		"GET    /hostsets/:name/resolve":   srv.hostsetsResolveHandler,
+	sub := s.eb.Subscribe(lastID)
+	defer sub.Close()
+	w := jc.ResponseWriter
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if resume != "" {
+		if sub.Reset {
+			// tell the client that it missed events, identifying the marker
+			// such that resuming from it succeeds
+			id := sub.LastID
+			if len(sub.Missed) > 0 {
+				id = sub.Missed[0].ID - 1
+			}
+			writeEvent(w, events.Event{ID: id, Type: events.TypeReset, Timestamp: time.Now()})
+		}
+		for _, e := range sub.Missed {
+			writeEvent(w, e)
+		}
+	} else {
+		// an ID without data updates the client's last event ID, so that it
+		// can resume from here even if it receives no events
+		fmt.Fprintf(w, "id: %d\n\n", sub.LastID)
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventsKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-jc.Request.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		flusher.Flush()
+	}
+}
 
-		"POST   /slabs/upload":   srv.slabsUploadHandler,
-		"POST   /slabs/download": srv.slabsDownloadHandler,
-		"POST   /slabs/migrate":  srv.slabsMigrateHandler,
-		"POST   /slabs/delete":   srv.slabsDeleteHandler,
+func (s *server) webhooksHandlerGET(jc jape.Context) {
+	whs, err := s.wm.Webhooks()
+	if jc.Check("couldn't load webhooks", err) == nil {
+		jc.Encode(whs)
+	}
+}
 
-		"GET    /objects/*key": srv.objectsKeyHandlerGET,
-		"PUT    /objects/*key": srv.objectsKeyHandlerPUT,
-		"DELETE /objects/*key": srv.objectsKeyHandlerDELETE,
-	})
+func (s *server) webhooksHandlerPOST(jc jape.Context) {
+	var wrr WebhookRegisterRequest
+	if jc.Decode(&wrr) != nil {
+		return
+	}
+	wh, err := s.wm.Register(wrr.URL, wrr.Events, wrr.Secret)
+	if err != nil {
+		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jc.Encode(wh)
+}
+
+func (s *server) webhooksIDHandlerDELETE(jc jape.Context) {
+	jc.Check("couldn't delete webhook", s.wm.Delete(jc.PathParam("id")))
+}
+
+func (s *server) webhooksIDTestHandler(jc jape.Context) {
+	jc.Check("couldn't deliver test event", s.wm.Test(jc.PathParam("id")))
+}
+
+func (s *server) deadLettersHandler(jc jape.Context) {
+	dls, err := s.wm.DeadLetters()
+	if jc.Check("couldn't load dead letters", err) == nil {
+		jc.Encode(dls)
+	}
+}
+
+func (s *server) deadLettersIDRetryHandler(jc jape.Context) {
+	jc.Check("couldn't deliver dead letter", s.wm.RetryDeadLetter(jc.PathParam("id")))
+}
+
+func (s *server) deadLettersIDHandlerDELETE(jc jape.Context) {
+	jc.Check("couldn't discard dead letter", s.wm.DiscardDeadLetter(jc.PathParam("id")))
+}
+
+func (s *server) authKeysHandlerGET(jc jape.Context) {
+	keys, err := s.km.Keys()
+	if jc.Check("couldn't load API keys", err) == nil {
+		jc.Encode(keys)
+	}
+}
+
+func (s *server) authKeysHandlerPOST(jc jape.Context) {
+	var akr AuthKeyCreateRequest
+	if jc.Decode(&akr) != nil {
+		return
+	}
+	key, secret, err := s.km.Create(akr.Name, akr.Scopes, akr.Bucket, akr.Prefix)
+	if err != nil {
+		http.Error(jc.ResponseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jc.Encode(AuthKeyCreateResponse{Key: key, Secret: secret})
+}
+
+func (s *server) authKeysIDHandlerDELETE(jc jape.Context) {
+	jc.Check("couldn't delete API key", s.km.Delete(jc.PathParam("id")))
+}
+
+func (s *server) metricsHandler(jc jape.Context) {
+	jc.Custom(nil, []byte{})
+	// gauges describing the node's state are sampled on each scrape
+	r := metrics.NewRegistry()
+	if s.cm != nil {
+		r.NewGauge("renterd_consensus_height", "Height of the current chain tip.").Set(float64(s.cm.TipState().Index.Height))
+	}
+	if s.w != nil {
+		r.NewGauge("renterd_wallet_balance_siacoins", "Spendable wallet balance.").Set(siacoins(s.w.Balance()))
+	}
+	if s.cs != nil {
+		contracts, err := s.cs.Contracts()
+		if jc.Check("couldn't load contracts", err) != nil {
+			return
+		}
+		var funds types.Currency
+		for _, c := range contracts {
+			funds = funds.Add(c.RenterFunds())
+		}
+		r.NewGauge("renterd_contracts", "Contracts in the contract store.").Set(float64(len(contracts)))
+		r.NewGauge("renterd_contract_funds_siacoins", "Renter funds remaining in the stored contracts.").Set(siacoins(funds))
+	}
+	jc.ResponseWriter.Header().Set("Content-Type", metrics.ContentType)
+	metrics.Default.WriteTo(jc.ResponseWriter)
+	r.WriteTo(jc.ResponseWriter)
+}
+
+// NewServer returns an HTTP handler that serves the renterd API.
+func NewServer(s Syncer, cm ChainManager, tp TransactionPool, w Wallet, hdb HostDB, rhp RHP, cs ContractStore, sm SlabMover, os ObjectStore, bs BackupStore, eb EventBus, wm WebhookManager, km KeyManager) http.Handler {
+	srv := &server{
+		s:   s,
+		cm:  cm,
+		tp:  tp,
+		w:   w,
+		hdb: hdb,
+		rhp: rhp,
+		cs:  cs,
+		sm:  sm,
+		os:  os,
+		bs:  bs,
+		eb:  eb,
+		wm:  wm,
+		km:  km,
+
+		offline: make(map[PublicKey]bool),
+	}
+	return jape.Mux(instrument(map[string]jape.Handler{
+		"GET    /syncer/peers":   srv.scoped(auth.ScopeAdmin, srv.syncerPeersHandler),
+		"POST   /syncer/connect": srv.scoped(auth.ScopeAdmin, srv.syncerConnectHandler),
+
+		"GET    /consensus/tip": srv.scoped(auth.ScopeAny, srv.consensusTipHandler),
+
+		"GET    /txpool/transactions": srv.scoped(auth.ScopeWallet, srv.txpoolTransactionsHandler),
+		"POST   /txpool/broadcast":    srv.scoped(auth.ScopeWallet, srv.txpoolBroadcastHandler),
+
+		"GET    /wallet/balance":       srv.scoped(auth.ScopeWallet, srv.walletBalanceHandler),
+		"GET    /wallet/address":       srv.scoped(auth.ScopeWallet, srv.walletAddressHandler),
+		"GET    /wallet/addresses":     srv.scoped(auth.ScopeWallet, srv.walletAddressesHandlerGET),
+		"POST   /wallet/addresses":     srv.scoped(auth.ScopeWallet, srv.walletAddressesHandlerPOST),
+		"GET    /wallet/transactions":  srv.scoped(auth.ScopeWallet, srv.walletTransactionsHandler),
+		"GET    /wallet/outputs":       srv.scoped(auth.ScopeWallet, srv.walletOutputsHandler),
+		"GET    /wallet/reserved":      srv.scoped(auth.ScopeWallet, srv.walletReservedHandler),
+		"POST   /wallet/fund":          srv.scoped(auth.ScopeWallet, srv.walletFundHandler),
+		"POST   /wallet/sign":          srv.scoped(auth.ScopeWallet, srv.walletSignHandler),
+		"POST   /wallet/send":          srv.scoped(auth.ScopeWallet, srv.walletSendHandler),
+		"POST   /wallet/prepare/send":  srv.scoped(auth.ScopeWallet, srv.walletPrepareSendHandler),
+		"POST   /wallet/broadcast":     srv.scoped(auth.ScopeWallet, srv.walletBroadcastHandler),
+		"POST   /wallet/defrag":        srv.scoped(auth.ScopeWallet, srv.walletDefragHandler),
+		"POST   /wallet/fee/estimate":  srv.scoped(auth.ScopeWallet, srv.walletFeeEstimateHandler),
+		"POST   /wallet/bump":          srv.scoped(auth.ScopeWallet, srv.walletBumpHandler),
+		"POST   /wallet/discard":       srv.scoped(auth.ScopeWallet, srv.walletDiscardHandler),
+		"POST   /wallet/prepare/form":  srv.scoped(auth.ScopeWallet, srv.walletPrepareFormHandler),
+		"POST   /wallet/prepare/renew": srv.scoped(auth.ScopeWallet, srv.walletPrepareRenewHandler),
+		"GET    /wallet/pending":       srv.scoped(auth.ScopeWallet, srv.walletPendingHandler),
+
+		"GET    /hosts":                     srv.scoped(auth.ScopeHosts, srv.hostsHandler),
+		"GET    /hosts/:pubkey":             srv.scoped(auth.ScopeHosts, srv.hostsPubkeyHandler),
+		"PUT    /hosts/:pubkey/score":       srv.scoped(auth.ScopeHosts, srv.hostsScoreHandler),
+		"POST   /hosts/:pubkey/interaction": srv.scoped(auth.ScopeHosts, srv.hostsInteractionHandler),
+
+		"POST   /rhp/prepare/form":    srv.scoped(auth.ScopeContracts, srv.rhpPrepareFormHandler),
+		"POST   /rhp/prepare/renew":   srv.scoped(auth.ScopeContracts, srv.rhpPrepareRenewHandler),
+		"POST   /rhp/prepare/payment": srv.scoped(auth.ScopeContracts, srv.rhpPreparePaymentHandler),
+		"POST   /rhp/scan":            srv.scoped(auth.ScopeHosts, srv.rhpScanHandler),
+		"POST   /rhp/form":            srv.scoped(auth.ScopeContracts, srv.rhpFormHandler),
+		"POST   /rhp/renew":           srv.scoped(auth.ScopeContracts, srv.rhpRenewHandler),
+		"POST   /rhp/fund":            srv.scoped(auth.ScopeContracts, srv.rhpFundHandler),
+		"POST   /rhp/registry/read":   srv.scoped(auth.ScopeContracts, srv.rhpRegistryReadHandler),
+		"POST   /rhp/registry/update": srv.scoped(auth.ScopeContracts, srv.rhpRegistryUpdateHandler),
+
+		"GET    /contracts":     srv.scoped(auth.ScopeContracts, srv.contractsHandler),
+		"GET    /contracts/:id": srv.scoped(auth.ScopeContracts, srv.contractsIDHandlerGET),
+		"PUT    /contracts/:id": srv.scoped(auth.ScopeContracts, srv.contractsIDHandlerPUT),
+		"DELETE /contracts/:id": srv.scoped(auth.ScopeContracts, srv.contractsIDHandlerDELETE),
+
+		"GET    /hostsets":                 srv.scoped(auth.ScopeContracts, srv.hostsetsHandler),
+		"GET    /hostsets/:name":           srv.scoped(auth.ScopeContracts, srv.hostsetsNameHandlerGET),
+		"PUT    /hostsets/:name":           srv.scoped(auth.ScopeContracts, srv.hostsetsNameHandlerPUT),
+		"GET    /hostsets/:name/contracts": srv.scoped(auth.ScopeContracts, srv.hostsetsContractsHandler),
+		"GET    /hostsets/:name/resolve":   srv.scoped(auth.ScopeContracts, srv.hostsetsResolveHandler),
+
+		"POST   /slabs/upload":   srv.unbucketed(auth.ScopeObjectsWrite, srv.slabsUploadHandler),
+		"POST   /slabs/download": srv.unbucketed(auth.ScopeObjectsRead, srv.slabsDownloadHandler),
+		"POST   /slabs/migrate":  srv.scoped(auth.ScopeContracts, srv.slabsMigrateHandler),
+		"POST   /slabs/delete":   srv.scoped(auth.ScopeContracts, srv.slabsDeleteHandler),
+		"GET    /slabs/gc":       srv.scoped(auth.ScopeContracts, srv.slabsGCHandlerGET),
+		"POST   /slabs/gc":       srv.scoped(auth.ScopeContracts, srv.slabsGCHandlerPOST),
+
+		"GET    /backup":         srv.scoped(auth.ScopeAdmin, srv.backupHandlerGET),
+		"POST   /backup/restore": srv.scoped(auth.ScopeAdmin, srv.backupRestoreHandler),
+
+		"GET    /buckets":       srv.scoped(auth.ScopeObjectsRead, srv.bucketsHandler),
+		"GET    /buckets/:name": srv.scoped(auth.ScopeObjectsRead, srv.bucketsNameHandlerGET),
+		"PUT    /buckets/:name": srv.scoped(auth.ScopeAdmin, srv.bucketsNameHandlerPUT),
+		"DELETE /buckets/:name": srv.scoped(auth.ScopeAdmin, srv.bucketsNameHandlerDELETE),
+
+		"GET    /objects/*key": srv.scoped(auth.ScopeObjectsRead, srv.objectsKeyHandlerGET),
+		"PUT    /objects/*key": srv.scoped(auth.ScopeObjectsWrite, srv.objectsKeyHandlerPUT),
+		"DELETE /objects/*key": srv.scoped(auth.ScopeObjectsWrite, srv.objectsKeyHandlerDELETE),
+
+		"GET    /versioning":         srv.scoped(auth.ScopeObjectsRead, srv.versioningHandler),
+		"PUT    /versioning/*prefix": srv.scoped(auth.ScopeAdmin, srv.versioningPrefixHandlerPUT),
+		"POST   /versioning/prune":   srv.scoped(auth.ScopeAdmin, srv.versioningPruneHandler),
+
+		"GET    /events": srv.scoped(auth.ScopeAdmin, srv.eventsHandler),
+
+		"GET    /webhooks":          srv.scoped(auth.ScopeAdmin, srv.webhooksHandlerGET),
+		"POST   /webhooks":          srv.scoped(auth.ScopeAdmin, srv.webhooksHandlerPOST),
+		"DELETE /webhooks/:id":      srv.scoped(auth.ScopeAdmin, srv.webhooksIDHandlerDELETE),
+		"POST   /webhooks/:id/test": srv.scoped(auth.ScopeAdmin, srv.webhooksIDTestHandler),
+
+		"GET    /deadletters":           srv.scoped(auth.ScopeAdmin, srv.deadLettersHandler),
+		"POST   /deadletters/:id/retry": srv.scoped(auth.ScopeAdmin, srv.deadLettersIDRetryHandler),
+		"DELETE /deadletters/:id":       srv.scoped(auth.ScopeAdmin, srv.deadLettersIDHandlerDELETE),
+
+		"GET    /metrics": srv.scoped(auth.ScopeAdmin, srv.metricsHandler),
+
+		"GET    /auth/keys":     srv.scoped(auth.ScopeAdmin, srv.authKeysHandlerGET),
+		"POST   /auth/keys":     srv.scoped(auth.ScopeAdmin, srv.authKeysHandlerPOST),
+		"DELETE /auth/keys/:id": srv.scoped(auth.ScopeAdmin, srv.authKeysIDHandlerDELETE),
+	}))
 }
 
 // NewStatelessServer returns an HTTP handler that serves the stateless renterd API.
 func NewStatelessServer(rhp RHP, sm SlabMover) http.Handler {
-	srv := server{
+	srv := &server{
 		rhp: rhp,
 		sm:  sm,
+
+		offline: make(map[PublicKey]bool),
 	}
 
-	return jape.Mux(map[string]jape.Handler{
+	return jape.Mux(instrument(map[string]jape.Handler{
 		"POST   /rhp/prepare/form":    srv.rhpPrepareFormHandler,
 		"POST   /rhp/prepare/renew":   srv.rhpPrepareRenewHandler,
 		"POST   /rhp/prepare/payment": srv.rhpPreparePaymentHandler,
@@ -705,5 +1599,7 @@ func NewStatelessServer(rhp RHP, sm SlabMover) http.Handler {
 		"POST   /slabs/download": srv.slabsDownloadHandler,
 		"POST   /slabs/migrate":  srv.slabsMigrateHandler,
 		"POST   /slabs/delete":   srv.slabsDeleteHandler,
-	})
+
+		"GET    /metrics": srv.metricsHandler,
+	}))
 }
@@ -0,0 +1,184 @@
+// Package auth implements scoped API keys.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+// Scopes grant access to groups of API routes.
+const (
+	ScopeWallet       = "wallet"
+	ScopeContracts    = "contracts"
+	ScopeHosts        = "hosts"
+	ScopeObjectsRead  = "objects:read"
+	ScopeObjectsWrite = "objects:write"
+	// ScopeAdmin grants access to every route.
+	ScopeAdmin = "admin"
+	// ScopeAny is granted by every key. It guards routes that reveal nothing
+	// sensitive, such as the chain tip.
+	ScopeAny = "any"
+)
+
+// Scopes lists every scope that can be granted to a key.
+var Scopes = []string{
+	ScopeWallet,
+	ScopeContracts,
+	ScopeHosts,
+	ScopeObjectsRead,
+	ScopeObjectsWrite,
+	ScopeAdmin,
+}
+
+// KnownScope returns true if scope is one of the scopes.
+func KnownScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// A Key is an API key. Its secret is only revealed when the key is created;
+// the node stores a hash of it.
+type Key struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Bucket, if set, limits the objects that ScopeObjectsRead and
+	// ScopeObjectsWrite allow the key to access to those in the bucket.
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix, if set, limits the objects that ScopeObjectsWrite allows the key
+	// to modify to those whose keys begin with it.
+	Prefix  string    `json:"prefix,omitempty"`
+	Created time.Time `json:"created"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// Allows returns true if the key grants scope. For the object scopes, bucket is
+// the bucket that the route accesses, or empty if the route does not access a
+// particular bucket; for ScopeObjectsWrite, objectKey is the key of the object
+// being modified, or empty if the route does not modify a particular object.
+func (k Key) Allows(scope, bucket, objectKey string) bool {
+	if scope == ScopeAny {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == ScopeAdmin {
+			return true
+		} else if s != scope {
+			continue
+		} else if scope != ScopeObjectsRead && scope != ScopeObjectsWrite {
+			return true
+		} else if k.Bucket != "" && bucket != "" && bucket != k.Bucket {
+			return false
+		}
+		return scope != ScopeObjectsWrite || objectKey == "" || strings.HasPrefix(objectKey, k.Prefix)
+	}
+	return false
+}
+
+// A Store stores API keys.
+type Store interface {
+	Keys() ([]Key, error)
+	AddKey(k Key) error
+	RemoveKey(id string) error
+}
+
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// A Manager creates API keys and authenticates requests that use them.
+type Manager struct {
+	store    Store
+	password string
+}
+
+// Keys returns the API keys, without their hashes.
+func (m *Manager) Keys() ([]Key, error) {
+	keys, err := m.store.Keys()
+	for i := range keys {
+		keys[i].Hash = ""
+	}
+	return keys, err
+}
+
+// Create creates an API key with the specified scopes, returning the key and
+// its secret. Object keys begin with a slash, which is added to prefix if it
+// is missing. A prefix applies to a single bucket, which is the default bucket
+// if bucket is empty.
+func (m *Manager) Create(name string, scopes []string, bucket, prefix string) (Key, string, error) {
+	if len(scopes) == 0 {
+		return Key{}, "", errors.New("at least one scope is required")
+	}
+	for _, s := range scopes {
+		if !KnownScope(s) {
+			return Key{}, "", fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	if prefix != "" && bucket == "" {
+		bucket = object.DefaultBucket
+	}
+	secret := hex.EncodeToString(frand.Bytes(32))
+	k := Key{
+		ID:      hex.EncodeToString(frand.Bytes(8)),
+		Name:    name,
+		Scopes:  scopes,
+		Bucket:  bucket,
+		Prefix:  prefix,
+		Created: time.Now(),
+		Hash:    hashSecret(secret),
+	}
+	if err := m.store.AddKey(k); err != nil {
+		return Key{}, "", err
+	}
+	k.Hash = ""
+	return k, secret, nil
+}
+
+// Delete revokes the API key with the specified ID.
+func (m *Manager) Delete(id string) error {
+	return m.store.RemoveKey(id)
+}
+
+// Authenticate returns the API key with the specified secret. The manager's
+// password is accepted as a key with ScopeAdmin.
+func (m *Manager) Authenticate(secret string) (Key, bool) {
+	if m.password != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(m.password)) == 1 {
+		return Key{Name: "password", Scopes: []string{ScopeAdmin}}, true
+	}
+	keys, err := m.store.Keys()
+	if err != nil {
+		return Key{}, false
+	}
+	hash := hashSecret(secret)
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash)) == 1 {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// NewManager returns a manager for the API keys in store. If password is not
+// empty, it is accepted as a key with ScopeAdmin.
+func NewManager(store Store, password string) *Manager {
+	return &Manager{
+		store:    store,
+		password: password,
+	}
+}
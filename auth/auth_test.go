@@ -0,0 +1,55 @@
+package auth_test
+
+import (
+	"testing"
+
+	"go.sia.tech/renterd/auth"
+	"go.sia.tech/renterd/internal/stores"
+	"go.sia.tech/renterd/object"
+)
+
+func TestManager(t *testing.T) {
+	m := auth.NewManager(stores.NewEphemeralAuthStore(), "password")
+	if _, _, err := m.Create("bad", []string{"everything"}, "", ""); err == nil {
+		t.Fatal("expected unknown scope to be rejected")
+	}
+	k, secret, err := m.Create("uploader", []string{auth.ScopeObjectsRead, auth.ScopeObjectsWrite}, "", "uploads/")
+	if err != nil {
+		t.Fatal(err)
+	} else if k.Prefix != "/uploads/" || k.Bucket != object.DefaultBucket || k.Hash != "" {
+		t.Fatalf("unexpected key: %+v", k)
+	}
+
+	if _, ok := m.Authenticate("wrong"); ok {
+		t.Fatal("authenticated with an invalid secret")
+	} else if admin, ok := m.Authenticate("password"); !ok || !admin.Allows(auth.ScopeWallet, "", "") {
+		t.Fatal("password should grant every scope")
+	}
+	ak, ok := m.Authenticate(secret)
+	if !ok || ak.ID != k.ID {
+		t.Fatal("could not authenticate with key")
+	}
+	for _, test := range []struct {
+		scope, bucket, key string
+		allowed            bool
+	}{
+		{auth.ScopeObjectsRead, "default", "/private/foo", true},
+		{auth.ScopeObjectsRead, "photos", "/private/foo", false},
+		{auth.ScopeObjectsWrite, "default", "/uploads/foo", true},
+		{auth.ScopeObjectsWrite, "photos", "/uploads/foo", false},
+		{auth.ScopeObjectsWrite, "default", "/private/foo", false},
+		{auth.ScopeObjectsWrite, "", "", true},
+		{auth.ScopeWallet, "", "", false},
+		{auth.ScopeAdmin, "", "", false},
+	} {
+		if ak.Allows(test.scope, test.bucket, test.key) != test.allowed {
+			t.Errorf("Allows(%q, %q, %q) should be %v", test.scope, test.bucket, test.key, test.allowed)
+		}
+	}
+
+	if err := m.Delete(k.ID); err != nil {
+		t.Fatal(err)
+	} else if _, ok := m.Authenticate(secret); ok {
+		t.Fatal("authenticated with a deleted key")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"go.sia.tech/renterd/api"
+)
+
+const backupUsage = `Usage:
+    renterd backup create <file>
+    renterd backup restore <file>
+
+Creates or restores an encrypted backup of the objects, contracts, host sets,
+and hostdb of the renterd node listening on -http. Backups are encrypted with a
+key derived from the node's wallet seed, so they can only be restored by a node
+using the same seed. A backup can only be restored into a node without any
+objects or contracts.
+`
+
+func backupCmd(apiAddr string, args []string) {
+	if len(args) != 2 {
+		fmt.Print(backupUsage)
+		os.Exit(2)
+	}
+	c := api.NewClient("http://"+apiAddr+"/api", getAPIPassword())
+	switch cmd, path := args[0], args[1]; cmd {
+	case "create":
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		check("Could not create backup file", err)
+		if err := c.Backup(f); err != nil {
+			f.Close()
+			os.Remove(path)
+			log.Fatalln("Could not create backup:", err)
+		}
+		check("Could not sync backup file", f.Sync())
+		check("Could not close backup file", f.Close())
+		log.Println("Wrote backup to", path)
+	case "restore":
+		f, err := os.Open(path)
+		check("Could not open backup file", err)
+		defer f.Close()
+		check("Could not restore backup", c.RestoreBackup(f))
+		log.Println("Restored backup from", path)
+	default:
+		fmt.Print(backupUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/object"
+	"go.sia.tech/renterd/wallet"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the configuration file loaded from the working
+// directory when none is specified.
+const defaultConfigFile = "renterd.yml"
+
+type httpConfig struct {
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+}
+
+type gatewayConfig struct {
+	Address   string `yaml:"address"`
+	Bootstrap bool   `yaml:"bootstrap"`
+}
+
+type webdavConfig struct {
+	Address   string `yaml:"address"`
+	Bucket    string `yaml:"bucket"`
+	Contracts string `yaml:"contracts"`
+}
+
+type walletConfig struct {
+	Seed                string        `yaml:"seed"`
+	WatchOnly           string        `yaml:"watchOnly"`
+	CoinSelection       string        `yaml:"coinSelection"`
+	MinFee              string        `yaml:"minFee"`
+	MaxFee              string        `yaml:"maxFee"`
+	DefragThreshold     int           `yaml:"defragThreshold"`
+	DefragInterval      time.Duration `yaml:"defragInterval"`
+	RebroadcastInterval time.Duration `yaml:"rebroadcastInterval"`
+}
+
+type gougingConfig struct {
+	MaxContractPrice string `yaml:"maxContractPrice"`
+	MaxStoragePrice  string `yaml:"maxStoragePrice"`
+	MaxUploadPrice   string `yaml:"maxUploadPrice"`
+	MaxDownloadPrice string `yaml:"maxDownloadPrice"`
+}
+
+type autopilotConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Allowance   string        `yaml:"allowance"`
+	Hosts       int           `yaml:"hosts"`
+	Period      uint64        `yaml:"period"`
+	RenewWindow uint64        `yaml:"renewWindow"`
+	Gouging     gougingConfig `yaml:"gouging"`
+}
+
+type loggingConfig struct {
+	File       string `yaml:"file"`
+	Timestamps bool   `yaml:"timestamps"`
+}
+
+type storesConfig struct {
+	Wallet    string `yaml:"wallet"`
+	HostDB    string `yaml:"hostdb"`
+	Contracts string `yaml:"contracts"`
+	Objects   string `yaml:"objects"`
+	Webhooks  string `yaml:"webhooks"`
+	Auth      string `yaml:"auth"`
+}
+
+// A config holds every setting of renterd. Settings are read from a YAML
+// file, then from RENTERD_* environment variables, then from flags, each
+// overriding the last.
+type config struct {
+	Directory string          `yaml:"directory"`
+	Stateless bool            `yaml:"stateless"`
+	HTTP      httpConfig      `yaml:"http"`
+	Gateway   gatewayConfig   `yaml:"gateway"`
+	WebDAV    webdavConfig    `yaml:"webdav"`
+	Wallet    walletConfig    `yaml:"wallet"`
+	Autopilot autopilotConfig `yaml:"autopilot"`
+	Logging   loggingConfig   `yaml:"logging"`
+	Stores    storesConfig    `yaml:"stores"`
+}
+
+func defaultConfig() config {
+	return config{
+		Directory: ".",
+		HTTP: httpConfig{
+			Address: "localhost:9980",
+		},
+		Gateway: gatewayConfig{
+			Address:   ":0",
+			Bootstrap: true,
+		},
+		WebDAV: webdavConfig{
+			Bucket: object.DefaultBucket,
+		},
+		Wallet: walletConfig{
+			CoinSelection:       wallet.CoinSelectionRandom.String(),
+			DefragThreshold:     wallet.DefaultDefragThreshold,
+			DefragInterval:      10 * time.Minute,
+			RebroadcastInterval: 10 * time.Minute,
+		},
+		Autopilot: autopilotConfig{
+			Hosts:       50,
+			Period:      6 * 144 * 7,
+			RenewWindow: 2 * 144 * 7,
+		},
+	}
+}
+
+// cfg is the configuration of this process.
+var cfg = defaultConfig()
+
+// storeDir returns the directory of the named store: its configured directory,
+// if any, or a subdirectory of the node's directory.
+func (c *config) storeDir(configured, name string) string {
+	if configured != "" {
+		return configured
+	}
+	return filepath.Join(c.Directory, name)
+}
+
+// loadFile reads settings from the YAML file at path. If path is empty, the
+// default file is read, if it exists. Unknown settings are rejected, so that
+// typos are not silently ignored.
+func (c *config) loadFile(path string) error {
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return nil
+		}
+		path = defaultConfigFile
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	if c.HTTP.Password != "" || c.Wallet.Seed != "" {
+		if fi, err := f.Stat(); err == nil && fi.Mode().Perm()&0077 != 0 {
+			log.Printf("WARN: %v contains secrets but is accessible to other users", path)
+		}
+	}
+	return nil
+}
+
+// envAliases maps environment variables that predate the configuration file
+// to their settings.
+var envAliases = map[string]string{
+	"RENTERD_API_PASSWORD": "RENTERD_HTTP_PASSWORD",
+}
+
+// loadEnv reads settings from the environment. Each setting is read from a
+// variable named after its path in the YAML file, e.g. wallet.minFee is read
+// from RENTERD_WALLET_MINFEE.
+func (c *config) loadEnv() error {
+	for alias, name := range envAliases {
+		if v, ok := os.LookupEnv(alias); ok {
+			if _, ok := os.LookupEnv(name); !ok {
+				os.Setenv(name, v)
+			}
+		}
+	}
+	return loadEnv(reflect.ValueOf(c).Elem(), "RENTERD")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func loadEnv(v reflect.Value, prefix string) error {
+	for i := 0; i < v.NumField(); i++ {
+		name := prefix + "_" + strings.ToUpper(v.Type().Field(i).Tag.Get("yaml"))
+		f := v.Field(i)
+		if f.Kind() == reflect.Struct {
+			if err := loadEnv(f, name); err != nil {
+				return err
+			}
+			continue
+		}
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		var err error
+		switch {
+		case f.Type() == durationType:
+			var d time.Duration
+			d, err = time.ParseDuration(s)
+			f.SetInt(int64(d))
+		case f.Kind() == reflect.String:
+			f.SetString(s)
+		case f.Kind() == reflect.Bool:
+			var b bool
+			b, err = strconv.ParseBool(s)
+			f.SetBool(b)
+		case f.Kind() == reflect.Int:
+			var n int64
+			n, err = strconv.ParseInt(s, 10, 0)
+			f.SetInt(n)
+		case f.Kind() == reflect.Uint64:
+			var n uint64
+			n, err = strconv.ParseUint(s, 10, 64)
+			f.SetUint(n)
+		default:
+			panic(fmt.Sprintf("unhandled setting type %v", f.Type())) // developer error
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks every setting, returning an error that describes each
+// invalid one.
+func (c *config) validate() error {
+	var errs []string
+	fail := func(setting string, err error) {
+		errs = append(errs, fmt.Sprintf("%v: %v", setting, err))
+	}
+	checkAddr := func(setting, addr string) {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			fail(setting, err)
+		}
+	}
+	checkCurrency := func(setting, s string) {
+		if s != "" {
+			if _, err := parseCurrency(s); err != nil {
+				fail(setting, fmt.Errorf("invalid amount %q", s))
+			}
+		}
+	}
+
+	if c.Directory == "" {
+		fail("directory", errors.New("must not be empty"))
+	}
+	checkAddr("http.address", c.HTTP.Address)
+	checkAddr("gateway.address", c.Gateway.Address)
+	if c.WebDAV.Address != "" {
+		checkAddr("webdav.address", c.WebDAV.Address)
+		if c.WebDAV.Bucket == "" {
+			fail("webdav.bucket", errors.New("must not be empty"))
+		}
+	}
+
+	if c.Wallet.Seed != "" {
+		if _, err := wallet.SeedFromPhrase(c.Wallet.Seed); err != nil {
+			fail("wallet.seed", err)
+		}
+	}
+	if c.Wallet.WatchOnly != "" {
+		var pk consensus.PublicKey
+		if err := pk.UnmarshalText([]byte(c.Wallet.WatchOnly)); err != nil {
+			fail("wallet.watchOnly", err)
+		}
+	}
+	if _, err := wallet.ParseCoinSelection(c.Wallet.CoinSelection); err != nil {
+		fail("wallet.coinSelection", err)
+	}
+	checkCurrency("wallet.minFee", c.Wallet.MinFee)
+	checkCurrency("wallet.maxFee", c.Wallet.MaxFee)
+	if c.Wallet.MinFee != "" && c.Wallet.MaxFee != "" {
+		min, err1 := parseCurrency(c.Wallet.MinFee)
+		max, err2 := parseCurrency(c.Wallet.MaxFee)
+		if err1 == nil && err2 == nil && min.Cmp(max) > 0 {
+			fail("wallet.maxFee", errors.New("must not be less than wallet.minFee"))
+		}
+	}
+	if c.Wallet.DefragThreshold < 0 {
+		fail("wallet.defragThreshold", errors.New("must not be negative"))
+	}
+	if c.Wallet.DefragInterval <= 0 {
+		fail("wallet.defragInterval", errors.New("must be positive"))
+	}
+	if c.Wallet.RebroadcastInterval <= 0 {
+		fail("wallet.rebroadcastInterval", errors.New("must be positive"))
+	}
+
+	if c.Autopilot.Enabled {
+		fail("autopilot.enabled", errors.New("the autopilot is not available in this version of renterd"))
+	}
+	checkCurrency("autopilot.allowance", c.Autopilot.Allowance)
+	if c.Autopilot.Hosts < 0 {
+		fail("autopilot.hosts", errors.New("must not be negative"))
+	}
+	if c.Autopilot.RenewWindow > c.Autopilot.Period {
+		fail("autopilot.renewWindow", errors.New("must not exceed autopilot.period"))
+	}
+	checkCurrency("autopilot.gouging.maxContractPrice", c.Autopilot.Gouging.MaxContractPrice)
+	checkCurrency("autopilot.gouging.maxStoragePrice", c.Autopilot.Gouging.MaxStoragePrice)
+	checkCurrency("autopilot.gouging.maxUploadPrice", c.Autopilot.Gouging.MaxUploadPrice)
+	checkCurrency("autopilot.gouging.maxDownloadPrice", c.Autopilot.Gouging.MaxDownloadPrice)
+
+	if len(errs) > 0 {
+		return errors.New("\n  " + strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+const configTemplate = `# renterd configuration
+#
+# Every setting can be overridden by an environment variable named after its
+# path, e.g. RENTERD_WALLET_MINFEE for wallet.minFee, and most can be
+# overridden by a flag; see renterd -help.
+
+# directory holds the node's state.
+directory: .
+
+# stateless runs only the renter-host protocol and slab APIs, without a wallet,
+# chain, or stores.
+stateless: false
+
+http:
+  # address is where the API and UI are served.
+  address: localhost:9980
+  # password grants full access to the API; scoped API keys can be created at
+  # /api/auth/keys. If empty, it is read from the terminal. Prefer
+  # RENTERD_HTTP_PASSWORD to storing it here.
+  password: ""
+
+gateway:
+  # address is where the node listens for peer connections.
+  address: ":0"
+  # bootstrap connects to the default peers on startup.
+  bootstrap: true
+
+webdav:
+  # address is where objects are served over WebDAV; disabled if empty.
+  address: ""
+  # bucket is the bucket served over WebDAV.
+  bucket: default
+  # contracts is a file containing the contracts, with renter keys, used to
+  # transfer WebDAV data.
+  contracts: ""
+
+wallet:
+  # seed is the wallet's seed phrase. If empty, it is read from the terminal.
+  # Prefer RENTERD_WALLET_SEED to storing it here.
+  seed: ""
+  # watchOnly is the public key of a watch-only wallet; if set, no seed is
+  # required.
+  watchOnly: ""
+  # coinSelection is the strategy used to select outputs: random or largest.
+  coinSelection: random
+  # minFee and maxFee bound the fee per byte paid by wallet transactions,
+  # e.g. 10nS. maxFee is unlimited if empty.
+  minFee: ""
+  maxFee: ""
+  # defragThreshold is the number of spendable outputs above which the wallet
+  # is defragmented every defragInterval; 0 disables defragmentation.
+  defragThreshold: 100
+  defragInterval: 10m
+  # rebroadcastInterval is how often unconfirmed transactions are rebroadcast.
+  rebroadcastInterval: 10m
+
+# autopilot will form and renew contracts automatically. It is not yet
+# available, so enabled must be false.
+autopilot:
+  enabled: false
+  # allowance is the amount spent on contracts each period.
+  allowance: ""
+  # hosts is the number of hosts to form contracts with.
+  hosts: 50
+  # period and renewWindow are measured in blocks.
+  period: 6048
+  renewWindow: 2016
+  # gouging limits the prices paid to hosts; unlimited if empty.
+  gouging:
+    maxContractPrice: ""
+    maxStoragePrice: ""
+    maxUploadPrice: ""
+    maxDownloadPrice: ""
+
+logging:
+  # file receives a copy of the log; disabled if empty.
+  file: ""
+  # timestamps prefixes each log line with the date and time.
+  timestamps: false
+
+# stores override the directories of individual stores, which default to
+# subdirectories of directory.
+stores:
+  wallet: ""
+  hostdb: ""
+  contracts: ""
+  objects: ""
+  webhooks: ""
+  auth: ""
+`
+
+const configUsage = `Usage:
+    renterd config init [file]
+
+init writes a configuration file documenting every setting, with its default
+value, to file (default renterd.yml). It does not overwrite existing files.
+`
+
+func configCmd(args []string) {
+	if len(args) < 1 || len(args) > 2 || args[0] != "init" {
+		fmt.Print(configUsage)
+		os.Exit(2)
+	}
+	path := defaultConfigFile
+	if len(args) == 2 {
+		path = args[1]
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	check("Could not create config file", err)
+	_, err = f.Write([]byte(configTemplate))
+	check("Could not write config file", err)
+	check("Could not close config file", f.Close())
+	log.Println("Wrote configuration to", path)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "renterd.yml")
+	if err := os.WriteFile(path, []byte(configTemplate), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var c config
+	if err := c.loadFile(path); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(c, defaultConfig()) {
+		t.Fatalf("template does not match the default config:\n%+v\n%+v", c, defaultConfig())
+	} else if err := c.validate(); err != nil {
+		t.Fatal("default config is invalid:", err)
+	}
+}
+
+func TestConfigLoadFile(t *testing.T) {
+	tests := []struct {
+		desc string
+		yaml string
+		err  string
+		fn   func(*config)
+	}{
+		{
+			desc: "empty file",
+			yaml: "",
+			fn:   func(*config) {},
+		},
+		{
+			desc: "nested settings",
+			yaml: "http:\n  address: :1234\nwallet:\n  minFee: 10nS\n  defragInterval: 1h\n",
+			fn: func(c *config) {
+				c.HTTP.Address = ":1234"
+				c.Wallet.MinFee = "10nS"
+				c.Wallet.DefragInterval = time.Hour
+			},
+		},
+		{
+			desc: "unknown top-level setting",
+			yaml: "directroy: /tmp\n",
+			err:  "field directroy not found",
+		},
+		{
+			desc: "unknown nested setting",
+			yaml: "wallet:\n  minfee: 10nS\n",
+			err:  "field minfee not found",
+		},
+		{
+			desc: "wrong type",
+			yaml: "autopilot:\n  hosts: lots\n",
+			err:  "cannot unmarshal",
+		},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "renterd.yml")
+		if err := os.WriteFile(path, []byte(test.yaml), 0600); err != nil {
+			t.Fatal(err)
+		}
+		c := defaultConfig()
+		err := c.loadFile(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) || !strings.Contains(err.Error(), path) {
+				t.Errorf("%v: expected error containing %q and the file name, got %v", test.desc, test.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%v: %v", test.desc, err)
+			continue
+		}
+		exp := defaultConfig()
+		test.fn(&exp)
+		if !reflect.DeepEqual(c, exp) {
+			t.Errorf("%v: expected %+v, got %+v", test.desc, exp, c)
+		}
+	}
+
+	c := defaultConfig()
+	if err := c.loadFile(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("expected missing file to be rejected")
+	}
+}
+
+func TestConfigLoadEnv(t *testing.T) {
+	tests := []struct {
+		desc string
+		env  map[string]string
+		err  string
+		fn   func(*config)
+	}{
+		{
+			desc: "no variables",
+			fn:   func(*config) {},
+		},
+		{
+			desc: "each kind of setting",
+			env: map[string]string{
+				"RENTERD_DIRECTORY":                        "/var/lib/renterd",
+				"RENTERD_GATEWAY_BOOTSTRAP":                "false",
+				"RENTERD_WALLET_DEFRAGTHRESHOLD":           "5",
+				"RENTERD_WALLET_REBROADCASTINTERVAL":       "30s",
+				"RENTERD_AUTOPILOT_PERIOD":                 "100",
+				"RENTERD_AUTOPILOT_GOUGING_MAXUPLOADPRICE": "1SC",
+			},
+			fn: func(c *config) {
+				c.Directory = "/var/lib/renterd"
+				c.Gateway.Bootstrap = false
+				c.Wallet.DefragThreshold = 5
+				c.Wallet.RebroadcastInterval = 30 * time.Second
+				c.Autopilot.Period = 100
+				c.Autopilot.Gouging.MaxUploadPrice = "1SC"
+			},
+		},
+		{
+			desc: "alias",
+			env:  map[string]string{"RENTERD_API_PASSWORD": "foo"},
+			fn:   func(c *config) { c.HTTP.Password = "foo" },
+		},
+		{
+			desc: "alias and setting",
+			env:  map[string]string{"RENTERD_API_PASSWORD": "foo", "RENTERD_HTTP_PASSWORD": "bar"},
+			fn:   func(c *config) { c.HTTP.Password = "bar" },
+		},
+		{
+			desc: "invalid bool",
+			env:  map[string]string{"RENTERD_STATELESS": "maybe"},
+			err:  "RENTERD_STATELESS: ",
+		},
+		{
+			desc: "invalid duration",
+			env:  map[string]string{"RENTERD_WALLET_DEFRAGINTERVAL": "10"},
+			err:  "RENTERD_WALLET_DEFRAGINTERVAL: ",
+		},
+		{
+			desc: "invalid number",
+			env:  map[string]string{"RENTERD_AUTOPILOT_RENEWWINDOW": "-1"},
+			err:  "RENTERD_AUTOPILOT_RENEWWINDOW: ",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			// loadEnv sets the variables that aliases refer to, so make sure
+			// they are restored afterwards
+			for _, name := range envAliases {
+				t.Setenv(name, "")
+				os.Unsetenv(name)
+			}
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			c := defaultConfig()
+			err := c.loadEnv()
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Fatalf("expected error with prefix %q, got %v", test.err, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			exp := defaultConfig()
+			test.fn(&exp)
+			if !reflect.DeepEqual(c, exp) {
+				t.Fatalf("expected %+v, got %+v", exp, c)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		desc string
+		fn   func(*config)
+		errs []string
+	}{
+		{
+			desc: "defaults",
+			fn:   func(*config) {},
+		},
+		{
+			desc: "empty directory",
+			fn:   func(c *config) { c.Directory = "" },
+			errs: []string{"directory: must not be empty"},
+		},
+		{
+			desc: "bad addresses",
+			fn: func(c *config) {
+				c.HTTP.Address = "localhost"
+				c.WebDAV.Address = "localhost:8080"
+				c.WebDAV.Bucket = ""
+			},
+			errs: []string{"http.address: ", "webdav.bucket: must not be empty"},
+		},
+		{
+			desc: "bad wallet settings",
+			fn: func(c *config) {
+				c.Wallet.Seed = "not a seed"
+				c.Wallet.WatchOnly = "not a key"
+				c.Wallet.CoinSelection = "smallest"
+				c.Wallet.DefragThreshold = -1
+				c.Wallet.DefragInterval = 0
+				c.Wallet.RebroadcastInterval = -time.Second
+			},
+			errs: []string{
+				"wallet.seed: ",
+				"wallet.watchOnly: ",
+				"wallet.coinSelection: ",
+				"wallet.defragThreshold: must not be negative",
+				"wallet.defragInterval: must be positive",
+				"wallet.rebroadcastInterval: must be positive",
+			},
+		},
+		{
+			desc: "bad fees",
+			fn: func(c *config) {
+				c.Wallet.MinFee = "10nS"
+				c.Wallet.MaxFee = "1nS"
+				c.Autopilot.Gouging.MaxStoragePrice = "cheap"
+			},
+			errs: []string{
+				"wallet.maxFee: must not be less than wallet.minFee",
+				`autopilot.gouging.maxStoragePrice: invalid amount "cheap"`,
+			},
+		},
+		{
+			desc: "bad autopilot settings",
+			fn: func(c *config) {
+				c.Autopilot.Enabled = true
+				c.Autopilot.Hosts = -1
+				c.Autopilot.RenewWindow = c.Autopilot.Period + 1
+			},
+			errs: []string{
+				"autopilot.enabled: the autopilot is not available",
+				"autopilot.hosts: must not be negative",
+				"autopilot.renewWindow: must not exceed autopilot.period",
+			},
+		},
+	}
+	for _, test := range tests {
+		c := defaultConfig()
+		test.fn(&c)
+		err := c.validate()
+		if len(test.errs) == 0 {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", test.desc, err)
+			}
+			continue
+		} else if err == nil {
+			t.Errorf("%v: expected errors, got nil", test.desc)
+			continue
+		}
+		// each invalid setting is reported on its own line
+		lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+		if len(lines) != len(test.errs) {
+			t.Errorf("%v: expected %v errors, got %q", test.desc, len(test.errs), err)
+			continue
+		}
+		for i, line := range lines {
+			if !strings.HasPrefix(strings.TrimSpace(line), test.errs[i]) {
+				t.Errorf("%v: expected error %v to start with %q, got %q", test.desc, i, test.errs[i], line)
+			}
+		}
+	}
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
 
+	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/renterd/wallet"
 	"golang.org/x/term"
@@ -25,47 +27,68 @@ func check(context string, err error) {
 	}
 }
 
+// getAPIPassword returns the configured API password, prompting for it if
+// none is configured.
 func getAPIPassword() string {
-	apiPassword := os.Getenv("RENTERD_API_PASSWORD")
-	if apiPassword != "" {
-		fmt.Println("Using RENTERD_API_PASSWORD environment variable.")
-	} else {
-		fmt.Print("Enter API password: ")
-		pw, err := term.ReadPassword(int(os.Stdin.Fd()))
-		fmt.Println()
-		if err != nil {
-			log.Fatal(err)
-		}
-		apiPassword = string(pw)
+	if cfg.HTTP.Password != "" {
+		return cfg.HTTP.Password
 	}
-	return apiPassword
+	fmt.Print("Enter API password: ")
+	pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(pw)
 }
 
-func getWalletKey() consensus.PrivateKey {
-	phrase := os.Getenv("RENTERD_WALLET_SEED")
-	if phrase != "" {
-		fmt.Println("Using RENTERD_WALLET_SEED environment variable")
-	} else {
+// getWalletSeed returns the configured wallet seed, prompting for it if none
+// is configured.
+func getWalletSeed() wallet.Seed {
+	phrase := cfg.Wallet.Seed
+	if phrase == "" {
 		fmt.Print("Enter wallet seed: ")
 		pw, err := term.ReadPassword(int(os.Stdin.Fd()))
 		check("Could not read seed phrase:", err)
 		fmt.Println()
 		phrase = string(pw)
 	}
-	key, err := wallet.KeyFromPhrase(phrase)
+	seed, err := wallet.SeedFromPhrase(phrase)
 	if err != nil {
 		log.Fatal(err)
 	}
-	return key
+	return seed
+}
+
+// setupLogging applies the logging settings.
+func setupLogging() {
+	if cfg.Logging.Timestamps {
+		log.SetFlags(log.LstdFlags)
+	}
+	if cfg.Logging.File != "" {
+		f, err := os.OpenFile(cfg.Logging.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		check("Could not open log file", err)
+		log.SetOutput(io.MultiWriter(os.Stderr, f))
+	}
 }
 
 func main() {
 	log.SetFlags(0)
-	gatewayAddr := flag.String("addr", ":0", "address to listen on for peer connections")
-	apiAddr := flag.String("http", "localhost:9980", "address to serve API on")
-	dir := flag.String("dir", ".", "directory to store node state in")
-	stateless := flag.Bool("stateless", false, "run in stateless mode")
-	bootstrap := flag.Bool("bootstrap", true, "bootstrap the gateway and consensus modules")
+	configPath := flag.String("config", os.Getenv("RENTERD_CONFIG_FILE"), "YAML configuration file (default renterd.yml, if it exists)")
+	flag.StringVar(&cfg.Gateway.Address, "addr", cfg.Gateway.Address, "address to listen on for peer connections")
+	flag.StringVar(&cfg.HTTP.Address, "http", cfg.HTTP.Address, "address to serve API on")
+	flag.StringVar(&cfg.Directory, "dir", cfg.Directory, "directory to store node state in")
+	flag.BoolVar(&cfg.Stateless, "stateless", cfg.Stateless, "run in stateless mode")
+	flag.BoolVar(&cfg.Gateway.Bootstrap, "bootstrap", cfg.Gateway.Bootstrap, "bootstrap the gateway and consensus modules")
+	flag.StringVar(&cfg.WebDAV.Address, "webdav", cfg.WebDAV.Address, "address to serve objects over WebDAV on (disabled if empty)")
+	flag.StringVar(&cfg.WebDAV.Bucket, "webdav.bucket", cfg.WebDAV.Bucket, "bucket to serve over WebDAV")
+	flag.StringVar(&cfg.WebDAV.Contracts, "webdav.contracts", cfg.WebDAV.Contracts, "file containing the contracts, with renter keys, used to transfer WebDAV data")
+	flag.StringVar(&cfg.Wallet.CoinSelection, "wallet.coinselection", cfg.Wallet.CoinSelection, "strategy used to select wallet outputs (random or largest)")
+	flag.StringVar(&cfg.Wallet.MinFee, "wallet.minfee", cfg.Wallet.MinFee, "minimum fee per byte paid by wallet transactions, e.g. 10nS")
+	flag.StringVar(&cfg.Wallet.MaxFee, "wallet.maxfee", cfg.Wallet.MaxFee, "maximum fee per byte paid by wallet transactions (unlimited if empty)")
+	flag.StringVar(&cfg.Wallet.WatchOnly, "wallet.watchonly", cfg.Wallet.WatchOnly, "public key of a watch-only wallet (if set, the seed is not required)")
+	flag.IntVar(&cfg.Wallet.DefragThreshold, "wallet.defrag", cfg.Wallet.DefragThreshold, "number of spendable outputs above which the wallet is defragmented (disabled if 0)")
+	flag.StringVar(&cfg.Logging.File, "log.file", cfg.Logging.File, "file to copy the log to (disabled if empty)")
 	flag.Parse()
 
 	log.Println("renterd v0.1.0")
@@ -74,10 +97,40 @@ func main() {
 		log.Println("Build Date:", builddate)
 		return
 	}
+	if flag.Arg(0) == "config" {
+		configCmd(flag.Args()[1:])
+		return
+	}
+
+	// flags were parsed to find the config file; parse them again so that they
+	// override it and the environment
+	cfg = defaultConfig()
+	check("Could not load config", cfg.loadFile(*configPath))
+	check("Could not load config from environment", cfg.loadEnv())
+	flag.Parse()
+	check("Invalid config", cfg.validate())
+	setupLogging()
+
+	if flag.Arg(0) == "backup" {
+		backupCmd(cfg.HTTP.Address, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "objects" {
+		objectsCmd(cfg.HTTP.Address, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "wallet" {
+		walletCmd(cfg.HTTP.Address, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "siad" {
+		siadCmd(cfg.HTTP.Address, flag.Args()[1:])
+		return
+	}
 
-	if *stateless {
+	if cfg.Stateless {
 		apiPassword := getAPIPassword()
-		l, err := net.Listen("tcp", *apiAddr)
+		l, err := net.Listen("tcp", cfg.HTTP.Address)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -92,9 +145,26 @@ func main() {
 		return
 	}
 
+	// settings have already been validated
+	selection, _ := wallet.ParseCoinSelection(cfg.Wallet.CoinSelection)
+	var feePolicy wallet.FeePolicy
+	if cfg.Wallet.MinFee != "" {
+		feePolicy.MinFeePerByte, _ = parseCurrency(cfg.Wallet.MinFee)
+	}
+	if cfg.Wallet.MaxFee != "" {
+		feePolicy.MaxFeePerByte, _ = parseCurrency(cfg.Wallet.MaxFee)
+	}
 	apiPassword := getAPIPassword()
-	walletKey := getWalletKey()
-	n, err := newNode(*gatewayAddr, *dir, *bootstrap, walletKey)
+	var walletSeed *wallet.Seed
+	var watchOnlyKey consensus.PublicKey
+	if cfg.Wallet.WatchOnly != "" {
+		watchOnlyKey.UnmarshalText([]byte(cfg.Wallet.WatchOnly))
+		log.Println("wallet: Watching", wallet.StandardAddress(watchOnlyKey))
+	} else {
+		seed := getWalletSeed()
+		walletSeed = &seed
+	}
+	n, err := newNode(cfg, walletSeed, watchOnlyKey)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -104,8 +174,16 @@ func main() {
 		}
 	}()
 	log.Println("p2p: Listening on", n.g.Address())
+	n.w.SetCoinSelection(selection)
+	n.w.SetFeePolicy(feePolicy)
+	go n.rebroadcastPending(cfg.Wallet.RebroadcastInterval)
+	go n.sweepSlabs(slabSweepInterval)
+	go n.pruneVersions(versionPruneInterval)
+	if cfg.Wallet.DefragThreshold > 0 && !n.w.WatchOnly() {
+		go n.defragWallet(cfg.Wallet.DefragThreshold, cfg.Wallet.DefragInterval)
+	}
 
-	l, err := net.Listen("tcp", *apiAddr)
+	l, err := net.Listen("tcp", cfg.HTTP.Address)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -113,6 +191,21 @@ func main() {
 	log.Println("api: Listening on", l.Addr())
 	go startWeb(l, n, apiPassword)
 
+	if cfg.WebDAV.Address != "" {
+		var contracts []api.Contract
+		if cfg.WebDAV.Contracts != "" {
+			contracts, err = loadContracts(cfg.WebDAV.Contracts)
+			check("Could not load WebDAV contracts", err)
+		}
+		dl, err := net.Listen("tcp", cfg.WebDAV.Address)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer dl.Close()
+		log.Println("webdav: Listening on", dl.Addr())
+		go startWebDAV(dl, l.Addr().String(), apiPassword, cfg.WebDAV.Bucket, contracts)
+	}
+
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, os.Interrupt)
 	<-signalCh
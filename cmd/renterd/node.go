@@ -1,34 +1,218 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/events"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/renterd/internal/stores"
 	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/renterd/webhooks"
 	"go.sia.tech/siad/modules"
 	mconsensus "go.sia.tech/siad/modules/consensus"
 	"go.sia.tech/siad/modules/gateway"
 	"go.sia.tech/siad/modules/transactionpool"
+	"go.sia.tech/siad/types"
 )
 
 type node struct {
 	g   modules.Gateway
 	cm  modules.ConsensusSet
 	tp  modules.TransactionPool
-	w   *wallet.SingleAddressWallet
-	hdb *stores.JSONHostDB
-	cs  *stores.JSONContractStore
-	os  *stores.JSONObjectStore
+	w   *wallet.SeedWallet
+	ws  *stores.BoltWalletStore
+	hdb *stores.BoltHostDB
+	cs  *stores.BoltContractStore
+	os  *stores.BoltObjectStore
+	bm  api.BackupStore
+	eb  *events.Bus
+	whs *stores.BoltWebhookStore
+	wm  *webhooks.Manager
+	as  *stores.BoltAuthStore
+
+	stop chan struct{}
+}
+
+// contractExpiringBlocks is how many blocks before its proof window a
+// contract is reported as expiring.
+const contractExpiringBlocks = 144
+
+// chainEvents publishes the events caused by consensus changes. It must
+// subscribe after the wallet store, so that the wallet's pending transactions
+// reflect each change.
+type chainEvents struct {
+	eb *events.Bus
+	w  *wallet.SeedWallet
+	cs *stores.BoltContractStore
+}
+
+// ProcessConsensusChange implements modules.ConsensusSetSubscriber.
+func (ce chainEvents) ProcessConsensusChange(cc modules.ConsensusChange) {
+	// the height of the chain after the reverted blocks are removed
+	height := uint64(cc.InitialHeight())
+	if len(cc.RevertedBlocks) > 0 {
+		var reverted []consensus.ChainIndex
+		for i, b := range cc.RevertedBlocks {
+			reverted = append(reverted, consensus.ChainIndex{
+				Height: height + uint64(len(cc.RevertedBlocks)-i),
+				ID:     consensus.BlockID(b.ID()),
+			})
+		}
+		ce.eb.Publish(events.TypeReorg, events.Reorg{Reverted: reverted})
+	}
+
+	contracts, err := ce.cs.Contracts()
+	if err != nil {
+		log.Println("WARN: could not load contracts:", err)
+	}
+	for i, b := range cc.AppliedBlocks {
+		index := consensus.ChainIndex{
+			Height: height + uint64(i) + 1,
+			ID:     consensus.BlockID(b.ID()),
+		}
+		ce.eb.Publish(events.TypeBlock, events.Block{Index: index})
+		for _, c := range contracts {
+			if c.EndHeight() == index.Height+contractExpiringBlocks {
+				ce.eb.Publish(events.TypeContractExpiring, events.Contract{
+					ID:        c.ID(),
+					HostKey:   c.HostKey(),
+					EndHeight: c.EndHeight(),
+				})
+			}
+		}
+	}
+
+	pts, err := ce.w.PendingTransactions()
+	if err != nil {
+		log.Println("WARN: could not load pending transactions:", err)
+	}
+	for _, pt := range pts {
+		if pt.Status == wallet.PendingStatusConfirmed && pt.Height > height {
+			ce.eb.Publish(events.TypeWalletConfirmed, events.WalletConfirmed{ID: pt.ID, Height: pt.Height})
+		}
+	}
+}
+
+// defragWallet periodically merges the wallet's smallest outputs whenever it
+// has more than threshold spendable outputs, until the node is closed.
+func (n *node) defragWallet(threshold int, interval time.Duration) {
+	cm, tp := chainManager{n.cm}, txpool{n.tp}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+		feePerByte := n.w.FeePolicy().FeePerByte(tp.RecommendedFee(), wallet.FeePriorityLow)
+		txns, err := n.w.Defrag(cm.TipState(), threshold, wallet.DefaultDefragBatchSize, feePerByte, tp.Transactions())
+		if err != nil {
+			log.Println("WARN: could not defragment wallet:", err)
+			continue
+		}
+		for i, txn := range txns {
+			parents, err := tp.UnconfirmedParents(txn)
+			if err == nil {
+				err = tp.AddTransactionSet(append(parents, txn))
+			}
+			if err != nil {
+				log.Println("WARN: could not broadcast defrag transaction:", err)
+				for _, txn := range txns[i:] {
+					n.w.ReleaseInputs(txn)
+				}
+				break
+			}
+			log.Printf("wallet: Merged %v outputs in transaction %v", len(txn.SiacoinInputs), txn.ID())
+		}
+	}
+}
+
+// rebroadcastPending periodically rebroadcasts the transaction sets tracked by
+// the wallet until the node is closed.
+func (n *node) rebroadcastPending(interval time.Duration) {
+	r := struct {
+		syncer
+		txpool
+	}{syncer{n.g, n.tp}, txpool{n.tp}}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+		// sets can't be validated against an outdated chain
+		if !n.cm.Synced() {
+			continue
+		}
+		if err := n.w.Rebroadcast(r); err != nil {
+			log.Println("WARN: could not rebroadcast pending transactions:", err)
+		}
+	}
+}
+
+// slabSweepInterval is how often the object store is swept for uploaded slabs
+// that were never stored in an object.
+const slabSweepInterval = time.Hour
+
+// sweepSlabs periodically queues the sectors of slabs that were uploaded but
+// never stored in an object for deletion, until the node is closed.
+func (n *node) sweepSlabs(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := n.os.SweepSlabs(); err != nil {
+			log.Println("WARN: could not sweep unreferenced slabs:", err)
+		}
+	}
+}
+
+// versionPruneInterval is how often noncurrent object versions that have
+// outlived their retention period are removed.
+const versionPruneInterval = time.Hour
+
+// pruneVersions periodically removes the noncurrent object versions that are no
+// longer retained, until the node is closed.
+func (n *node) pruneVersions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := n.os.PruneVersions(); err != nil {
+			log.Println("WARN: could not prune object versions:", err)
+		}
+	}
 }
 
 func (n *node) Close() error {
+	close(n.stop)
 	errs := []error{
+		n.wm.Close(),
 		n.g.Close(),
 		n.cm.Close(),
 		n.tp.Close(),
+		n.ws.Close(),
+		n.hdb.Close(),
+		n.cs.Close(),
+		n.os.Close(),
+		n.whs.Close(),
+		n.as.Close(),
 	}
 	for _, err := range errs {
 		if err != nil {
@@ -38,12 +222,24 @@ func (n *node) Close() error {
 	return nil
 }
 
-func newNode(addr, dir string, bootstrap bool, walletKey consensus.PrivateKey) (*node, error) {
+// noBackups stands in for a BackupManager when the node has no wallet seed to
+// derive the backup key from.
+type noBackups struct{}
+
+var errNoBackups = errors.New("backups are unavailable with a watch-only wallet")
+
+func (noBackups) Backup() ([]byte, error) { return nil, errNoBackups }
+func (noBackups) Restore([]byte) error    { return errNoBackups }
+
+// newNode returns a new node. If walletSeed is nil, the node runs a watch-only
+// wallet for watchKey, and backups are unavailable.
+func newNode(cfg config, walletSeed *wallet.Seed, watchKey consensus.PublicKey) (*node, error) {
+	dir, bootstrap := cfg.Directory, cfg.Gateway.Bootstrap
 	gatewayDir := filepath.Join(dir, "gateway")
 	if err := os.MkdirAll(gatewayDir, 0700); err != nil {
 		return nil, err
 	}
-	g, err := gateway.New(addr, bootstrap, gatewayDir)
+	g, err := gateway.New(cfg.Gateway.Address, bootstrap, gatewayDir)
 	if err != nil {
 		return nil, err
 	}
@@ -73,55 +269,103 @@ func newNode(addr, dir string, bootstrap bool, walletKey consensus.PrivateKey) (
 		return nil, err
 	}
 
-	walletDir := filepath.Join(dir, "wallet")
+	// watch-only wallets track a single address in their own database
+	walletDir := cfg.storeDir(cfg.Stores.Wallet, "wallet")
+	deriveAddr, gap := func(index uint64) types.UnlockHash { return wallet.StandardAddress(watchKey) }, uint64(0)
+	if walletSeed != nil {
+		deriveAddr, gap = walletSeed.Address, wallet.DefaultGapLimit
+	} else {
+		walletDir = filepath.Join(walletDir, "watchonly")
+	}
 	if err := os.MkdirAll(walletDir, 0700); err != nil {
 		return nil, err
 	}
-	walletAddr := wallet.StandardAddress(walletKey.PublicKey())
-	ws, ccid, err := stores.NewJSONWalletStore(walletDir, walletAddr)
+	ws, ccid, err := stores.NewBoltWalletStore(walletDir, deriveAddr, gap)
 	if err != nil {
 		return nil, err
 	} else if err := cm.ConsensusSetSubscribe(ws, ccid, nil); err != nil {
 		return nil, err
 	}
-	w := wallet.NewSingleAddressWallet(walletKey, ws)
+	var w *wallet.SeedWallet
+	if walletSeed != nil {
+		w = wallet.NewSeedWallet(*walletSeed, ws)
+	} else {
+		w = wallet.NewWatchOnlyWallet(watchKey, ws)
+	}
 
-	hostdbDir := filepath.Join(dir, "hostdb")
+	hostdbDir := cfg.storeDir(cfg.Stores.HostDB, "hostdb")
 	if err := os.MkdirAll(hostdbDir, 0700); err != nil {
 		return nil, err
 	}
-	hdb, ccid, err := stores.NewJSONHostDB(hostdbDir)
+	hdb, ccid, err := stores.NewBoltHostDB(hostdbDir)
 	if err != nil {
 		return nil, err
 	} else if err := cm.ConsensusSetSubscribe(hdb, ccid, nil); err != nil {
 		return nil, err
 	}
 
-	contractsDir := filepath.Join(dir, "contracts")
+	contractsDir := cfg.storeDir(cfg.Stores.Contracts, "contracts")
 	if err := os.MkdirAll(contractsDir, 0700); err != nil {
 		return nil, err
 	}
-	cs, err := stores.NewJSONContractStore(contractsDir)
+	cs, err := stores.NewBoltContractStore(contractsDir)
 	if err != nil {
 		return nil, err
 	}
 
-	objectsDir := filepath.Join(dir, "objects")
+	webhooksDir := cfg.storeDir(cfg.Stores.Webhooks, "webhooks")
+	if err := os.MkdirAll(webhooksDir, 0700); err != nil {
+		return nil, err
+	}
+	whs, err := stores.NewBoltWebhookStore(webhooksDir)
+	if err != nil {
+		return nil, err
+	}
+
+	authDir := cfg.storeDir(cfg.Stores.Auth, "auth")
+	if err := os.MkdirAll(authDir, 0700); err != nil {
+		return nil, err
+	}
+	as, err := stores.NewBoltAuthStore(authDir)
+	if err != nil {
+		return nil, err
+	}
+
+	objectsDir := cfg.storeDir(cfg.Stores.Objects, "objects")
 	if err := os.MkdirAll(objectsDir, 0700); err != nil {
 		return nil, err
 	}
-	os, err := stores.NewJSONObjectStore(objectsDir)
+	os, err := stores.NewBoltObjectStore(objectsDir)
 	if err != nil {
 		return nil, err
 	}
 
+	var bm api.BackupStore = noBackups{}
+	if walletSeed != nil {
+		bm = stores.NewBackupManager(walletSeed.PrivateKey(0), os, cs, hdb)
+	}
+
+	eb := events.NewBus(events.DefaultBacklog)
+	if err := cm.ConsensusSetSubscribe(chainEvents{eb, w, cs}, modules.ConsensusChangeRecent, nil); err != nil {
+		return nil, err
+	}
+	wm := webhooks.NewManager(whs, eb, webhooks.DefaultMaxAttempts, webhooks.DefaultBackoff)
+
 	return &node{
 		g:   g,
 		cm:  cm,
 		tp:  tp,
 		w:   w,
+		ws:  ws,
 		hdb: hdb,
 		cs:  cs,
 		os:  os,
+		bm:  bm,
+		eb:  eb,
+		whs: whs,
+		wm:  wm,
+		as:  as,
+
+		stop: make(chan struct{}),
 	}, nil
 }
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/object"
+	"golang.org/x/term"
+)
+
+// listObjects returns every entry in the directory dir, which is either empty
+// or ends in /.
+func listObjects(c *api.Client, bucket, dir string) ([]object.Entry, error) {
+	var entries []object.Entry
+	opts := object.ListOptions{Limit: 1000}
+	for {
+		page, marker, err := c.ListObjects(bucket, dir, opts)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+		if marker == "" {
+			return entries, nil
+		}
+		opts.Marker = marker
+	}
+}
+
+// walkObjects calls fn with the name of each object beneath the directory dir,
+// which is either empty or ends in /.
+func walkObjects(c *api.Client, bucket, dir string, fn func(name string) error) error {
+	entries, err := listObjects(c, bucket, dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := strings.TrimPrefix(e.Name, "/")
+		if strings.HasSuffix(name, "/") {
+			err = walkObjects(c, bucket, name, fn)
+		} else {
+			err = fn(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveObject renames an object by storing its metadata under the new name, so
+// no data is transferred.
+func moveObject(c *api.Client, bucket, from, to string) error {
+	o, err := c.Object(bucket, from)
+	if err != nil {
+		return err
+	} else if err := c.AddObject(bucket, to, o); err != nil {
+		return err
+	}
+	return c.DeleteObject(bucket, from)
+}
+
+// uploadSettings returns the contracts that new objects in bucket should be
+// stored on, along with the bucket's redundancy.
+func uploadSettings(c *api.Client, bucket string, contracts []api.Contract) (_ []api.Contract, m, n uint8, err error) {
+	b, err := c.Bucket(bucket)
+	if err != nil {
+		return nil, 0, 0, err
+	} else if b.Settings.MinShards == 0 || b.Settings.TotalShards == 0 {
+		return nil, 0, 0, fmt.Errorf("bucket %q has no redundancy settings", bucket)
+	} else if b.Settings.HostSet == "" {
+		return contracts, b.Settings.MinShards, b.Settings.TotalShards, nil
+	}
+	hosts, err := c.HostSet(b.Settings.HostSet)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	inSet := make(map[consensus.PublicKey]bool)
+	for _, h := range hosts {
+		inSet[h] = true
+	}
+	var filtered []api.Contract
+	for _, c := range contracts {
+		if inSet[c.HostKey] {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered, b.Settings.MinShards, b.Settings.TotalShards, nil
+}
+
+// A countingReader counts the bytes read from an underlying io.Reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// uploadObject encrypts the data read from r and uploads it, using the
+// redundancy settings of bucket. The node has no streaming object endpoints, so
+// the data is encrypted here and split into slabs by the node; the returned
+// object must be stored with AddObject.
+func uploadObject(c *api.Client, bucket string, r io.Reader, contracts []api.Contract) (object.Object, error) {
+	contracts, m, n, err := uploadSettings(c, bucket, contracts)
+	if err != nil {
+		return object.Object{}, err
+	}
+	tip, err := c.ConsensusTip()
+	if err != nil {
+		return object.Object{}, err
+	}
+	o := object.Object{Key: object.GenerateEncryptionKey()}
+	cr := &countingReader{r: r}
+	slabs, err := c.UploadSlabs(o.Key.Encrypt(cr), m, n, tip.Height, contracts)
+	if err != nil {
+		return object.Object{}, err
+	} else if len(slabs) > 0 {
+		o.Slabs = object.SplitSlabs(slabs, []int{int(cr.n)})[0]
+	}
+	return o, nil
+}
+
+// downloadObject writes the decrypted data of o, starting at offset, to w.
+func downloadObject(c *api.Client, w io.Writer, o object.Object, offset, length int64, contracts []api.Contract) error {
+	return c.DownloadSlabs(o.Key.Decrypt(w, offset), o.Slabs, offset, length, contracts)
+}
+
+// A progressBar reports the progress of a transfer on stderr, if it is a
+// terminal.
+type progressBar struct {
+	name   string
+	total  int64
+	n      int64
+	last   time.Time
+	silent bool
+}
+
+func newProgressBar(name string, total int64) *progressBar {
+	return &progressBar{
+		name:   name,
+		total:  total,
+		silent: !term.IsTerminal(int(os.Stderr.Fd())),
+	}
+}
+
+func (p *progressBar) add(n int) {
+	p.n += int64(n)
+	if !p.silent && time.Since(p.last) > 100*time.Millisecond {
+		p.draw()
+		p.last = time.Now()
+	}
+}
+
+func (p *progressBar) draw() {
+	const width = 30
+	frac := 1.0
+	if p.total > 0 {
+		frac = float64(p.n) / float64(p.total)
+	}
+	filled := int(frac * width)
+	fmt.Fprintf(os.Stderr, "\r%s [%s%s] %5.1f%% %s", p.name, strings.Repeat("=", filled), strings.Repeat(" ", width-filled), frac*100, formatSize(p.n))
+}
+
+// done draws the completed bar.
+func (p *progressBar) done() {
+	if !p.silent {
+		p.draw()
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// reader returns an io.Reader that advances p as r is read.
+func (p *progressBar) reader(r io.Reader) io.Reader {
+	return readerFunc(func(b []byte) (int, error) {
+		n, err := r.Read(b)
+		p.add(n)
+		return n, err
+	})
+}
+
+// writer returns an io.Writer that advances p as w is written.
+func (p *progressBar) writer(w io.Writer) io.Writer {
+	return writerFunc(func(b []byte) (int, error) {
+		n, err := w.Write(b)
+		p.add(n)
+		return n, err
+	})
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (fn readerFunc) Read(p []byte) (int, error) { return fn(p) }
+
+type writerFunc func([]byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) { return fn(p) }
+
+// formatSize formats n bytes in binary units.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+const objectsUsage = `Usage:
+    renterd objects ls [flags] [dir]
+    renterd objects stat [flags] <name>
+    renterd objects put [flags] <file> [name]
+    renterd objects get [flags] <name> [file]
+    renterd objects rm [flags] <name>
+    renterd objects mv [flags] <name> <new name>
+
+Manages the objects stored by the renterd node listening on -http. put and get
+encrypt and decrypt data locally, and transfer it using the contracts in the
+-contracts file, such as the one written by 'renterd siad import'. With -r, put
+and get transfer directories recursively, and rm and mv operate on every object
+beneath a directory.
+
+Flags:
+`
+
+func objectsCmd(apiAddr string, args []string) {
+	fs := flag.NewFlagSet("objects", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), objectsUsage)
+		fs.PrintDefaults()
+	}
+	bucket := fs.String("bucket", object.DefaultBucket, "bucket containing the objects")
+	contractsPath := fs.String("contracts", "", "file containing the contracts, with renter keys, used to transfer data")
+	recursive := fs.Bool("r", false, "operate on directories recursively")
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cmd := args[0]
+	fs.Parse(args[1:])
+	args = fs.Args()
+	nargs := map[string][2]int{
+		"ls":   {0, 1},
+		"stat": {1, 1},
+		"put":  {1, 2},
+		"get":  {1, 2},
+		"rm":   {1, 1},
+		"mv":   {2, 2},
+	}[cmd]
+	if nargs == [2]int{} || len(args) < nargs[0] || len(args) > nargs[1] {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var contracts []api.Contract
+	if cmd == "put" || cmd == "get" {
+		if *contractsPath == "" {
+			log.Fatalln(cmd, "requires -contracts")
+		}
+		var err error
+		contracts, err = loadContracts(*contractsPath)
+		check("Could not load contracts", err)
+	}
+	c := api.NewClient("http://"+apiAddr+"/api", getAPIPassword())
+
+	switch cmd {
+	case "ls":
+		var dir string
+		if len(args) > 0 {
+			dir = objectDir(args[0])
+		}
+		entries, err := listObjects(c, *bucket, dir)
+		check("Could not list objects", err)
+		for _, e := range entries {
+			modified := "-"
+			if !e.Metadata.Modified.IsZero() {
+				modified = e.Metadata.Modified.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%10s  %16s  %s\n", formatSize(e.Size), modified, strings.TrimPrefix(e.Name, "/"))
+		}
+
+	case "stat":
+		o, err := c.Object(*bucket, objectName(args[0]))
+		check("Could not load object", err)
+		fmt.Println("Name:        ", objectName(args[0]))
+		fmt.Println("Size:        ", formatSize(o.Size()))
+		fmt.Println("Slabs:       ", len(o.Slabs))
+		if len(o.Slabs) > 0 {
+			fmt.Printf("Redundancy:   %v-of-%v\n", o.Slabs[0].MinShards, len(o.Slabs[0].Shards))
+		}
+		fmt.Println("Content-Type:", o.Metadata.ContentType)
+		fmt.Println("Created:     ", o.Metadata.Created.Local())
+		fmt.Println("Modified:    ", o.Metadata.Modified.Local())
+		fmt.Println("ETag:        ", o.Metadata.ETag)
+		if o.Metadata.VersionID != "" {
+			fmt.Println("Version:     ", o.Metadata.VersionID)
+		}
+		for k, v := range o.Metadata.User {
+			fmt.Printf("User:         %v=%v\n", k, v)
+		}
+
+	case "put":
+		src := args[0]
+		name := filepath.Base(src)
+		if len(args) > 1 {
+			name = objectName(args[1])
+		}
+		if !*recursive {
+			check("Could not upload file", putFile(c, *bucket, src, name, contracts))
+			return
+		}
+		err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			rel, _ := filepath.Rel(src, p)
+			return putFile(c, *bucket, p, path.Join(name, filepath.ToSlash(rel)), contracts)
+		})
+		check("Could not upload directory", err)
+
+	case "get":
+		name := objectName(args[0])
+		dst := path.Base(name)
+		if len(args) > 1 {
+			dst = args[1]
+		}
+		if !*recursive {
+			check("Could not download object", getFile(c, *bucket, name, dst, contracts))
+			return
+		}
+		err := walkObjects(c, *bucket, objectDir(name), func(n string) error {
+			rel := strings.TrimPrefix(n, objectDir(name))
+			return getFile(c, *bucket, n, filepath.Join(dst, filepath.FromSlash(rel)), contracts)
+		})
+		check("Could not download directory", err)
+
+	case "rm":
+		name := objectName(args[0])
+		if !*recursive {
+			check("Could not delete object", c.DeleteObject(*bucket, name))
+			return
+		}
+		resp, err := c.DeleteObjects(*bucket, objectDir(name), false)
+		check("Could not delete objects", err)
+		log.Printf("Deleted %v objects (%v)", len(resp.Keys), formatSize(resp.Size))
+
+	case "mv":
+		from, to := objectName(args[0]), objectName(args[1])
+		if !*recursive {
+			check("Could not move object", moveObject(c, *bucket, from, to))
+			return
+		} else if strings.HasPrefix(objectDir(to), objectDir(from)) {
+			log.Fatalln("Cannot move a directory into itself")
+		}
+		err := walkObjects(c, *bucket, objectDir(from), func(n string) error {
+			return moveObject(c, *bucket, n, objectDir(to)+strings.TrimPrefix(n, objectDir(from)))
+		})
+		check("Could not move objects", err)
+	}
+}
+
+// objectName normalizes a user-supplied object name.
+func objectName(name string) string {
+	return strings.Trim(name, "/")
+}
+
+// objectDir normalizes a user-supplied directory name into a listing prefix.
+func objectDir(name string) string {
+	if name = objectName(name); name != "" {
+		name += "/"
+	}
+	return name
+}
+
+// putFile uploads the file at src and stores it as the object name.
+func putFile(c *api.Client, bucket, src, name string, contracts []api.Contract) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	} else if info.IsDir() {
+		return errors.New("cannot upload a directory without -r")
+	}
+	p := newProgressBar(name, info.Size())
+	o, err := uploadObject(c, bucket, p.reader(f), contracts)
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	p.done()
+	return c.AddObject(bucket, name, o)
+}
+
+// getFile downloads the object name and writes it to the file at dst.
+func getFile(c *api.Client, bucket, name, dst string, contracts []api.Contract) error {
+	o, err := c.Object(bucket, name)
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	} else if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p := newProgressBar(name, o.Size())
+	if err := downloadObject(c, p.writer(f), o, 0, o.Size(), contracts); err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	p.done()
+	return f.Close()
+}
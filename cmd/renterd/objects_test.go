@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+func TestObjectNames(t *testing.T) {
+	tests := []struct {
+		in, name, dir string
+	}{
+		{"", "", ""},
+		{"/", "", ""},
+		{"foo", "foo", "foo/"},
+		{"/foo/", "foo", "foo/"},
+		{"foo/bar/", "foo/bar", "foo/bar/"},
+	}
+	for _, test := range tests {
+		if name := objectName(test.in); name != test.name {
+			t.Errorf("objectName(%q): expected %q, got %q", test.in, test.name, name)
+		}
+		if dir := objectDir(test.in); dir != test.dir {
+			t.Errorf("objectDir(%q): expected %q, got %q", test.in, test.dir, dir)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		n   int64
+		exp string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1 << 20, "1.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+	for _, test := range tests {
+		if s := formatSize(test.n); s != test.exp {
+			t.Errorf("formatSize(%v): expected %q, got %q", test.n, test.exp, s)
+		}
+	}
+}
+
+func TestObjectCommands(t *testing.T) {
+	c := newTestClient(t)
+	bucket := object.DefaultBucket
+
+	// put a directory of files
+	src := t.TempDir()
+	files := map[string][]byte{
+		"a.txt":         frand.Bytes(100),
+		"dir/b.txt":     frand.Bytes(5000),
+		"dir/sub/c.txt": frand.Bytes(0),
+	}
+	for name, data := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(p, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := putFile(c, bucket, p, "up/"+name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := putFile(c, bucket, src, "up", nil); err == nil {
+		t.Fatal("expected uploading a directory to fail")
+	}
+
+	// list and walk
+	entries, err := listObjects(c, bucket, "up/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if exp := []string{"/up/a.txt", "/up/dir/"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected entries %v, got %v", exp, names)
+	} else if entries[0].Size != 100 {
+		t.Fatal("wrong size for a.txt:", entries[0].Size)
+	}
+	walk := func(dir string) []string {
+		t.Helper()
+		var names []string
+		err := walkObjects(c, bucket, dir, func(name string) error {
+			names = append(names, name)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(names)
+		return names
+	}
+	if names, exp := walk("up/"), []string{"up/a.txt", "up/dir/b.txt", "up/dir/sub/c.txt"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected walk to visit %v, got %v", exp, names)
+	}
+
+	// get each file back
+	dst := t.TempDir()
+	for name, data := range files {
+		p := filepath.Join(dst, filepath.FromSlash(name))
+		if err := getFile(c, bucket, "up/"+name, p, nil); err != nil {
+			t.Fatal(err)
+		} else if got, err := os.ReadFile(p); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(got, data) {
+			t.Fatalf("%v: downloaded data does not match", name)
+		}
+	}
+	if err := getFile(c, bucket, "up/missing", filepath.Join(dst, "missing"), nil); err == nil {
+		t.Fatal("expected downloading a missing object to fail")
+	}
+
+	// move an object; its data should be unchanged
+	if err := moveObject(c, bucket, "up/dir/b.txt", "moved/b.txt"); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Object(bucket, "up/dir/b.txt"); err == nil {
+		t.Fatal("expected moved object to be gone")
+	}
+	p := filepath.Join(dst, "moved")
+	if err := getFile(c, bucket, "moved/b.txt", p, nil); err != nil {
+		t.Fatal(err)
+	} else if got, err := os.ReadFile(p); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, files["dir/b.txt"]) {
+		t.Fatal("moved object has wrong data")
+	}
+	if err := moveObject(c, bucket, "up/missing", "moved/missing"); err == nil {
+		t.Fatal("expected moving a missing object to fail")
+	}
+}
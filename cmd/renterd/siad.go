@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/siad"
+	"go.sia.tech/renterd/object"
+)
+
+const siadUsage = `Usage:
+    renterd siad import <renter dir> <contracts file>
+
+Imports the files and contracts of a siad renter directory (usually
+~/.sia/renter) into the renterd node listening on -http. Files are added as
+objects in the default bucket, keyed by their siapath; files that already exist
+are skipped. Since renterd does not store renter keys, the imported contracts,
+along with the keys required to use them, are written to the contracts file,
+which must not already exist.
+
+Files that renterd cannot download, such as those uploaded by old versions of
+siad or those missing too many pieces, are reported and skipped.
+`
+
+func siadCmd(apiAddr string, args []string) {
+	if len(args) != 3 || args[0] != "import" {
+		fmt.Print(siadUsage)
+		os.Exit(2)
+	}
+	renterDir, contractsPath := args[1], args[2]
+	imp, err := siad.ImportRenterDir(renterDir)
+	check("Could not read siad renter directory", err)
+
+	f, err := os.OpenFile(contractsPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	check("Could not create contracts file", err)
+	defer f.Close()
+
+	c := api.NewClient("http://"+apiAddr+"/api", getAPIPassword())
+	contracts := make([]api.Contract, 0, len(imp.Contracts))
+	for _, sc := range imp.Contracts {
+		check("Could not add contract", c.AddContract(sc.Contract))
+		var hostIP string
+		if h, err := c.Host(sc.HostKey()); err == nil {
+			hostIP = h.NetAddress()
+		}
+		contracts = append(contracts, api.Contract{
+			HostKey:   sc.HostKey(),
+			HostIP:    hostIP,
+			ID:        sc.ID(),
+			RenterKey: sc.RenterKey,
+		})
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	check("Could not write contracts file", enc.Encode(contracts))
+	check("Could not sync contracts file", f.Sync())
+
+	names := make([]string, 0, len(imp.Objects))
+	for name := range imp.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var imported, skipped int
+	for _, name := range names {
+		if _, err := c.Object(object.DefaultBucket, name); err == nil {
+			log.Printf("Skipping %v: object already exists", name)
+			skipped++
+			continue
+		}
+		check("Could not add object", c.AddObject(object.DefaultBucket, name, imp.Objects[name]))
+		imported++
+	}
+
+	failed := make([]string, 0, len(imp.Failed))
+	for path := range imp.Failed {
+		failed = append(failed, path)
+	}
+	sort.Strings(failed)
+	for _, path := range failed {
+		log.Printf("Could not import %v: %v", path, imp.Failed[path])
+	}
+	log.Printf("Imported %v objects and %v contracts (%v skipped, %v failed)", imported, len(contracts), skipped, len(failed))
+	log.Println("Wrote contracts and renter keys to", contractsPath)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/types"
+)
+
+const walletUsage = `Usage:
+    renterd wallet send [flags] <address> <amount> [<address> <amount>...]
+    renterd wallet defrag [flags]
+    renterd wallet bump [flags] <txid>
+    renterd wallet prepare [flags] <bundle> <address> <amount> [<address> <amount>...]
+    renterd wallet sign [flags] <bundle>
+    renterd wallet broadcast <bundle>
+    renterd wallet key
+
+Manages the wallet of the renterd node listening on -http.
+
+send sends siacoins. Amounts are specified with a unit, e.g. 10SC or 500mS;
+multiple recipients are paid in a single transaction. Unless -fee is given, the
+node chooses the miner fee according to -priority.
+
+defrag merges the wallet's smallest outputs if it has more than -threshold
+spendable outputs.
+
+bump raises the fee of a stuck transaction to the fee for -priority by
+broadcasting a child transaction that spends its change output.
+
+prepare, sign, and broadcast send siacoins from a watch-only wallet. prepare
+funds a transaction and writes it, unsigned, to a bundle file. sign prints what
+the bundle pays and, once confirmed (or if -yes is given), signs it with the
+wallet seed; it does not contact the node, so it can be run on an offline
+machine. broadcast submits the signed bundle to the node.
+
+key prints the public key and address of the wallet seed, for use with
+-wallet.watchonly. It does not contact the node.
+
+Flags:
+`
+
+// parseCurrency parses a siacoin amount, such as 10SC or 1000H.
+func parseCurrency(s string) (types.Currency, error) {
+	hastings, err := types.ParseCurrency(s)
+	if err != nil {
+		return types.Currency{}, err
+	}
+	var c types.Currency
+	_, err = fmt.Sscan(hastings, &c)
+	return c, err
+}
+
+// parseOutputs parses a list of alternating addresses and amounts.
+func parseOutputs(args []string) []types.SiacoinOutput {
+	var outputs []types.SiacoinOutput
+	for i := 0; i < len(args); i += 2 {
+		var addr types.UnlockHash
+		check("Invalid address", addr.LoadString(args[i]))
+		value, err := parseCurrency(args[i+1])
+		check("Invalid amount", err)
+		outputs = append(outputs, types.SiacoinOutput{Value: value, UnlockHash: addr})
+	}
+	return outputs
+}
+
+func loadBundle(path string) (b wallet.SigningBundle, err error) {
+	js, err := os.ReadFile(path)
+	if err != nil {
+		return wallet.SigningBundle{}, err
+	}
+	err = json.Unmarshal(js, &b)
+	return
+}
+
+func saveBundle(path string, b wallet.SigningBundle) error {
+	js, _ := json.MarshalIndent(b, "", "  ")
+	return os.WriteFile(path, js, 0600)
+}
+
+// confirm asks the user a yes/no question, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("%v [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func walletCmd(apiAddr string, args []string) {
+	fs := flag.NewFlagSet("wallet", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), walletUsage)
+		fs.PrintDefaults()
+	}
+	fee := fs.String("fee", "", "miner fee to pay, e.g. 10mS")
+	priority := fs.String("priority", "", "fee priority: low, medium, or high")
+	threshold := fs.Int("threshold", 0, "number of spendable outputs above which to defragment (0 for the node's default)")
+	yes := fs.Bool("yes", false, "sign without asking for confirmation")
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cmd := args[0]
+	fs.Parse(args[1:])
+	args = fs.Args()
+	minerFee := func() types.Currency {
+		if *fee == "" {
+			return types.ZeroCurrency
+		}
+		c, err := parseCurrency(*fee)
+		check("Invalid fee", err)
+		return c
+	}
+	feePriority := wallet.FeePriority(*priority)
+	check("Invalid priority", feePriority.Validate())
+
+	switch cmd {
+	case "send":
+		if len(args) == 0 || len(args)%2 != 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		outputs := parseOutputs(args)
+		c := api.NewClient("http://"+apiAddr+"/api", getAPIPassword())
+		txn, err := c.WalletSend(outputs, minerFee(), feePriority)
+		check("Could not send siacoins", err)
+		log.Printf("Broadcast transaction %v (fee: %v H)", txn.ID(), txn.MinerFees[0])
+	case "defrag":
+		if len(args) != 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		c := api.NewClient("http://"+apiAddr+"/api", getAPIPassword())
+		txns, err := c.WalletDefrag(*threshold, 0)
+		check("Could not defragment wallet", err)
+		if len(txns) == 0 {
+			log.Println("Wallet does not need to be defragmented")
+		}
+		for _, txn := range txns {
+			log.Printf("Merged %v outputs in transaction %v (fee: %v H)", len(txn.SiacoinInputs), txn.ID(), txn.MinerFees[0])
+		}
+	case "bump":
+		if len(args) != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		var id types.TransactionID
+		check("Invalid transaction ID", (*crypto.Hash)(&id).LoadString(args[0]))
+		c := api.NewClient("http://"+apiAddr+"/api", getAPIPassword())
+		child, err := c.WalletBump(id, feePriority)
+		check("Could not bump transaction", err)
+		log.Printf("Broadcast child transaction %v (fee: %v H)", child.ID(), child.MinerFees[0])
+	case "prepare":
+		if len(args) < 3 || len(args)%2 != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		outputs := parseOutputs(args[1:])
+		c := api.NewClient("http://"+apiAddr+"/api", getAPIPassword())
+		b, err := c.WalletPrepareSend(outputs, minerFee(), feePriority)
+		check("Could not prepare transaction", err)
+		check("Could not write bundle", saveBundle(args[0], b))
+		log.Printf("Wrote unsigned transaction %v to %v; its inputs are reserved for %v", b.Transaction.ID(), args[0], wallet.ReservationTimeout)
+	case "sign":
+		if len(args) != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		b, err := loadBundle(args[0])
+		check("Could not read bundle", err)
+		seed := getWalletSeed()
+		key := seed.PrivateKey(0)
+		outputs, fee := b.Outputs(key.PublicKey())
+		for _, sco := range outputs {
+			log.Printf("Pays %v H to %v", sco.Value, sco.UnlockHash)
+		}
+		log.Printf("Miner fee: %v H", fee)
+		if !*yes && !confirm("Sign this transaction?") {
+			log.Fatal("Aborted")
+		}
+		check("Could not sign transaction", b.Sign(key))
+		check("Could not write bundle", saveBundle(args[0], b))
+		log.Println("Signed transaction", b.Transaction.ID())
+	case "broadcast":
+		if len(args) != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		b, err := loadBundle(args[0])
+		check("Could not read bundle", err)
+		c := api.NewClient("http://"+apiAddr+"/api", getAPIPassword())
+		txn, err := c.WalletBroadcast(b)
+		check("Could not broadcast transaction", err)
+		log.Println("Broadcast transaction", txn.ID())
+	case "key":
+		if len(args) != 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		seed := getWalletSeed()
+		log.Println("Public key:", seed.PublicKey(0))
+		log.Println("Address:   ", seed.Address(0))
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"go.sia.tech/jape"
 	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/auth"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/types"
@@ -132,11 +133,14 @@ func (t treeMux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 func startWeb(l net.Listener, node *node, password string) error {
-	renter := api.NewServer(&syncer{node.g, node.tp}, &chainManager{node.cm}, txpool{node.tp}, node.w, node.hdb, rhpImpl{}, node.cs, newSlabMover(), node.os)
+	// the server authenticates each request itself, accepting the password and
+	// any scoped API keys
+	km := auth.NewManager(node.as, password)
+	renter := api.NewServer(&syncer{node.g, node.tp}, &chainManager{node.cm}, txpool{node.tp}, node.w, node.hdb, rhpImpl{}, node.cs, newSlabMover(), node.os, node.bm, node.eb, node.wm, km)
 	return http.Serve(l, treeMux{
 		h: createUIHandler(),
 		sub: map[string]treeMux{
-			"/api": {h: jape.AuthMiddleware(renter, password)},
+			"/api": {h: renter},
 		},
 	})
 }
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"golang.org/x/net/webdav"
+)
+
+// loadContracts reads a JSON array of contracts, including their renter keys,
+// from path.
+func loadContracts(path string) ([]api.Contract, error) {
+	js, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var contracts []api.Contract
+	if err := json.Unmarshal(js, &contracts); err != nil {
+		return nil, err
+	}
+	return contracts, nil
+}
+
+// davFS implements webdav.FileSystem on top of the object APIs of a renterd
+// node. Objects are encrypted and split into slabs by the davFS itself, using
+// the redundancy settings of the bucket.
+//
+// Since the object store has no notion of directories, directories created via
+// MKCOL only exist in memory until an object is stored beneath them.
+type davFS struct {
+	c         *api.Client
+	bucket    string
+	contracts []api.Contract
+
+	mu   sync.Mutex
+	dirs map[string]bool // empty directories
+}
+
+// key converts a webdav name, which always begins with /, into an object name.
+func key(name string) string {
+	return strings.TrimPrefix(path.Clean(name), "/")
+}
+
+// dirKey converts a webdav name into the prefix of a directory's objects.
+func dirKey(name string) string {
+	if k := key(name); k != "" {
+		return k + "/"
+	}
+	return ""
+}
+
+// within reports whether name is dir or one of its descendants, returning the
+// path of name relative to dir.
+func within(name, dir string) (string, bool) {
+	name, dir = path.Clean(name), path.Clean(dir)
+	if name == dir {
+		return "", true
+	} else if dir == "/" {
+		return name[1:], true
+	} else if strings.HasPrefix(name, dir+"/") {
+		return name[len(dir)+1:], true
+	}
+	return "", false
+}
+
+// entries returns all entries in the directory name.
+func (fs *davFS) entries(name string) ([]object.Entry, error) {
+	return listObjects(fs.c, fs.bucket, dirKey(name))
+}
+
+// Mkdir implements webdav.FileSystem.
+func (fs *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if _, err := fs.Stat(ctx, name); err == nil {
+		return os.ErrExist
+	} else if parent, err := fs.Stat(ctx, path.Dir(path.Clean(name))); err != nil {
+		return err
+	} else if !parent.IsDir() {
+		return os.ErrInvalid
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.dirs[path.Clean(name)] = true
+	return nil
+}
+
+// OpenFile implements webdav.FileSystem.
+func (fs *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if fi, err := fs.Stat(ctx, name); err == nil && fi.IsDir() {
+			return nil, os.ErrInvalid
+		} else if err == nil && flag&os.O_TRUNC == 0 {
+			return nil, os.ErrPermission // objects cannot be modified in place
+		} else if err != nil && flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+		if parent, err := fs.Stat(ctx, path.Dir(path.Clean(name))); err != nil {
+			return nil, err
+		} else if !parent.IsDir() {
+			return nil, os.ErrInvalid
+		}
+		return &davWriteFile{fs: fs, name: path.Clean(name)}, nil
+	}
+	fi, err := fs.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		return &davDir{fs: fs, name: path.Clean(name), fi: fi}, nil
+	}
+	o, err := fs.c.Object(fs.bucket, key(name))
+	if err != nil {
+		return nil, err
+	}
+	return &davReadFile{fs: fs, o: o, fi: fi}, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (fs *davFS) RemoveAll(ctx context.Context, name string) error {
+	fi, err := fs.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fs.c.DeleteObject(fs.bucket, key(name))
+	}
+	if k := dirKey(name); k != "" {
+		if _, err := fs.c.DeleteObjects(fs.bucket, k, false); err != nil {
+			return err
+		}
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for dir := range fs.dirs {
+		if _, ok := within(dir, name); ok {
+			delete(fs.dirs, dir)
+		}
+	}
+	return nil
+}
+
+// walk calls fn for each object beneath the directory name.
+func (fs *davFS) walk(name string, fn func(key string) error) error {
+	return walkObjects(fs.c, fs.bucket, dirKey(name), fn)
+}
+
+// Rename implements webdav.FileSystem. Objects are renamed by storing their
+// metadata under the new name, so no data is transferred.
+func (fs *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	fi, err := fs.Stat(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return moveObject(fs.c, fs.bucket, key(oldName), key(newName))
+	}
+	oldPrefix, newPrefix := dirKey(oldName), dirKey(newName)
+	if oldPrefix == "" || strings.HasPrefix(newPrefix, oldPrefix) {
+		return os.ErrInvalid
+	}
+	err = fs.walk(oldName, func(k string) error {
+		return moveObject(fs.c, fs.bucket, k, newPrefix+strings.TrimPrefix(k, oldPrefix))
+	})
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for dir := range fs.dirs {
+		if rel, ok := within(dir, oldName); ok {
+			delete(fs.dirs, dir)
+			fs.dirs[path.Join(newName, rel)] = true
+		}
+	}
+	return nil
+}
+
+// Stat implements webdav.FileSystem.
+func (fs *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	name = path.Clean(name)
+	if name == "/" {
+		return davFileInfo{name: "/", dir: true}, nil
+	}
+	fs.mu.Lock()
+	isDir := fs.dirs[name]
+	fs.mu.Unlock()
+	if isDir {
+		return davFileInfo{name: path.Base(name), dir: true}, nil
+	}
+	// the object store can only describe an object within a listing of its
+	// parent directory
+	entries, err := fs.entries(path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.TrimSuffix(e.Name, "/") == name {
+			return entryInfo(e), nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// davFileInfo implements os.FileInfo, as well as the optional
+// webdav.ContentTyper and webdav.ETager interfaces, which prevent the webdav
+// package from downloading objects to compute their properties.
+type davFileInfo struct {
+	name string
+	size int64
+	dir  bool
+	md   object.Metadata
+}
+
+func entryInfo(e object.Entry) davFileInfo {
+	return davFileInfo{
+		name: path.Base(strings.TrimSuffix(e.Name, "/")),
+		size: e.Size,
+		dir:  strings.HasSuffix(e.Name, "/"),
+		md:   e.Metadata,
+	}
+}
+
+func (fi davFileInfo) Name() string       { return fi.name }
+func (fi davFileInfo) Size() int64        { return fi.size }
+func (fi davFileInfo) ModTime() time.Time { return fi.md.Modified }
+func (fi davFileInfo) IsDir() bool        { return fi.dir }
+func (fi davFileInfo) Sys() interface{}   { return nil }
+
+func (fi davFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi davFileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.md.ContentType != "" {
+		return fi.md.ContentType, nil
+	} else if ct := mime.TypeByExtension(path.Ext(fi.name)); ct != "" {
+		return ct, nil
+	}
+	return "application/octet-stream", nil
+}
+
+// ETag implements webdav.ETager.
+func (fi davFileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.md.ETag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.md.ETag + `"`, nil
+}
+
+// davDir is an open directory.
+type davDir struct {
+	fs      *davFS
+	name    string
+	fi      os.FileInfo
+	entries []os.FileInfo
+	read    bool
+}
+
+func (d *davDir) Close() error                                 { return nil }
+func (d *davDir) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (d *davDir) Write(p []byte) (int, error)                  { return 0, os.ErrInvalid }
+func (d *davDir) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (d *davDir) Stat() (os.FileInfo, error)                   { return d.fi, nil }
+
+// Readdir implements http.File.
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		entries, err := d.fs.entries(d.name)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, e := range entries {
+			fi := entryInfo(e)
+			seen[fi.name] = true
+			d.entries = append(d.entries, fi)
+		}
+		d.fs.mu.Lock()
+		for dir := range d.fs.dirs {
+			if path.Dir(dir) == d.name && !seen[path.Base(dir)] {
+				d.entries = append(d.entries, davFileInfo{name: path.Base(dir), dir: true})
+			}
+		}
+		d.fs.mu.Unlock()
+		d.read = true
+	}
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	} else if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
+
+// davReadFile is an object opened for reading. Data is downloaded lazily,
+// starting from the current offset, and decrypted as it is read.
+type davReadFile struct {
+	fs     *davFS
+	o      object.Object
+	fi     os.FileInfo
+	offset int64
+	r      *io.PipeReader
+}
+
+func (f *davReadFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (f *davReadFile) Write(p []byte) (int, error)              { return 0, os.ErrInvalid }
+func (f *davReadFile) Stat() (os.FileInfo, error)               { return f.fi, nil }
+
+// Read implements io.Reader.
+func (f *davReadFile) Read(p []byte) (int, error) {
+	size := f.o.Size()
+	if f.offset >= size {
+		return 0, io.EOF
+	}
+	if f.r == nil {
+		pr, pw := io.Pipe()
+		go func(offset int64) {
+			pw.CloseWithError(downloadObject(f.fs.c, pw, f.o, offset, size-offset, f.fs.contracts))
+		}(f.offset)
+		f.r = pr
+	}
+	n, err := f.r.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (f *davReadFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.o.Size()
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	if offset != f.offset && f.r != nil {
+		f.r.Close()
+		f.r = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// WriteTo implements io.WriterTo. When an object is copied to another object,
+// only its metadata is copied.
+func (f *davReadFile) WriteTo(w io.Writer) (int64, error) {
+	if wf, ok := w.(*davWriteFile); ok && wf.fs == f.fs && wf.pw == nil && f.offset == 0 {
+		o := f.o
+		wf.copyOf = &o
+		return o.Size(), nil
+	}
+	return io.Copy(w, struct{ io.Reader }{f})
+}
+
+// Close implements io.Closer.
+func (f *davReadFile) Close() error {
+	if f.r != nil {
+		f.r.Close()
+	}
+	return nil
+}
+
+// davWriteFile is an object opened for writing. Data is encrypted and
+// uploaded as it is written; the object is stored when the file is closed.
+type davWriteFile struct {
+	fs     *davFS
+	name   string
+	n      int64
+	pw     *io.PipeWriter
+	errCh  chan error
+	o      object.Object // set once the upload succeeds
+	copyOf *object.Object
+}
+
+func (f *davWriteFile) Readdir(count int) ([]os.FileInfo, error)     { return nil, os.ErrInvalid }
+func (f *davWriteFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (f *davWriteFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+
+func (f *davWriteFile) Stat() (os.FileInfo, error) {
+	return davFileInfo{name: path.Base(f.name), size: f.n}, nil
+}
+
+// start begins uploading the data written to f.
+func (f *davWriteFile) start() {
+	pr, pw := io.Pipe()
+	f.pw = pw
+	f.errCh = make(chan error, 1)
+	go func() {
+		o, err := uploadObject(f.fs.c, f.fs.bucket, pr, f.fs.contracts)
+		pr.CloseWithError(err)
+		f.o = o
+		f.errCh <- err
+	}()
+}
+
+// Write implements io.Writer.
+func (f *davWriteFile) Write(p []byte) (int, error) {
+	if f.copyOf != nil {
+		return 0, os.ErrInvalid
+	} else if f.pw == nil {
+		f.start()
+	}
+	n, err := f.pw.Write(p)
+	f.n += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer. The object is only stored if all of its data
+// was uploaded successfully.
+func (f *davWriteFile) Close() error {
+	var o object.Object
+	switch {
+	case f.copyOf != nil:
+		o = *f.copyOf
+	case f.pw != nil:
+		f.pw.Close()
+		if err := <-f.errCh; err != nil {
+			return err
+		}
+		o = f.o
+	default:
+		o = object.Object{Key: object.GenerateEncryptionKey()}
+	}
+	if o.Metadata.ContentType == "" {
+		o.Metadata.ContentType = mime.TypeByExtension(path.Ext(f.name))
+	}
+	if err := f.fs.c.AddObject(f.fs.bucket, key(f.name), o); err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	delete(f.fs.dirs, path.Dir(f.name))
+	f.fs.mu.Unlock()
+	return nil
+}
+
+// davHandler returns a WebDAV handler serving the objects of bucket, which is
+// protected by HTTP basic authentication with the supplied password.
+func davHandler(c *api.Client, bucket string, contracts []api.Contract, password string) http.Handler {
+	h := &webdav.Handler{
+		FileSystem: &davFS{
+			c:         c,
+			bucket:    bucket,
+			contracts: contracts,
+			dirs:      make(map[string]bool),
+		},
+		LockSystem: webdav.NewMemLS(),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, pass, ok := req.BasicAuth(); !ok || subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="renterd"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// startWebDAV serves the objects of bucket over WebDAV, using the API served
+// at apiAddr. If RENTERD_WEBDAV_PASSWORD is set, it is used instead of the API
+// password to authenticate WebDAV clients.
+func startWebDAV(l net.Listener, apiAddr, apiPassword, bucket string, contracts []api.Contract) error {
+	password := apiPassword
+	if pw := os.Getenv("RENTERD_WEBDAV_PASSWORD"); pw != "" {
+		password = pw
+	}
+	c := api.NewClient("http://"+apiAddr+"/api", apiPassword)
+	return http.Serve(l, davHandler(c, bucket, contracts, password))
+}
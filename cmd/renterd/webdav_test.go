@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/internal/slabutil"
+	"go.sia.tech/renterd/internal/stores"
+	"go.sia.tech/renterd/object"
+	"go.sia.tech/renterd/slab"
+	"lukechampine.com/frand"
+)
+
+type mockChainManager struct{}
+
+func (mockChainManager) TipState() (cs consensus.State) { return }
+
+type mockSlabMover struct {
+	hosts []slab.Host
+}
+
+func (sm *mockSlabMover) UploadSlabs(ctx context.Context, r io.Reader, m, n uint8, currentHeight uint64, contracts []api.Contract) ([]slab.Slab, error) {
+	return slab.UploadSlabs(r, m, n, sm.hosts)
+}
+
+func (sm *mockSlabMover) DownloadSlabs(ctx context.Context, w io.Writer, slabs []slab.Slice, offset, length int64, contracts []api.Contract) error {
+	return slab.DownloadSlabs(w, slabs, offset, length, sm.hosts)
+}
+
+func (sm *mockSlabMover) DeleteSlabs(ctx context.Context, slabs []slab.Slab, contracts []api.Contract) error {
+	return slab.DeleteSlabs(slabs, sm.hosts)
+}
+
+func (sm *mockSlabMover) MigrateSlabs(ctx context.Context, slabs []slab.Slab, currentHeight uint64, from, to []api.Contract) error {
+	return slab.MigrateSlabs(slabs, sm.hosts, sm.hosts)
+}
+
+// newTestClient returns a client for an API server that stores objects in
+// memory, on mock hosts.
+func newTestClient(t *testing.T) *api.Client {
+	t.Helper()
+	os := stores.NewEphemeralObjectStore()
+	if err := os.SetBucket(object.DefaultBucket, object.BucketSettings{MinShards: 2, TotalShards: 3}); err != nil {
+		t.Fatal(err)
+	}
+	sm := &mockSlabMover{}
+	for i := 0; i < 3; i++ {
+		sm.hosts = append(sm.hosts, slabutil.NewMockHost())
+	}
+	srv := httptest.NewServer(api.NewServer(nil, mockChainManager{}, nil, nil, nil, nil, nil, sm, os, nil, nil, nil, nil))
+	t.Cleanup(srv.Close)
+	return api.NewClient(srv.URL, "")
+}
+
+func TestWebDAV(t *testing.T) {
+	c := newTestClient(t)
+	srv := httptest.NewServer(davHandler(c, object.DefaultBucket, nil, "password"))
+	defer srv.Close()
+
+	do := func(method, name string, body []byte, header http.Header) (int, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+name, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.SetBasicAuth("", "password")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, respBody
+	}
+	depth := func(d string) http.Header { return http.Header{"Depth": {d}} }
+	dest := func(name string) http.Header { return http.Header{"Destination": {srv.URL + name}} }
+
+	// requests without the password should be rejected
+	if resp, err := http.Get(srv.URL + "/"); err != nil {
+		t.Fatal(err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("expected unauthenticated request to be rejected, got", resp.Status)
+	}
+
+	// PUT, then GET
+	data := frand.Bytes(12345)
+	if code, _ := do("PUT", "/foo.txt", data, nil); code != http.StatusCreated {
+		t.Fatal("PUT failed:", code)
+	}
+	if code, body := do("GET", "/foo.txt", nil, nil); code != http.StatusOK {
+		t.Fatal("GET failed:", code)
+	} else if !bytes.Equal(body, data) {
+		t.Fatal("GET returned wrong data")
+	}
+	if o, err := c.Object(object.DefaultBucket, "foo.txt"); err != nil {
+		t.Fatal(err)
+	} else if o.Metadata.ContentType != "text/plain; charset=utf-8" {
+		t.Fatal("content type was not set:", o.Metadata.ContentType)
+	}
+
+	// PROPFIND should describe the object without downloading it
+	if code, body := do("PROPFIND", "/", nil, depth("1")); code != http.StatusMultiStatus {
+		t.Fatal("PROPFIND failed:", code)
+	} else if !strings.Contains(string(body), "/foo.txt") || !strings.Contains(string(body), "<D:getcontentlength>12345</D:getcontentlength>") {
+		t.Fatal("PROPFIND response does not describe object:", string(body))
+	}
+
+	// MOVE into a new directory
+	if code, _ := do("MKCOL", "/dir", nil, nil); code != http.StatusCreated {
+		t.Fatal("MKCOL failed:", code)
+	} else if code, _ := do("MOVE", "/foo.txt", nil, dest("/dir/bar.txt")); code != http.StatusCreated {
+		t.Fatal("MOVE failed:", code)
+	}
+	if code, _ := do("GET", "/foo.txt", nil, nil); code != http.StatusNotFound {
+		t.Fatal("expected moved object to be gone, got", code)
+	} else if code, body := do("GET", "/dir/bar.txt", nil, nil); code != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatal("moved object has wrong data:", code)
+	}
+	if code, body := do("PROPFIND", "/dir/", nil, depth("1")); code != http.StatusMultiStatus {
+		t.Fatal("PROPFIND failed:", code)
+	} else if !strings.Contains(string(body), "/dir/bar.txt") {
+		t.Fatal("PROPFIND response does not list moved object:", string(body))
+	}
+
+	// DELETE the directory and its contents
+	if code, _ := do("DELETE", "/dir/", nil, nil); code != http.StatusNoContent {
+		t.Fatal("DELETE failed:", code)
+	} else if code, _ := do("PROPFIND", "/dir/", nil, depth("0")); code != http.StatusNotFound {
+		t.Fatal("expected deleted directory to be gone, got", code)
+	} else if _, err := c.Object(object.DefaultBucket, "dir/bar.txt"); err == nil {
+		t.Fatal("object in deleted directory was not deleted")
+	}
+}
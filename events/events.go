@@ -0,0 +1,239 @@
+// Package events implements an in-memory bus that distributes node events to
+// subscribers.
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/siad/types"
+)
+
+// Event types.
+const (
+	TypeBlock            = "block"
+	TypeReorg            = "reorg"
+	TypeWalletConfirmed  = "wallet.confirmed"
+	TypeContractFormed   = "contract.formed"
+	TypeContractRenewed  = "contract.renewed"
+	TypeContractExpiring = "contract.expiring"
+	TypeHostOffline      = "host.offline"
+	TypeUploadFinished   = "upload.finished"
+	TypeDownloadFinished = "download.finished"
+	TypeRepairFinished   = "repair.finished"
+	TypeObjectCreated    = "object.created"
+	TypeObjectDeleted    = "object.deleted"
+)
+
+// Types lists every event type.
+var Types = []string{
+	TypeBlock,
+	TypeReorg,
+	TypeWalletConfirmed,
+	TypeContractFormed,
+	TypeContractRenewed,
+	TypeContractExpiring,
+	TypeHostOffline,
+	TypeUploadFinished,
+	TypeDownloadFinished,
+	TypeRepairFinished,
+	TypeObjectCreated,
+	TypeObjectDeleted,
+}
+
+// TypeReset is the type of the marker sent to a subscriber that resumes from an
+// event whose successors were not all retained, for example because the node
+// has restarted since. The events that follow it may not include everything
+// that was published in between. It is never published to a bus.
+const TypeReset = "reset"
+
+// KnownType returns true if typ is one of the event types.
+func KnownType(typ string) bool {
+	for _, t := range Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// An Event is a notable occurrence within the node.
+type Event struct {
+	// ID increases with each event published by a bus. The high 32 bits of
+	// an ID are the Unix time at which the bus was created, so IDs keep
+	// increasing when the node restarts.
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Block is the data of a TypeBlock event, published for each block added to
+// the chain.
+type Block struct {
+	Index consensus.ChainIndex `json:"index"`
+}
+
+// Reorg is the data of a TypeReorg event, published when blocks are removed
+// from the chain. The blocks that replace them are published as TypeBlock
+// events.
+type Reorg struct {
+	Reverted []consensus.ChainIndex `json:"reverted"`
+}
+
+// WalletConfirmed is the data of a TypeWalletConfirmed event, published when a
+// transaction tracked by the wallet is included in a block.
+type WalletConfirmed struct {
+	ID     types.TransactionID `json:"id"`
+	Height uint64              `json:"height"`
+}
+
+// Contract is the data of the TypeContractFormed, TypeContractRenewed, and
+// TypeContractExpiring events.
+type Contract struct {
+	ID      types.FileContractID `json:"id"`
+	HostKey consensus.PublicKey  `json:"hostKey"`
+	// RenewedFrom is the ID of the contract that was renewed, if any.
+	RenewedFrom types.FileContractID `json:"renewedFrom,omitempty"`
+	EndHeight   uint64               `json:"endHeight"`
+}
+
+// HostOffline is the data of a TypeHostOffline event, published when a host
+// that was last reachable fails to respond to a scan.
+type HostOffline struct {
+	HostKey consensus.PublicKey `json:"hostKey"`
+	HostIP  string              `json:"hostIP"`
+	Error   string              `json:"error"`
+}
+
+// Transfer is the data of the TypeUploadFinished, TypeDownloadFinished, and
+// TypeRepairFinished events. Error is empty if the transfer succeeded.
+type Transfer struct {
+	Slabs int    `json:"slabs"`
+	Bytes int64  `json:"bytes,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Object is the data of the TypeObjectCreated and TypeObjectDeleted events.
+type Object struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+// DefaultBacklog is the default number of events retained by a bus for
+// subscribers that resume from an earlier event.
+const DefaultBacklog = 1000
+
+// subscriberBuffer is the number of events that may be queued for a
+// subscriber before it is considered too slow and dropped.
+const subscriberBuffer = 64
+
+// A Subscription receives the events published to a bus.
+type Subscription struct {
+	// Missed holds the retained events published after the ID passed to
+	// Subscribe, oldest first.
+	Missed []Event
+	// LastID is the ID of the last event published before the subscription
+	// began, or the ID preceding the bus's first event if there is none.
+	LastID uint64
+	// Reset is true if the events published after the ID passed to Subscribe
+	// are not all in Missed: either they were not retained, or the ID was not
+	// issued by the bus, for example because the node has restarted since.
+	Reset bool
+	// C receives each subsequent event. It is closed when the subscription is
+	// closed, or if the subscriber falls too far behind; the subscriber may
+	// then resubscribe from the last event it received.
+	C <-chan Event
+
+	b  *Bus
+	ch chan Event
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	if _, ok := s.b.subs[s]; ok {
+		delete(s.b.subs, s)
+		close(s.ch)
+	}
+}
+
+// A Bus distributes published events to its subscribers, retaining the most
+// recent events so that subscribers can resume after disconnecting.
+type Bus struct {
+	mu      sync.Mutex
+	lastID  uint64
+	backlog []Event
+	size    int
+	subs    map[*Subscription]struct{}
+}
+
+// Publish publishes an event with the specified type and data, which must be
+// JSON-encodable.
+func (b *Bus) Publish(typ string, data interface{}) {
+	js, _ := json.Marshal(data)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	e := Event{
+		ID:        b.lastID,
+		Type:      typ,
+		Timestamp: time.Now(),
+		Data:      js,
+	}
+	if b.size > 0 {
+		if len(b.backlog) == b.size {
+			copy(b.backlog, b.backlog[1:])
+			b.backlog = b.backlog[:len(b.backlog)-1]
+		}
+		b.backlog = append(b.backlog, e)
+	}
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events published after lastID. The
+// retained events that were already published are returned in the
+// subscription's Missed field.
+func (b *Bus) Subscribe(lastID uint64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscription{
+		LastID: b.lastID,
+		C:      ch,
+		b:      b,
+		ch:     ch,
+	}
+	if lastID > b.lastID {
+		s.Reset = true
+	} else if lastID < b.lastID {
+		s.Reset = len(b.backlog) == 0 || b.backlog[0].ID > lastID+1
+	}
+	for _, e := range b.backlog {
+		if e.ID > lastID {
+			s.Missed = append(s.Missed, e)
+		}
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// NewBus returns a bus that retains the specified number of events.
+func NewBus(backlog int) *Bus {
+	return &Bus{
+		lastID:  uint64(time.Now().Unix()) << 32,
+		backlog: make([]Event, 0, backlog),
+		size:    backlog,
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
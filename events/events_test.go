@@ -0,0 +1,64 @@
+package events_test
+
+import (
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/events"
+)
+
+func TestBus(t *testing.T) {
+	b := events.NewBus(3)
+	base := b.Subscribe(0).LastID
+	if epoch := int64(base >> 32); time.Since(time.Unix(epoch, 0)) > time.Minute {
+		t.Fatalf("IDs should begin with the bus's creation time, got %v", base)
+	}
+	for i := 0; i < 5; i++ {
+		b.Publish(events.TypeBlock, events.Block{})
+	}
+
+	// only the retained events after lastID are missed
+	sub := b.Subscribe(base + 2)
+	if sub.LastID != base+5 {
+		t.Fatalf("expected last ID %v, got %v", base+5, sub.LastID)
+	} else if len(sub.Missed) != 3 || sub.Missed[0].ID != base+3 || sub.Reset {
+		t.Fatalf("expected events 3 through 5 to be missed, got %+v", sub.Missed)
+	}
+	b.Publish(events.TypeReorg, events.Reorg{})
+	if e := <-sub.C; e.ID != base+6 || e.Type != events.TypeReorg {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("closed subscription should not receive events")
+	}
+	sub.Close()
+
+	// resuming from an event whose successors were not retained, or that the
+	// bus did not issue, should reset the subscriber
+	for _, lastID := range []uint64{base + 1, base - 10, base + 100} {
+		sub := b.Subscribe(lastID)
+		if !sub.Reset {
+			t.Errorf("expected resuming from %v to reset", lastID)
+		}
+		sub.Close()
+	}
+	if sub := b.Subscribe(base + 6); sub.Reset {
+		t.Error("resuming from the last event should not reset")
+	} else {
+		sub.Close()
+	}
+
+	// subscribers that fall behind are dropped
+	sub = b.Subscribe(base + 6)
+	for i := 0; i < 100; i++ {
+		b.Publish(events.TypeBlock, events.Block{})
+	}
+	var n int
+	for range sub.C {
+		n++
+	}
+	if n == 0 || n == 100 {
+		t.Fatalf("expected slow subscriber to be dropped after some events, got %v", n)
+	}
+}
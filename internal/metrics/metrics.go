@@ -0,0 +1,348 @@
+// Package metrics implements counters, gauges, and histograms that can be
+// exported in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the content type of the exposition format written by
+// (*Registry).WriteTo.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the default histogram buckets, suited to latencies
+// measured in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metric types.
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// A series is a single labelled instance of a metric.
+type series struct {
+	labels []string
+
+	mu     sync.Mutex
+	value  float64  // counters and gauges
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// A family is a metric and all of its series.
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %v has %v labels, got %v values", f.name, len(f.labels), len(values))) // developer error
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if f.typ == typeHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	ss := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		ss = append(ss, s)
+	}
+	f.mu.Unlock()
+	if len(ss) == 0 {
+		return
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		return strings.Join(ss[i].labels, "\xff") < strings.Join(ss[j].labels, "\xff")
+	})
+
+	fmt.Fprintf(w, "# HELP %v %v\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %v %v\n", f.name, f.typ)
+	for _, s := range ss {
+		s.mu.Lock()
+		if f.typ != typeHistogram {
+			writeSample(w, f.name, f.labels, s.labels, "", "", s.value)
+			s.mu.Unlock()
+			continue
+		}
+		var cumulative uint64
+		for i, b := range f.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, f.name+"_bucket", f.labels, s.labels, "le", formatFloat(b), float64(cumulative))
+		}
+		writeSample(w, f.name+"_bucket", f.labels, s.labels, "le", "+Inf", float64(s.count))
+		writeSample(w, f.name+"_sum", f.labels, s.labels, "", "", s.sum)
+		writeSample(w, f.name+"_count", f.labels, s.labels, "", "", float64(s.count))
+		s.mu.Unlock()
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%v=\"%v\"", labels[i], escapeLabel(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%v=\"%v\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// A Counter is a value that only increases.
+type Counter struct {
+	s *series
+}
+
+// Add increases the counter by v, which must not be negative.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("counters cannot decrease") // developer error
+	}
+	c.s.mu.Lock()
+	c.s.value += v
+	c.s.mu.Unlock()
+}
+
+// Inc increments the counter.
+func (c *Counter) Inc() { c.Add(1) }
+
+// A CounterVec is a set of counters distinguished by their label values.
+type CounterVec struct {
+	f *family
+}
+
+// With returns the counter with the specified label values, creating it if
+// necessary.
+func (v *CounterVec) With(values ...string) *Counter {
+	return &Counter{v.f.with(values)}
+}
+
+// A Gauge is a value that can increase and decrease.
+type Gauge struct {
+	s *series
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.s.mu.Lock()
+	g.s.value = v
+	g.s.mu.Unlock()
+}
+
+// Add adds v to the gauge.
+func (g *Gauge) Add(v float64) {
+	g.s.mu.Lock()
+	g.s.value += v
+	g.s.mu.Unlock()
+}
+
+// Inc increments the gauge.
+func (g *Gauge) Inc() { g.Add(1) }
+
+// Dec decrements the gauge.
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// A GaugeVec is a set of gauges distinguished by their label values.
+type GaugeVec struct {
+	f *family
+}
+
+// With returns the gauge with the specified label values, creating it if
+// necessary.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{v.f.with(values)}
+}
+
+// A Histogram counts observations in buckets.
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// Observe records an observation.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	if i < len(h.buckets) {
+		h.s.counts[i]++
+	}
+	h.s.sum += v
+	h.s.count++
+}
+
+// ObserveSince records the number of seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// A HistogramVec is a set of histograms distinguished by their label values.
+type HistogramVec struct {
+	f *family
+}
+
+// With returns the histogram with the specified label values, creating it if
+// necessary.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{v.f.with(values), v.f.buckets}
+}
+
+// A Registry is a set of metrics.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func (r *Registry) register(name, help, typ string, buckets []float64, labels []string) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[name]; ok {
+		panic(fmt.Sprintf("metric %v registered twice", name)) // developer error
+	}
+	r.families[name] = f
+	return f
+}
+
+// NewCounter registers and returns an unlabelled counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+// NewCounterVec registers and returns a set of counters with the specified
+// labels.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, typeCounter, nil, labels)}
+}
+
+// NewGauge registers and returns an unlabelled gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+// NewGaugeVec registers and returns a set of gauges with the specified labels.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, typeGauge, nil, labels)}
+}
+
+// NewHistogram registers and returns an unlabelled histogram with the
+// specified bucket upper bounds, which must be sorted.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+// NewHistogramVec registers and returns a set of histograms with the specified
+// bucket upper bounds, which must be sorted, and labels.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{r.register(name, help, typeHistogram, buckets, labels)}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// WriteTo writes every metric with at least one series to w, in the
+// Prometheus text exposition format. Unlabelled metrics always have one series.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	fs := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		fs = append(fs, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(fs, func(i, j int) bool {
+		return fs[i].name < fs[j].name
+	})
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range fs {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+// Default is the registry of the metrics recorded by the node's packages.
+var Default = NewRegistry()
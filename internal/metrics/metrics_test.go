@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_requests_total", "Requests served.", "route")
+	g := r.NewGauge("test_streams", "Open streams.")
+	h := r.NewHistogram("test_duration_seconds", "Request duration.", []float64{0.1, 1})
+	r.NewGauge("test_idle", "Never changed.")
+
+	c.With("/foo").Inc()
+	c.With("/foo").Add(2)
+	c.With(`/"bar"`).Inc()
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	var sb strings.Builder
+	if _, err := r.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	exp := `# HELP test_duration_seconds Request duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 5.55
+test_duration_seconds_count 3
+# HELP test_idle Never changed.
+# TYPE test_idle gauge
+test_idle 0
+# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{route="/\"bar\""} 1
+test_requests_total{route="/foo"} 3
+# HELP test_streams Open streams.
+# TYPE test_streams gauge
+test_streams 1
+`
+	if sb.String() != exp {
+		t.Fatalf("unexpected exposition:\n%v\nexpected:\n%v", sb.String(), exp)
+	}
+}
@@ -10,6 +10,13 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"go.sia.tech/renterd/internal/metrics"
+)
+
+var (
+	streamsOpened = metrics.Default.NewCounterVec("renterd_mux_streams_opened_total", "Mux streams opened, by whether they were dialed or accepted.", "direction")
+	streamsOpen   = metrics.Default.NewGauge("renterd_mux_streams_open", "Mux streams that have been opened and not yet closed.")
 )
 
 // Errors relating to stream or mux shutdown.
@@ -217,6 +224,8 @@ func (m *Mux) AcceptStream() (*Stream, error) {
 		for _, s := range m.streams {
 			if !s.accepted {
 				s.accepted = true
+				streamsOpened.With("accept").Inc()
+				streamsOpen.Inc()
 				return s, nil
 			}
 		}
@@ -248,6 +257,8 @@ func (m *Mux) DialStream() *Stream {
 	s.id = m.nextID
 	m.nextID += 2
 	m.streams[s.id] = s
+	streamsOpened.With("dial").Inc()
+	streamsOpen.Inc()
 	return s
 }
 
@@ -311,6 +322,7 @@ type Stream struct {
 
 	cond    sync.Cond // guards + synchronizes subsequent fields
 	err     error
+	closed  bool
 	readBuf []byte
 	rd, wd  time.Time // deadlines
 }
@@ -451,6 +463,10 @@ func (s *Stream) Close() error {
 	defer s.cond.L.Unlock()
 	s.err = ErrClosedStream
 	s.cond.Broadcast()
+	if !s.closed {
+		s.closed = true
+		streamsOpen.Dec()
+	}
 	return err
 }
 
@@ -0,0 +1,307 @@
+// Package siad reads the renter metadata of a siad node and translates it into
+// renterd's types.
+package siad
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/encoding"
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/object"
+	rhpv2 "go.sia.tech/renterd/rhp/v2"
+	"go.sia.tech/renterd/slab"
+	"go.sia.tech/siad/types"
+)
+
+// siafile format constants
+const (
+	pageSize           = 4096
+	marshaledPieceSize = 4 + 4 + 32
+	chunkOverhead      = 16 + 1 + 2 // extension info, stuck flag, piece count
+)
+
+var (
+	typeXChaCha20       = [8]byte{7: 4}
+	ecReedSolomonStripe = [4]byte{3: 2}
+)
+
+// siafileMetadata contains the fields of siad's siafile metadata that are
+// required to locate a file's data.
+type siafileMetadata struct {
+	FileSize          int64           `json:"filesize"`
+	PieceSize         uint64          `json:"piecesize"`
+	PagesPerChunk     uint8           `json:"pagesperchunk"`
+	MasterKey         []byte          `json:"masterkey"`
+	MasterKeyType     [8]byte         `json:"masterkeytype"`
+	HasPartialChunk   bool            `json:"haspartialchunk"`
+	PartialChunks     json.RawMessage `json:"partialchunks"`
+	ModTime           time.Time       `json:"modtime"`
+	CreateTime        time.Time       `json:"createtime"`
+	ChunkOffset       int64           `json:"chunkoffset"`
+	PubKeyTableOffset int64           `json:"pubkeytableoffset"`
+	ErasureCodeType   [4]byte         `json:"erasurecodetype"`
+	ErasureCodeParams [8]byte         `json:"erasurecodeparams"`
+}
+
+// readPubKeyTable reads the table of host keys referenced by a siafile's
+// pieces.
+func readPubKeyTable(f io.ReaderAt, md siafileMetadata) ([]consensus.PublicKey, error) {
+	if md.PubKeyTableOffset < 0 || md.ChunkOffset < md.PubKeyTableOffset {
+		return nil, errors.New("invalid host key table offset")
+	}
+	buf := make([]byte, md.ChunkOffset-md.PubKeyTableOffset)
+	if _, err := f.ReadAt(buf, md.PubKeyTableOffset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var table []consensus.PublicKey
+	r := bytes.NewReader(buf)
+	d := encoding.NewDecoder(r, encoding.DefaultAllocLimit)
+	for r.Len() > 0 {
+		var spk types.SiaPublicKey
+		d.Decode(&spk)
+		d.NextBool() // whether the host is still used
+		if err := d.Err(); err != nil {
+			return nil, err
+		}
+		var pk consensus.PublicKey
+		if spk.Algorithm == types.SignatureEd25519 && len(spk.Key) == len(pk) {
+			copy(pk[:], spk.Key)
+		}
+		table = append(table, pk)
+	}
+	return table, nil
+}
+
+// readChunkPieces reads the pieces of chunk i, returning the first sector
+// uploaded for each piece index. Indices without an uploaded piece have a zero
+// Sector.
+func readChunkPieces(f io.ReaderAt, md siafileMetadata, table []consensus.PublicKey, i int64, numPieces int) ([]slab.Sector, error) {
+	buf := make([]byte, int64(md.PagesPerChunk)*pageSize)
+	n, err := f.ReadAt(buf, md.ChunkOffset+i*int64(len(buf)))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	sectors := make([]slab.Sector, numPieces)
+	if n < chunkOverhead {
+		return sectors, nil // the chunk was never written
+	}
+	buf = buf[:n]
+	count := int(binary.LittleEndian.Uint16(buf[17:]))
+	pieces := buf[chunkOverhead:]
+	if len(pieces) < count*marshaledPieceSize {
+		return nil, fmt.Errorf("chunk %v is truncated", i)
+	}
+	for j := 0; j < count; j++ {
+		p := pieces[j*marshaledPieceSize:][:marshaledPieceSize]
+		index := binary.LittleEndian.Uint32(p[0:])
+		offset := binary.LittleEndian.Uint32(p[4:])
+		if int(index) >= numPieces {
+			return nil, fmt.Errorf("chunk %v has out-of-range piece index %v", i, index)
+		} else if int(offset) >= len(table) || table[offset] == (consensus.PublicKey{}) {
+			return nil, fmt.Errorf("chunk %v references unknown host %v", i, offset)
+		} else if sectors[index] != (slab.Sector{}) {
+			continue // renterd stores each shard on a single host
+		}
+		sectors[index].Host = table[offset]
+		copy(sectors[index].Root[:], p[8:])
+	}
+	return sectors, nil
+}
+
+// ReadSiaFile reads the siafile at path and translates it into an object whose
+// slabs are the file's chunks. Pieces that siad never uploaded are represented
+// by a zero Sector, which will be replaced when the slab is migrated. Files
+// that renterd cannot download, such as those using an old erasure code or
+// cipher, or those missing too many pieces, return an error.
+func ReadSiaFile(path string) (object.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return object.Object{}, err
+	}
+	defer f.Close()
+	var md siafileMetadata
+	if err := json.NewDecoder(f).Decode(&md); err != nil {
+		return object.Object{}, fmt.Errorf("could not decode metadata: %w", err)
+	}
+
+	minPieces := binary.LittleEndian.Uint32(md.ErasureCodeParams[:4])
+	numPieces := minPieces + binary.LittleEndian.Uint32(md.ErasureCodeParams[4:])
+	switch {
+	case md.ErasureCodeType != ecReedSolomonStripe:
+		return object.Object{}, errors.New("file uses a legacy erasure code")
+	case minPieces == 0 || numPieces > 255:
+		return object.Object{}, fmt.Errorf("unsupported redundancy %v-of-%v", minPieces, numPieces)
+	case md.MasterKeyType != typeXChaCha20 || len(md.MasterKey) != 56:
+		return object.Object{}, errors.New("file uses a legacy cipher")
+	case md.PieceSize != rhpv2.SectorSize:
+		return object.Object{}, fmt.Errorf("unsupported piece size %v", md.PieceSize)
+	case md.HasPartialChunk || (len(md.PartialChunks) > 0 && string(md.PartialChunks) != "null"):
+		return object.Object{}, errors.New("file has a partial chunk")
+	case md.PagesPerChunk == 0 || md.FileSize < 0:
+		return object.Object{}, errors.New("invalid metadata")
+	}
+	table, err := readPubKeyTable(f, md)
+	if err != nil {
+		return object.Object{}, fmt.Errorf("could not read host key table: %w", err)
+	}
+
+	var masterKey [56]byte
+	copy(masterKey[:], md.MasterKey)
+	chunkSize := int64(md.PieceSize) * int64(minPieces)
+	o := object.Object{
+		Key: object.NoOpKey,
+		Metadata: object.Metadata{
+			Created:  md.CreateTime,
+			Modified: md.ModTime,
+		},
+	}
+	for i := int64(0); i*chunkSize < md.FileSize; i++ {
+		sectors, err := readChunkPieces(f, md, table, i, int(numPieces))
+		if err != nil {
+			return object.Object{}, err
+		}
+		var available uint32
+		for _, s := range sectors {
+			if s != (slab.Sector{}) {
+				available++
+			}
+		}
+		if available < minPieces {
+			return object.Object{}, fmt.Errorf("chunk %v is unrecoverable: only %v of %v required pieces were uploaded", i, available, minPieces)
+		}
+		length := md.FileSize - i*chunkSize
+		if length > chunkSize {
+			length = chunkSize
+		}
+		o.Slabs = append(o.Slabs, slab.Slice{
+			Slab: slab.Slab{
+				Key:       slab.SiadEncryptionKey(masterKey, uint64(i)),
+				MinShards: uint8(minPieces),
+				Shards:    sectors,
+			},
+			Offset: 0,
+			Length: uint32(length),
+		})
+	}
+	return o, nil
+}
+
+// A Contract is a contract imported from siad, along with the key that must
+// be used to revise it.
+type Contract struct {
+	rhpv2.Contract
+	RenterKey consensus.PrivateKey
+}
+
+// ReadContractHeader reads the contract header file at path, as written by
+// siad's contractor.
+func ReadContractHeader(path string) (Contract, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Contract{}, err
+	}
+	defer f.Close()
+	// the transaction and secret key prefix every version of the header, so
+	// the remaining fields can be ignored
+	var txn types.Transaction
+	var sk [64]byte
+	d := encoding.NewDecoder(f, encoding.DefaultAllocLimit)
+	if err := d.DecodeAll(&txn, &sk); err != nil {
+		return Contract{}, fmt.Errorf("could not decode contract header: %w", err)
+	} else if len(txn.FileContractRevisions) == 0 {
+		return Contract{}, errors.New("contract header has no revision")
+	}
+	rev := txn.FileContractRevisions[0]
+	if len(rev.UnlockConditions.PublicKeys) != 2 {
+		return Contract{}, errors.New("contract has wrong number of public keys")
+	}
+	c := Contract{
+		Contract:  rhpv2.Contract{Revision: rev},
+		RenterKey: consensus.PrivateKey(sk[:]),
+	}
+	var found [2]bool
+	for _, sig := range txn.TransactionSignatures {
+		if sig.PublicKeyIndex < 2 && types.FileContractID(sig.ParentID) == rev.ParentID {
+			c.Signatures[sig.PublicKeyIndex] = sig
+			found[sig.PublicKeyIndex] = true
+		}
+	}
+	if !found[0] || !found[1] {
+		return Contract{}, errors.New("contract header is missing revision signatures")
+	} else if pk := c.RenterKey.PublicKey(); !bytes.Equal(pk[:], rev.UnlockConditions.PublicKeys[0].Key) {
+		return Contract{}, errors.New("contract secret key does not match renter key")
+	}
+	return c, nil
+}
+
+// An Import is the renter metadata of a siad node.
+type Import struct {
+	// Objects are keyed by siapath.
+	Objects   map[string]object.Object
+	Contracts []Contract
+	// Failed maps the path of each siafile or contract header that could not
+	// be converted, relative to the renter directory, to the reason why.
+	Failed map[string]error
+}
+
+// ImportRenterDir reads the siafiles and contracts within a siad renter
+// directory.
+func ImportRenterDir(dir string) (*Import, error) {
+	imp := &Import{
+		Objects: make(map[string]object.Object),
+		Failed:  make(map[string]error),
+	}
+
+	// siad v1.4.4 moved siafiles from siafiles/ to fs/home/user/
+	filesDir := filepath.Join(dir, "fs", "home", "user")
+	if _, err := os.Stat(filesDir); os.IsNotExist(err) {
+		filesDir = filepath.Join(dir, "siafiles")
+	}
+	err := filepath.Walk(filesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == filesDir {
+				return nil
+			}
+			return err
+		} else if info.IsDir() || filepath.Ext(path) != ".sia" {
+			return nil
+		}
+		rel, _ := filepath.Rel(filesDir, path)
+		o, err := ReadSiaFile(path)
+		if err != nil {
+			failed, _ := filepath.Rel(dir, path)
+			imp.Failed[filepath.ToSlash(failed)] = err
+			return nil
+		}
+		imp.Objects[strings.TrimSuffix(filepath.ToSlash(rel), ".sia")] = o
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := filepath.Glob(filepath.Join(dir, "contracts", "*.header"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(headers)
+	for _, path := range headers {
+		c, err := ReadContractHeader(path)
+		if err != nil {
+			imp.Failed["contracts/"+filepath.Base(path)] = err
+			continue
+		}
+		imp.Contracts = append(imp.Contracts, c)
+	}
+	return imp, nil
+}
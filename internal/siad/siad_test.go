@@ -0,0 +1,87 @@
+package siad
+
+import (
+	"strings"
+	"testing"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/slab"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/types"
+)
+
+func TestImportRenterDir(t *testing.T) {
+	imp, err := ImportRenterDir("testdata/renter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// objects
+	if len(imp.Objects) != 3 {
+		t.Fatalf("expected 3 objects, got %v", len(imp.Objects))
+	}
+	foo, ok := imp.Objects["foo"]
+	if !ok {
+		t.Fatal("missing foo")
+	} else if !foo.Key.IsNoOp() {
+		t.Fatal("imported objects should not be encrypted at the object level")
+	} else if foo.Size() != 2*(1<<22)+100 {
+		t.Fatalf("wrong size %v", foo.Size())
+	} else if len(foo.Slabs) != 2 || foo.Slabs[1].Length != 100 {
+		t.Fatalf("wrong slabs %+v", foo.Slabs)
+	} else if foo.Slabs[0].Key.String() == foo.Slabs[1].Key.String() {
+		t.Fatal("chunks should have distinct keys")
+	}
+	for i, ss := range foo.Slabs {
+		if ss.MinShards != 2 || len(ss.Shards) != 3 {
+			t.Fatalf("wrong redundancy %v-of-%v", ss.MinShards, len(ss.Shards))
+		}
+		for j, s := range ss.Shards {
+			// the fixture's roots are derived from the file, chunk, and piece
+			if s.Root != consensus.Hash256(crypto.HashAll("foo", i, j)) {
+				t.Fatalf("wrong root for chunk %v piece %v", i, j)
+			}
+		}
+	}
+	bar, ok := imp.Objects["dir/bar"]
+	if !ok {
+		t.Fatal("missing dir/bar")
+	} else if shards := bar.Slabs[0].Shards; shards[1] != (slab.Sector{}) || shards[0] == (slab.Sector{}) || shards[2] == (slab.Sector{}) {
+		t.Fatalf("wrong shards %v", shards)
+	}
+	if empty, ok := imp.Objects["empty"]; !ok || len(empty.Slabs) != 0 {
+		t.Fatal("empty file should be imported without slabs")
+	}
+
+	// failures
+	for path, reason := range map[string]string{
+		"fs/home/user/lost.sia":    "unrecoverable",
+		"fs/home/user/legacy.sia":  "erasure code",
+		"fs/home/user/twofish.sia": "cipher",
+		"contracts/0900000000000000000000000000000000000000000000000000000000000000.header": "decode",
+	} {
+		if err, ok := imp.Failed[path]; !ok {
+			t.Errorf("%v should have failed", path)
+		} else if !strings.Contains(err.Error(), reason) {
+			t.Errorf("%v failed for the wrong reason: %v", path, err)
+		}
+	}
+	if len(imp.Failed) != 4 {
+		t.Fatalf("expected 4 failures, got %v", imp.Failed)
+	}
+
+	// contracts
+	if len(imp.Contracts) != 1 {
+		t.Fatalf("expected 1 contract, got %v", len(imp.Contracts))
+	}
+	c := imp.Contracts[0]
+	if c.ID() != (types.FileContractID{1, 2, 3}) {
+		t.Fatalf("wrong contract ID %v", c.ID())
+	} else if c.Revision.NewRevisionNumber != 7 || c.EndHeight() != 1000 {
+		t.Fatalf("wrong revision %+v", c.Revision)
+	} else if c.Signatures[0].PublicKeyIndex != 0 || c.Signatures[1].PublicKeyIndex != 1 {
+		t.Fatal("signatures in wrong order")
+	} else if c.HostKey() != foo.Slabs[0].Shards[0].Host {
+		t.Fatal("contract host should match first host of foo")
+	}
+}
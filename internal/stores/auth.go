@@ -0,0 +1,140 @@
+package stores
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"gitlab.com/NebulousLabs/bolt"
+	"go.sia.tech/renterd/auth"
+)
+
+// EphemeralAuthStore implements auth.Store in memory.
+type EphemeralAuthStore struct {
+	mu   sync.Mutex
+	keys map[string]auth.Key
+}
+
+// Keys implements auth.Store.
+func (s *EphemeralAuthStore) Keys() ([]auth.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]auth.Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Created.Before(keys[j].Created)
+	})
+	return keys, nil
+}
+
+// AddKey implements auth.Store.
+func (s *EphemeralAuthStore) AddKey(k auth.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	return nil
+}
+
+// RemoveKey implements auth.Store.
+func (s *EphemeralAuthStore) RemoveKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[id]; !ok {
+		return errors.New("no API key with that ID")
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+// NewEphemeralAuthStore returns a new EphemeralAuthStore.
+func NewEphemeralAuthStore() *EphemeralAuthStore {
+	return &EphemeralAuthStore{
+		keys: make(map[string]auth.Key),
+	}
+}
+
+// BoltAuthStore implements auth.Store in memory, backed by a bolt database.
+// Every change is persisted before it is applied in memory.
+type BoltAuthStore struct {
+	*EphemeralAuthStore
+	db *bolt.DB
+}
+
+// update persists the changes made by fn. s.mu must be held.
+func (s *BoltAuthStore) update(fn func(tx *bolt.Tx) error) error {
+	return update(s.db, "auth", []string{"keys"}, fn)
+}
+
+func (s *BoltAuthStore) load() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("keys")).ForEach(func(_, js []byte) error {
+			var k auth.Key
+			if err := json.Unmarshal(js, &k); err != nil {
+				return err
+			}
+			s.keys[k.ID] = k
+			return nil
+		})
+	})
+}
+
+// AddKey implements auth.Store.
+func (s *BoltAuthStore) AddKey(k auth.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.update(func(tx *bolt.Tx) error {
+		return putJSON(tx, "keys", k.ID, k)
+	})
+	if err != nil {
+		return err
+	}
+	s.keys[k.ID] = k
+	return nil
+}
+
+// RemoveKey implements auth.Store.
+func (s *BoltAuthStore) RemoveKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[id]; !ok {
+		return errors.New("no API key with that ID")
+	}
+	err := s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("keys")).Delete([]byte(id))
+	})
+	if err != nil {
+		return err
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+// Close closes the underlying database.
+func (s *BoltAuthStore) Close() error {
+	return s.db.Close()
+}
+
+// NewBoltAuthStore returns a new BoltAuthStore.
+func NewBoltAuthStore(dir string) (*BoltAuthStore, error) {
+	db, fresh, err := openBoltDB(dir, "auth")
+	if err != nil {
+		return nil, err
+	}
+	s := &BoltAuthStore{
+		EphemeralAuthStore: NewEphemeralAuthStore(),
+		db:                 db,
+	}
+	if fresh {
+		err = s.update(func(*bolt.Tx) error { return nil })
+	} else {
+		err = s.load()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
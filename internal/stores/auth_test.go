@@ -0,0 +1,48 @@
+package stores
+
+import (
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/auth"
+)
+
+func TestBoltAuthStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewBoltAuthStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := auth.Key{ID: "foo", Scopes: []string{auth.ScopeWallet}, Created: time.Now(), Hash: "bar"}
+	if err := s.AddKey(k); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddKey(auth.Key{ID: "baz"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.RemoveKey("baz"); err != nil {
+		t.Fatal(err)
+	} else if err := s.RemoveKey("baz"); err == nil {
+		t.Fatal("expected removal of unknown key to fail")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// keys should survive a restart
+	s, err = NewBoltAuthStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := s.Keys(); err != nil {
+		t.Fatal(err)
+	} else if len(keys) != 1 || keys[0].ID != k.ID || keys[0].Hash != k.Hash {
+		t.Fatal("key was not persisted:", keys)
+	}
+
+	// a change that cannot be persisted should not be applied
+	s.Close()
+	if err := s.AddKey(auth.Key{ID: "qux"}); err == nil {
+		t.Fatal("expected write to closed database to fail")
+	} else if keys, _ := s.Keys(); len(keys) != 1 {
+		t.Fatal("unpersisted key was added:", keys)
+	}
+}
@@ -0,0 +1,206 @@
+package stores
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/object"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+	"lukechampine.com/frand"
+)
+
+const backupVersion = 1
+
+// A backupSnapshot is a consistent copy of a node's metadata.
+type backupSnapshot struct {
+	Version   int
+	Created   time.Time
+	Objects   jsonObjectPersistData
+	Contracts jsonContractsPersistData
+	HostDB    jsonHostDBPersistData
+}
+
+// validate checks that every reference within the snapshot can be resolved.
+func (bs *backupSnapshot) validate() error {
+	if bs.Version != backupVersion {
+		return fmt.Errorf("unsupported backup version %v", bs.Version)
+	}
+	p := &bs.Objects
+	if _, ok := p.Buckets[object.DefaultBucket]; !ok {
+		return errors.New("backup does not contain the default bucket")
+	}
+	checkSectors := func(sectors []refSector) error {
+		for _, sector := range sectors {
+			if int(sector.HostID) >= len(p.Hosts) {
+				return fmt.Errorf("sector references unknown host %v", sector.HostID)
+			}
+		}
+		return nil
+	}
+	checkObject := func(key string, ro refObject) error {
+		if _, ok := p.Buckets[bucketOf(key)]; !ok {
+			return fmt.Errorf("object %q is in an unknown bucket", key)
+		}
+		for _, rs := range ro.Slabs {
+			if _, ok := p.Slabs[rs.SlabID.String()]; !ok {
+				return fmt.Errorf("object %q references unknown slab %v", key, rs.SlabID)
+			}
+		}
+		return nil
+	}
+	for id, rs := range p.Slabs {
+		if err := checkSectors(rs.Shards); err != nil {
+			return fmt.Errorf("slab %v: %w", id, err)
+		}
+	}
+	if err := checkSectors(p.Garbage); err != nil {
+		return fmt.Errorf("garbage: %w", err)
+	}
+	for key, ro := range p.Objects {
+		if err := checkObject(key, ro); err != nil {
+			return err
+		}
+	}
+	for key, vs := range p.Versions {
+		for _, v := range vs {
+			if err := checkObject(key, v.Object); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A BackupManager creates and restores encrypted snapshots of the metadata of
+// a node: its objects, contracts, host sets, and hostdb.
+type BackupManager struct {
+	key [32]byte
+	os  *BoltObjectStore
+	cs  *BoltContractStore
+	hdb *BoltHostDB
+}
+
+// lock locks the journals of each store, preventing any mutations.
+func (bm *BackupManager) lock() {
+	bm.os.journal.mu.Lock()
+	bm.cs.journal.mu.Lock()
+	bm.hdb.journal.mu.Lock()
+}
+
+func (bm *BackupManager) unlock() {
+	bm.hdb.journal.mu.Unlock()
+	bm.cs.journal.mu.Unlock()
+	bm.os.journal.mu.Unlock()
+}
+
+// Backup implements api.BackupStore. The snapshot is compressed and then
+// encrypted with a key derived from the wallet seed.
+func (bm *BackupManager) Backup() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	bm.lock()
+	bs := backupSnapshot{
+		Version: backupVersion,
+		Created: time.Now().UTC(),
+		Objects: bm.os.persistData(),
+		HostDB:  jsonHostDBPersistData{bm.hdb.tip, bm.hdb.ccid, bm.hdb.hosts},
+	}
+	for _, c := range bm.cs.contracts {
+		bs.Contracts.Contracts = append(bs.Contracts.Contracts, c)
+	}
+	bs.Contracts.HostSets = bm.cs.hostSets
+	err := json.NewEncoder(zw).Encode(bs)
+	bm.unlock()
+	if err != nil {
+		return nil, err
+	} else if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	aead, _ := chacha20poly1305.NewX(bm.key[:])
+	nonce := frand.Bytes(aead.NonceSize())
+	return aead.Seal(nonce, nonce, buf.Bytes(), nil), nil
+}
+
+// Restore implements api.BackupStore. The node must not have any objects or
+// contracts; hosts in the backup are merged into the hostdb.
+func (bm *BackupManager) Restore(backup []byte) error {
+	aead, _ := chacha20poly1305.NewX(bm.key[:])
+	if len(backup) < aead.NonceSize() {
+		return errors.New("backup is too short")
+	}
+	nonce, ciphertext := backup[:aead.NonceSize()], backup[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return errors.New("could not decrypt backup; was it created with a different seed?")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(plaintext))
+	if err != nil {
+		return err
+	}
+	var bs backupSnapshot
+	if err := json.NewDecoder(io.LimitReader(zr, 1<<32)).Decode(&bs); err != nil {
+		return fmt.Errorf("could not decode backup: %w", err)
+	} else if err := bs.validate(); err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+
+	bm.lock()
+	defer bm.unlock()
+	if len(bm.os.objects) > 0 || len(bm.os.versions) > 0 || len(bm.os.slabs) > 0 {
+		return errors.New("cannot restore backup: node already has objects")
+	} else if len(bm.cs.contracts) > 0 || len(bm.cs.hostSets) > 0 {
+		return errors.New("cannot restore backup: node already has contracts")
+	}
+
+	// readers only hold the stores' own locks, so those must be held while
+	// the state is replaced
+	bm.os.mu.Lock()
+	if err := bm.os.setPersistData(bs.Objects); err != nil {
+		bm.os.mu.Unlock()
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	bm.os.markAll()
+	bm.os.mu.Unlock()
+	bm.cs.mu.Lock()
+	for _, c := range bs.Contracts.Contracts {
+		id := c.ID()
+		bm.cs.contracts[id] = c
+		bm.cs.changes.mark("contracts", string(id[:]))
+	}
+	for name, hosts := range bs.Contracts.HostSets {
+		bm.cs.hostSets[name] = hosts
+		bm.cs.changes.mark("hostsets", name)
+	}
+	bm.cs.mu.Unlock()
+	bm.hdb.mu.Lock()
+	for hostKey, h := range bs.HostDB.Hosts {
+		bm.hdb.hosts[hostKey] = h
+		bm.hdb.changes.mark("hosts", string(hostKey[:]))
+	}
+	bm.hdb.mu.Unlock()
+	if err := bm.os.journal.checkpoint(bm.os); err != nil {
+		return err
+	} else if err := bm.cs.journal.checkpoint(bm.cs); err != nil {
+		return err
+	}
+	return bm.hdb.journal.checkpoint(bm.hdb)
+}
+
+// NewBackupManager returns a BackupManager for the supplied stores, which
+// encrypts backups with a key derived from walletKey.
+func NewBackupManager(walletKey consensus.PrivateKey, os *BoltObjectStore, cs *BoltContractStore, hdb *BoltHostDB) *BackupManager {
+	return &BackupManager{
+		key: blake2b.Sum256(append([]byte("renterd/backup"), walletKey[:32]...)),
+		os:  os,
+		cs:  cs,
+		hdb: hdb,
+	}
+}
@@ -0,0 +1,82 @@
+package stores
+
+import (
+	"reflect"
+	"testing"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+func newTestBackupManager(t *testing.T, walletKey consensus.PrivateKey) *BackupManager {
+	t.Helper()
+	dir := t.TempDir()
+	os, err := NewBoltObjectStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Close() })
+	cs, err := NewBoltContractStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Close() })
+	hdb, _, err := NewBoltHostDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hdb.Close() })
+	return NewBackupManager(walletKey, os, cs, hdb)
+}
+
+func TestBackup(t *testing.T) {
+	walletKey := consensus.GeneratePrivateKey()
+	src := newTestBackupManager(t, walletKey)
+	obj := randomObject()
+	if err := src.os.Put(object.DefaultBucket, "/foo", obj); err != nil {
+		t.Fatal(err)
+	}
+	hostKey := consensus.PublicKey(frand.Entropy256())
+	if err := src.cs.SetHostSet("set", []consensus.PublicKey{hostKey}); err != nil {
+		t.Fatal(err)
+	} else if err := src.hdb.SetScore(hostKey, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := src.os.Get(object.DefaultBucket, "/foo")
+	backup, err := src.Backup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a node with a different seed should not be able to restore it
+	other := newTestBackupManager(t, consensus.GeneratePrivateKey())
+	if err := other.Restore(backup); err == nil {
+		t.Fatal("expected restore with different seed to fail")
+	}
+
+	// neither should a node with existing objects
+	if err := src.Restore(backup); err == nil {
+		t.Fatal("expected restore into non-empty node to fail")
+	}
+
+	// tampered backups should be rejected
+	tampered := append([]byte(nil), backup...)
+	tampered[len(tampered)-1] ^= 1
+	dst := newTestBackupManager(t, walletKey)
+	if err := dst.Restore(tampered); err == nil {
+		t.Fatal("expected tampered backup to be rejected")
+	}
+
+	if err := dst.Restore(backup); err != nil {
+		t.Fatal(err)
+	} else if got, err := dst.os.Get(object.DefaultBucket, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Fatal("restored object does not match")
+	} else if hosts := dst.cs.HostSet("set"); len(hosts) != 1 || hosts[0] != hostKey {
+		t.Fatal("host set was not restored")
+	} else if h, _ := dst.hdb.Host(hostKey); h.Score != 0.5 {
+		t.Fatal("host was not restored")
+	}
+}
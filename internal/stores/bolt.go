@@ -0,0 +1,278 @@
+// Package stores implements the node's persistent stores.
+//
+// The bolt-backed stores keep their state in memory, where most queries are
+// served, and persist it to a database. Stores whose mutations are frequent
+// record them in a journal, which is fsynced before each mutation is applied
+// in memory and periodically checkpointed to the database. The remaining
+// stores write each mutation to the database before applying it in memory, so
+// a failed write leaves both unchanged.
+//
+// Tables can have secondary indexes, which are updated in the same
+// transaction as the rows they index. Queries that select rows by an indexed
+// field, such as wallet transactions by timestamp and hosts by score, are
+// served from the database by scanning the index, after any outstanding
+// changes have been written.
+package stores
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/NebulousLabs/bolt"
+	"go.sia.tech/renterd/internal/metrics"
+)
+
+var storeOpDurations = metrics.Default.NewHistogramVec("renterd_store_operation_duration_seconds", "Duration of store operations that are persisted to disk.", metrics.DefaultBuckets, "store", "op")
+
+// observeStoreOp records the duration of a persisted store operation that began
+// at start.
+func observeStoreOp(store, op string, start time.Time) {
+	storeOpDurations.With(store, op).ObserveSince(start)
+}
+
+// A changeSet records which entries of an in-memory store have been modified
+// since they were last persisted, keyed by table.
+type changeSet map[string]map[string]bool
+
+func (cs changeSet) mark(table, key string) {
+	if cs == nil {
+		return // store is not persisted
+	}
+	if cs[table] == nil {
+		cs[table] = make(map[string]bool)
+	}
+	cs[table][key] = true
+}
+
+// write persists the marked entries, deleting those for which value returns
+// false, and updates the indexes of their tables.
+func (cs changeSet) write(tx *bolt.Tx, indexes []index, value func(table, key string) (interface{}, bool)) error {
+	for table, keys := range cs {
+		b := tx.Bucket([]byte(table))
+		var ixs []index
+		for _, ix := range indexes {
+			if ix.table == table {
+				ixs = append(ixs, ix)
+			}
+		}
+		for key := range keys {
+			for _, ix := range ixs {
+				if err := ix.remove(tx, []byte(key), b.Get([]byte(key))); err != nil {
+					return err
+				}
+			}
+			v, ok := value(table, key)
+			if !ok {
+				if err := b.Delete([]byte(key)); err != nil {
+					return err
+				}
+				continue
+			}
+			js, err := json.Marshal(v)
+			if err != nil {
+				return err
+			} else if err := b.Put([]byte(key), js); err != nil {
+				return err
+			}
+			for _, ix := range ixs {
+				if err := ix.add(tx, []byte(key), js); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// An index orders the rows of a table by a secondary key derived from each
+// row. It is stored in its own table, whose keys are a row's secondary key
+// followed by its primary key, and whose values are the primary key; since
+// bolt keys are sorted, a cursor over the index visits rows in secondary key
+// order, with ties broken by primary key.
+type index struct {
+	table string
+	name  string
+	// key returns the secondary key of an encoded row. Secondary keys must
+	// all have the same length.
+	key func(js []byte) ([]byte, error)
+}
+
+func (ix index) tableName() []byte {
+	return []byte(ix.table + "." + ix.name)
+}
+
+func (ix index) entry(key, js []byte) ([]byte, error) {
+	sk, err := ix.key(js)
+	if err != nil {
+		return nil, fmt.Errorf("could not index %v by %v: %w", ix.table, ix.name, err)
+	}
+	return append(sk, key...), nil
+}
+
+// add indexes the row with primary key key and encoding js.
+func (ix index) add(tx *bolt.Tx, key, js []byte) error {
+	e, err := ix.entry(key, js)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(ix.tableName()).Put(e, key)
+}
+
+// remove removes the index entry of the row with primary key key and encoding
+// js. If js is nil, the row does not exist, and there is nothing to remove.
+func (ix index) remove(tx *bolt.Tx, key, js []byte) error {
+	if js == nil {
+		return nil
+	}
+	e, err := ix.entry(key, js)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(ix.tableName()).Delete(e)
+}
+
+// scan calls fn on the encoded rows whose secondary keys are at least from, in
+// ascending order, or, if reverse is true, on every row in descending order.
+// Scanning stops when fn returns false.
+func (ix index) scan(tx *bolt.Tx, from []byte, reverse bool, fn func(js []byte) (bool, error)) error {
+	rows := tx.Bucket([]byte(ix.table))
+	if rows == nil {
+		return nil // nothing has been written yet
+	}
+	c := tx.Bucket(ix.tableName()).Cursor()
+	next, k, key := c.Next, []byte(nil), []byte(nil)
+	if reverse {
+		next = c.Prev
+		k, key = c.Last()
+	} else {
+		k, key = c.Seek(from)
+	}
+	for ; k != nil; k, key = next() {
+		js := rows.Get(key)
+		if js == nil {
+			return fmt.Errorf("%v index refers to missing row %x", ix.name, key)
+		} else if ok, err := fn(js); err != nil || !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexes creates the tables of the supplied indexes, populating those
+// that did not exist yet from the rows already in the database, so that
+// indexes added after a database was created cover its existing rows.
+func createIndexes(db *bolt.DB, indexes ...index) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, ix := range indexes {
+			if tx.Bucket(ix.tableName()) != nil {
+				continue
+			} else if _, err := tx.CreateBucket(ix.tableName()); err != nil {
+				return err
+			}
+			rows := tx.Bucket([]byte(ix.table))
+			if rows == nil {
+				continue
+			}
+			err := rows.ForEach(func(key, js []byte) error {
+				return ix.add(tx, key, js)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// timeIndexKey returns a secondary key that sorts in the same order as t.
+func timeIndexKey(t time.Time) []byte {
+	var b [12]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(t.Unix())^(1<<63))
+	binary.BigEndian.PutUint32(b[8:], uint32(t.Nanosecond()))
+	return b[:]
+}
+
+// floatIndexKey returns a secondary key that sorts in the same order as f.
+func floatIndexKey(f float64) []byte {
+	bits := math.Float64bits(f)
+	if bits&(1<<63) == 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], bits)
+	return b[:]
+}
+
+// openBoltDB opens (or creates) the database dir/name.db. If the database has
+// not been initialized by a call to createTables, fresh is true.
+func openBoltDB(dir, name string) (db *bolt.DB, fresh bool, err error) {
+	db, err = bolt.Open(filepath.Join(dir, name+".db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, false, err
+	}
+	db.View(func(tx *bolt.Tx) error {
+		fresh = tx.Bucket([]byte("meta")) == nil
+		return nil
+	})
+	return db, fresh, nil
+}
+
+// createTables creates the supplied tables, and the meta table, if they do not
+// already exist. Since the meta table is created in the same transaction as
+// the first write, a database whose initialization was interrupted is still
+// considered fresh.
+func createTables(tx *bolt.Tx, tables ...string) error {
+	for _, table := range append(tables, "meta") {
+		if _, err := tx.CreateBucketIfNotExists([]byte(table)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update runs fn in a read-write transaction, creating tables first if
+// necessary, and records its duration as an update of store.
+func update(db *bolt.DB, store string, tables []string, fn func(tx *bolt.Tx) error) error {
+	defer observeStoreOp(store, "update", time.Now())
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := createTables(tx, tables...); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// getJSON decodes the value of key in table into v, if it exists.
+func getJSON(tx *bolt.Tx, table, key string, v interface{}) error {
+	js := tx.Bucket([]byte(table)).Get([]byte(key))
+	if js == nil {
+		return nil
+	}
+	return json.Unmarshal(js, v)
+}
+
+// putJSON encodes v and stores it under key in table.
+func putJSON(tx *bolt.Tx, table, key string, v interface{}) error {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(table)).Put([]byte(key), js)
+}
+
+// retireJSONFile renames a JSON persist file after its contents have been
+// migrated, so that it is not imported again.
+func retireJSONFile(dir, name string) error {
+	err := os.Rename(filepath.Join(dir, name+".json"), filepath.Join(dir, name+".json.bak"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package stores
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/bolt"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/types"
+	"lukechampine.com/frand"
+)
+
+func TestIndexKeys(t *testing.T) {
+	floats := []float64{math.Inf(-1), -2.5, -1, 0, 1e-9, 1, 2.5, math.Inf(1)}
+	for i := 1; i < len(floats); i++ {
+		if bytes.Compare(floatIndexKey(floats[i-1]), floatIndexKey(floats[i])) >= 0 {
+			t.Errorf("key of %v does not sort before key of %v", floats[i-1], floats[i])
+		}
+	}
+	times := []time.Time{{}, time.Unix(-1, 0), time.Unix(0, 0), time.Unix(0, 1), time.Unix(1, 0), time.Now()}
+	for i := 1; i < len(times); i++ {
+		if bytes.Compare(timeIndexKey(times[i-1]), timeIndexKey(times[i])) >= 0 {
+			t.Errorf("key of %v does not sort before key of %v", times[i-1], times[i])
+		}
+	}
+}
+
+func TestHostDBScoreIndex(t *testing.T) {
+	dir := t.TempDir()
+	db, _, err := NewBoltHostDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]consensus.PublicKey, 4)
+	for i, score := range []float64{3, -1, 7, 0.5} {
+		keys[i] = consensus.PublicKey(frand.Entropy256())
+		if err := db.SetScore(keys[i], score); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// changing a score should move the host in the index
+	if err := db.SetScore(keys[1], 5); err != nil {
+		t.Fatal(err)
+	}
+	checkOrder := func(want ...consensus.PublicKey) {
+		t.Helper()
+		hosts, err := db.SelectHosts(-1, func(hostdb.Host) bool { return true })
+		if err != nil {
+			t.Fatal(err)
+		} else if len(hosts) != len(want) {
+			t.Fatalf("expected %v hosts, got %v", len(want), len(hosts))
+		}
+		for i := range want {
+			if hosts[i].PublicKey != want[i] {
+				t.Fatalf("host %v has score %v, expected host with key %v", i, hosts[i].Score, want[i])
+			}
+		}
+	}
+	checkOrder(keys[2], keys[1], keys[0], keys[3])
+
+	// the filter and limit should apply in score order
+	hosts, err := db.SelectHosts(1, func(h hostdb.Host) bool { return h.Score < 6 })
+	if err != nil {
+		t.Fatal(err)
+	} else if len(hosts) != 1 || hosts[0].PublicKey != keys[1] {
+		t.Fatal("wrong hosts selected:", hosts)
+	}
+
+	// an index added to an existing database should be populated from its
+	// rows
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bdb, _, err := openBoltDB(dir, "hostdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(hostsByScore.tableName())
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := bdb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, _, err = NewBoltHostDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkOrder(keys[2], keys[1], keys[0], keys[3])
+}
+
+func TestWalletTimestampIndex(t *testing.T) {
+	dir := t.TempDir()
+	seed := wallet.Seed(frand.Entropy256())
+	s, _, err := NewBoltWalletStore(dir, seed.Address, wallet.DefaultGapLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// confirm a miner payout in each of three blocks
+	var blocks []types.Block
+	for i, ts := range []types.Timestamp{100, 300, 200} {
+		b := types.Block{
+			Timestamp:    ts,
+			MinerPayouts: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: seed.Address(0)}},
+		}
+		s.ProcessConsensusChange(modules.ConsensusChange{
+			AppliedBlocks: []types.Block{b},
+			BlockHeight:   types.BlockHeight(i + 1),
+		})
+		blocks = append(blocks, b)
+	}
+	check := func(since time.Time, max int, want ...types.Timestamp) {
+		t.Helper()
+		txns, err := s.Transactions(since, max)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(txns) != len(want) {
+			t.Fatalf("expected %v transactions, got %v", len(want), len(txns))
+		}
+		for i := range want {
+			if txns[i].Timestamp.Unix() != int64(want[i]) {
+				t.Fatalf("transaction %v has timestamp %v, expected %v", i, txns[i].Timestamp.Unix(), want[i])
+			}
+		}
+	}
+	check(time.Time{}, -1, 100, 200, 300)
+	check(time.Unix(100, 0), -1, 200, 300)
+	check(time.Time{}, 2, 100, 200)
+
+	// a reverted transaction should be removed from the index
+	s.ProcessConsensusChange(modules.ConsensusChange{
+		RevertedBlocks: []types.Block{blocks[2]},
+		AppliedBlocks:  []types.Block{{}},
+		BlockHeight:    3,
+	})
+	check(time.Time{}, -1, 100, 300)
+}
@@ -3,10 +3,12 @@ package stores
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"gitlab.com/NebulousLabs/bolt"
 	"go.sia.tech/renterd/internal/consensus"
 	rhpv2 "go.sia.tech/renterd/rhp/v2"
 	"go.sia.tech/siad/types"
@@ -17,6 +19,7 @@ type EphemeralContractStore struct {
 	mu        sync.Mutex
 	contracts map[types.FileContractID]rhpv2.Contract
 	hostSets  map[string][]consensus.PublicKey
+	changes   changeSet
 }
 
 // Contracts implements api.ContractStore.
@@ -45,7 +48,9 @@ func (s *EphemeralContractStore) Contract(id types.FileContractID) (rhpv2.Contra
 func (s *EphemeralContractStore) AddContract(c rhpv2.Contract) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.contracts[c.ID()] = c
+	id := c.ID()
+	s.contracts[id] = c
+	s.changes.mark("contracts", string(id[:]))
 	return nil
 }
 
@@ -54,6 +59,7 @@ func (s *EphemeralContractStore) RemoveContract(id types.FileContractID) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.contracts, id)
+	s.changes.mark("contracts", string(id[:]))
 	return nil
 }
 
@@ -84,6 +90,7 @@ func (s *EphemeralContractStore) SetHostSet(name string, hosts []consensus.Publi
 	} else {
 		s.hostSets[name] = append([]consensus.PublicKey(nil), hosts...)
 	}
+	s.changes.mark("hostsets", name)
 	return nil
 }
 
@@ -91,6 +98,7 @@ func (s *EphemeralContractStore) SetHostSet(name string, hosts []consensus.Publi
 func NewEphemeralContractStore() *EphemeralContractStore {
 	return &EphemeralContractStore{
 		contracts: make(map[types.FileContractID]rhpv2.Contract),
+		hostSets:  make(map[string][]consensus.PublicKey),
 	}
 }
 
@@ -146,7 +154,9 @@ func (s *JSONContractStore) load() error {
 	for _, c := range p.Contracts {
 		s.contracts[c.ID()] = c
 	}
-	s.hostSets = p.HostSets
+	if p.HostSets != nil {
+		s.hostSets = p.HostSets
+	}
 	return nil
 }
 
@@ -179,3 +189,182 @@ func NewJSONContractStore(dir string) (*JSONContractStore, error) {
 	}
 	return s, nil
 }
+
+// BoltContractStore implements api.ContractStore and api.HostSetStore in
+// memory, backed by a bolt database and a journal.
+type BoltContractStore struct {
+	*EphemeralContractStore
+	db      *bolt.DB
+	journal *journal
+}
+
+type hostSetEntry struct {
+	Name  string
+	Hosts []consensus.PublicKey
+}
+
+func (s *BoltContractStore) apply(op string, data json.RawMessage) error {
+	switch op {
+	case "addContract":
+		var c rhpv2.Contract
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		return s.EphemeralContractStore.AddContract(c)
+	case "removeContract":
+		var id types.FileContractID
+		if err := json.Unmarshal(data, &id); err != nil {
+			return err
+		}
+		return s.EphemeralContractStore.RemoveContract(id)
+	case "setHostSet":
+		var e hostSetEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		return s.EphemeralContractStore.SetHostSet(e.Name, e.Hosts)
+	default:
+		return fmt.Errorf("unknown journal operation %q", op)
+	}
+}
+
+func (s *BoltContractStore) commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := createTables(tx, "contracts", "hostsets"); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "seq", s.journal.seq); err != nil {
+			return err
+		}
+		return s.changes.write(tx, nil, func(table, key string) (v interface{}, ok bool) {
+			switch table {
+			case "contracts":
+				var id types.FileContractID
+				copy(id[:], key)
+				v, ok = s.contracts[id]
+			case "hostsets":
+				v, ok = s.hostSets[key]
+			}
+			return
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.changes = make(changeSet)
+	return nil
+}
+
+func (s *BoltContractStore) load() (seq uint64, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if err := getJSON(tx, "meta", "seq", &seq); err != nil {
+			return err
+		}
+		err := tx.Bucket([]byte("contracts")).ForEach(func(_, js []byte) error {
+			var c rhpv2.Contract
+			if err := json.Unmarshal(js, &c); err != nil {
+				return err
+			}
+			s.contracts[c.ID()] = c
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("hostsets")).ForEach(func(k, js []byte) error {
+			var hosts []consensus.PublicKey
+			if err := json.Unmarshal(js, &hosts); err != nil {
+				return err
+			}
+			s.hostSets[string(k)] = hosts
+			return nil
+		})
+	})
+	return
+}
+
+// AddContract implements api.ContractStore.
+func (s *BoltContractStore) AddContract(c rhpv2.Contract) error {
+	return s.journal.record(s, "addContract", c)
+}
+
+// RemoveContract implements api.ContractStore.
+func (s *BoltContractStore) RemoveContract(id types.FileContractID) error {
+	return s.journal.record(s, "removeContract", id)
+}
+
+// SetHostSet implements api.HostSetStore.
+func (s *BoltContractStore) SetHostSet(name string, hosts []consensus.PublicKey) error {
+	return s.journal.record(s, "setHostSet", hostSetEntry{name, hosts})
+}
+
+// Close writes a final checkpoint and closes the underlying database.
+func (s *BoltContractStore) Close() error {
+	s.journal.mu.Lock()
+	defer s.journal.mu.Unlock()
+	if err := s.journal.checkpoint(s); err != nil {
+		return err
+	} else if err := s.journal.Close(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// NewBoltContractStore returns a new BoltContractStore. If the database does
+// not exist yet, the state of the JSONContractStore in dir, if any, is
+// imported. Otherwise, any journal entries written after the last checkpoint
+// are replayed.
+func NewBoltContractStore(dir string) (_ *BoltContractStore, err error) {
+	db, fresh, err := openBoltDB(dir, "contracts")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+	s := &BoltContractStore{
+		EphemeralContractStore: NewEphemeralContractStore(),
+		db:                     db,
+	}
+	s.changes = make(changeSet)
+	var seq uint64
+	if fresh {
+		js := &JSONContractStore{EphemeralContractStore: s.EphemeralContractStore, dir: dir}
+		if err := js.load(); err != nil {
+			return nil, err
+		}
+		for id := range s.contracts {
+			s.changes.mark("contracts", string(id[:]))
+		}
+		for name := range s.hostSets {
+			s.changes.mark("hostsets", name)
+		}
+	} else if seq, err = s.load(); err != nil {
+		return nil, err
+	}
+
+	j, entries, err := openJournal(filepath.Join(dir, "contracts.journal"), seq)
+	if err != nil {
+		return nil, err
+	}
+	s.journal = j
+	if !fresh {
+		if err := j.replay(s, entries); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+	if err := j.checkpoint(s); err != nil {
+		j.Close()
+		return nil, err
+	} else if fresh {
+		if err := retireJSONFile(dir, "contracts"); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -2,12 +2,14 @@ package stores
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"gitlab.com/NebulousLabs/bolt"
 	"go.sia.tech/renterd/hostdb"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/siad/modules"
@@ -19,6 +21,8 @@ type EphemeralHostDB struct {
 	ccid  modules.ConsensusChangeID
 	hosts map[consensus.PublicKey]hostdb.Host
 	mu    sync.Mutex
+
+	changes changeSet
 }
 
 func (db *EphemeralHostDB) modifyHost(hostKey consensus.PublicKey, fn func(*hostdb.Host)) {
@@ -28,6 +32,7 @@ func (db *EphemeralHostDB) modifyHost(hostKey consensus.PublicKey, fn func(*host
 	}
 	fn(&h)
 	db.hosts[hostKey] = h
+	db.changes.mark("hosts", string(hostKey[:]))
 }
 
 // Host returns information about a host.
@@ -150,7 +155,9 @@ func (db *JSONHostDB) load() (modules.ConsensusChangeID, error) {
 	}
 	db.tip = p.Tip
 	db.ccid = p.CCID
-	db.hosts = p.Hosts
+	if p.Hosts != nil {
+		db.hosts = p.Hosts
+	}
 	return db.ccid, nil
 }
 
@@ -192,3 +199,234 @@ func NewJSONHostDB(dir string) (*JSONHostDB, modules.ConsensusChangeID, error) {
 	}
 	return db, ccid, nil
 }
+
+// BoltHostDB implements a HostDB in memory, backed by a bolt database and a
+// journal.
+type BoltHostDB struct {
+	*EphemeralHostDB
+	db       *bolt.DB
+	journal  *journal
+	lastSave time.Time
+}
+
+// hostsByScore indexes hosts by score.
+var hostsByScore = index{
+	table: "hosts",
+	name:  "score",
+	key: func(js []byte) ([]byte, error) {
+		var h struct{ Score float64 }
+		err := json.Unmarshal(js, &h)
+		return floatIndexKey(h.Score), err
+	},
+}
+
+var hostDBIndexes = []index{hostsByScore}
+
+type (
+	interactionEntry struct {
+		HostKey     consensus.PublicKey
+		Interaction hostdb.Interaction
+	}
+
+	scoreEntry struct {
+		HostKey consensus.PublicKey
+		Score   float64
+	}
+)
+
+func (db *BoltHostDB) apply(op string, data json.RawMessage) error {
+	switch op {
+	case "recordInteraction":
+		var e interactionEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		return db.EphemeralHostDB.RecordInteraction(e.HostKey, e.Interaction)
+	case "setScore":
+		var e scoreEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		return db.EphemeralHostDB.SetScore(e.HostKey, e.Score)
+	default:
+		return fmt.Errorf("unknown journal operation %q", op)
+	}
+}
+
+func (db *BoltHostDB) commit() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		if err := createTables(tx, "hosts"); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "seq", db.journal.seq); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "tip", db.tip); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "ccid", db.ccid); err != nil {
+			return err
+		}
+		return db.changes.write(tx, hostDBIndexes, func(_, key string) (interface{}, bool) {
+			var hostKey consensus.PublicKey
+			copy(hostKey[:], key)
+			h, ok := db.hosts[hostKey]
+			return h, ok
+		})
+	})
+	if err != nil {
+		return err
+	}
+	db.changes = make(changeSet)
+	return nil
+}
+
+func (db *BoltHostDB) load() (seq uint64, err error) {
+	err = db.db.View(func(tx *bolt.Tx) error {
+		if err := getJSON(tx, "meta", "seq", &seq); err != nil {
+			return err
+		} else if err := getJSON(tx, "meta", "tip", &db.tip); err != nil {
+			return err
+		} else if err := getJSON(tx, "meta", "ccid", &db.ccid); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("hosts")).ForEach(func(_, js []byte) error {
+			var h hostdb.Host
+			if err := json.Unmarshal(js, &h); err != nil {
+				return err
+			}
+			db.hosts[h.PublicKey] = h
+			return nil
+		})
+	})
+	return
+}
+
+// RecordInteraction records an interaction with a host. If the host is not in
+// the store, a new entry is created for it.
+func (db *BoltHostDB) RecordInteraction(hostKey consensus.PublicKey, hi hostdb.Interaction) error {
+	return db.journal.record(db, "recordInteraction", interactionEntry{hostKey, hi})
+}
+
+// SetScore sets the score associated with the specified host. If the host is
+// not in the store, a new entry is created for it.
+func (db *BoltHostDB) SetScore(hostKey consensus.PublicKey, score float64) error {
+	return db.journal.record(db, "setScore", scoreEntry{hostKey, score})
+}
+
+// SelectHosts returns up to n hosts for which the supplied filter returns true,
+// in order of descending score. Hosts are read from the database's score
+// index, after a checkpoint is written if any have changed.
+func (db *BoltHostDB) SelectHosts(n int, filter func(hostdb.Host) bool) ([]hostdb.Host, error) {
+	db.journal.mu.Lock()
+	db.mu.Lock()
+	dirty := len(db.changes) != 0
+	db.mu.Unlock()
+	if dirty {
+		if err := db.journal.checkpoint(db); err != nil {
+			db.journal.mu.Unlock()
+			return nil, err
+		}
+	}
+	db.journal.mu.Unlock()
+
+	defer observeStoreOp("hostdb", "selectHosts", time.Now())
+	var hosts []hostdb.Host
+	err := db.db.View(func(tx *bolt.Tx) error {
+		return hostsByScore.scan(tx, nil, true, func(js []byte) (bool, error) {
+			if len(hosts) == n {
+				return false, nil
+			}
+			var h hostdb.Host
+			if err := json.Unmarshal(js, &h); err != nil {
+				return false, err
+			} else if filter(h) {
+				hosts = append(hosts, h)
+			}
+			return true, nil
+		})
+	})
+	return hosts, err
+}
+
+// ProcessConsensusChange implements chain.Subscriber.
+func (db *BoltHostDB) ProcessConsensusChange(cc modules.ConsensusChange) {
+	db.journal.mu.Lock()
+	defer db.journal.mu.Unlock()
+	db.EphemeralHostDB.ProcessConsensusChange(cc)
+	if time.Since(db.lastSave) > 2*time.Minute {
+		if err := db.journal.checkpoint(db); err != nil {
+			log.Fatalln("Couldn't save hostdb state:", err)
+		}
+		db.lastSave = time.Now()
+	}
+}
+
+// Close writes a final checkpoint and closes the underlying database.
+func (db *BoltHostDB) Close() error {
+	db.journal.mu.Lock()
+	defer db.journal.mu.Unlock()
+	if err := db.journal.checkpoint(db); err != nil {
+		return err
+	} else if err := db.journal.Close(); err != nil {
+		return err
+	}
+	return db.db.Close()
+}
+
+// NewBoltHostDB returns a new BoltHostDB. If the database does not exist yet,
+// the state of the JSONHostDB in dir, if any, is imported. Otherwise, any
+// journal entries written after the last checkpoint are replayed.
+func NewBoltHostDB(dir string) (_ *BoltHostDB, _ modules.ConsensusChangeID, err error) {
+	bdb, fresh, err := openBoltDB(dir, "hostdb")
+	if err != nil {
+		return nil, modules.ConsensusChangeID{}, err
+	}
+	defer func() {
+		if err != nil {
+			bdb.Close()
+		}
+	}()
+	db := &BoltHostDB{
+		EphemeralHostDB: NewEphemeralHostDB(),
+		db:              bdb,
+		lastSave:        time.Now(),
+	}
+	db.changes = make(changeSet)
+	if err := createIndexes(bdb, hostDBIndexes...); err != nil {
+		return nil, modules.ConsensusChangeID{}, err
+	}
+	var seq uint64
+	if fresh {
+		js := &JSONHostDB{EphemeralHostDB: db.EphemeralHostDB, dir: dir}
+		if _, err := js.load(); err != nil {
+			return nil, modules.ConsensusChangeID{}, err
+		}
+		for hostKey := range db.hosts {
+			db.changes.mark("hosts", string(hostKey[:]))
+		}
+	} else if seq, err = db.load(); err != nil {
+		return nil, modules.ConsensusChangeID{}, err
+	}
+
+	j, entries, err := openJournal(filepath.Join(dir, "hostdb.journal"), seq)
+	if err != nil {
+		return nil, modules.ConsensusChangeID{}, err
+	}
+	db.journal = j
+	if !fresh {
+		if err := j.replay(db, entries); err != nil {
+			j.Close()
+			return nil, modules.ConsensusChangeID{}, err
+		}
+	}
+	if err := j.checkpoint(db); err != nil {
+		j.Close()
+		return nil, modules.ConsensusChangeID{}, err
+	} else if fresh {
+		if err := retireJSONFile(dir, "hostdb"); err != nil {
+			j.Close()
+			return nil, modules.ConsensusChangeID{}, err
+		}
+	}
+	return db, db.ccid, nil
+}
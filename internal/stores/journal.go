@@ -0,0 +1,211 @@
+package stores
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalCheckpointInterval is the number of journal entries after which a
+// store writes a checkpoint and truncates its journal.
+const journalCheckpointInterval = 1000
+
+// A journalEntry records a single mutation of a store.
+type journalEntry struct {
+	Seq  uint64          `json:"seq"`
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+// A journal is an append-only log of mutations. Each entry is fsynced before
+// it is applied, so that a store can recover any mutation made since its last
+// checkpoint by replaying the journal.
+type journal struct {
+	// mu must be held while an entry is appended and applied, and while a
+	// checkpoint is written, so that entries are applied in journal order.
+	mu      sync.Mutex
+	name    string // of the store, for metrics
+	f       journalFile
+	seq     uint64 // of the last entry appended
+	entries int    // appended since the last checkpoint
+	err     error  // if set, the file is in an unknown state
+}
+
+// A journalFile is the file underlying a journal.
+type journalFile interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// append encodes v and durably appends it to the journal, returning the
+// encoded data. If the entry cannot be written, it is removed from the file,
+// so that a failed mutation is never replayed; if that fails too, the journal
+// refuses further entries.
+func (j *journal) append(op string, v interface{}) (json.RawMessage, error) {
+	if j.err != nil {
+		return nil, fmt.Errorf("journal is unusable: %w", j.err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	js, err := json.Marshal(journalEntry{
+		Seq:  j.seq + 1,
+		Op:   op,
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	off, err := j.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := j.f.Write(append(js, '\n')); err != nil {
+		return nil, j.rollback(off, err)
+	} else if err := j.f.Sync(); err != nil {
+		return nil, j.rollback(off, err)
+	}
+	j.seq++
+	j.entries++
+	return data, nil
+}
+
+// rollback discards anything written after off by an append that failed with
+// err, marking the journal unusable if it cannot. The truncation is made
+// durable by the Sync of the next append.
+func (j *journal) rollback(off int64, err error) error {
+	if terr := j.f.Truncate(off); terr != nil {
+		j.err = terr
+	} else if _, serr := j.f.Seek(off, io.SeekStart); serr != nil {
+		j.err = serr
+	}
+	return err
+}
+
+// truncate discards all entries. It should only be called once the entries
+// have been checkpointed.
+func (j *journal) truncate() error {
+	if err := j.f.Truncate(0); err != nil {
+		return err
+	} else if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+		j.err = err
+		return err
+	} else if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.entries = 0
+	return nil
+}
+
+func (j *journal) Close() error {
+	return j.f.Close()
+}
+
+// openJournal opens the journal at path, creating it if necessary, and returns
+// the entries appended after the checkpoint at seq. A partially written final
+// entry, left by a crash during append, is discarded.
+func openJournal(path string, seq uint64) (*journal, []journalEntry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	j := &journal{
+		name: strings.TrimSuffix(filepath.Base(path), ".journal"),
+		f:    f,
+		seq:  seq,
+	}
+	var entries []journalEntry
+	var valid int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			break // EOF, or a torn final entry
+		}
+		var e journalEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &e); err != nil {
+			break
+		}
+		valid += int64(len(line))
+		if e.Seq > j.seq {
+			entries = append(entries, e)
+			j.seq = e.Seq
+		}
+	}
+	// discard anything after the last valid entry and position the file for
+	// appending
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, nil, err
+	} else if _, err := f.Seek(valid, 0); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	j.entries = len(entries)
+	return j, entries, nil
+}
+
+// A journaledStore applies journal entries to its in-memory state and
+// persists that state in checkpoints.
+type journaledStore interface {
+	// apply applies the mutation described by a journal entry.
+	apply(op string, data json.RawMessage) error
+	// commit persists all applied entries, recording the journal's seq.
+	commit() error
+}
+
+// record appends a mutation to the journal and then applies it to s, writing
+// a checkpoint if enough entries have accumulated. Mutations that can fail
+// must be validated before they are recorded, with j.mu held, so that the
+// journal only contains mutations that apply cleanly.
+func (j *journal) record(s journaledStore, op string, v interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.recordLocked(s, op, v)
+}
+
+// recordLocked is like record, but j.mu must already be held.
+func (j *journal) recordLocked(s journaledStore, op string, v interface{}) error {
+	defer observeStoreOp(j.name, op, time.Now())
+	data, err := j.append(op, v)
+	if err != nil {
+		return err
+	}
+	err = s.apply(op, data)
+	if j.entries >= journalCheckpointInterval {
+		if err := j.checkpoint(s); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// checkpoint commits s and truncates the journal. j.mu must be held.
+func (j *journal) checkpoint(s journaledStore) error {
+	defer observeStoreOp(j.name, "checkpoint", time.Now())
+	if err := s.commit(); err != nil {
+		return err
+	}
+	return j.truncate()
+}
+
+// replay applies entries to s. Since only valid mutations are recorded, an
+// entry that fails to apply indicates that the journal is corrupt.
+func (j *journal) replay(s journaledStore, entries []journalEntry) error {
+	for _, e := range entries {
+		if err := s.apply(e.Op, e.Data); err != nil {
+			return fmt.Errorf("couldn't replay journal entry %v (%v): %w", e.Seq, e.Op, err)
+		}
+	}
+	return nil
+}
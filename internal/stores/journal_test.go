@@ -0,0 +1,104 @@
+package stores
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// A faultyFile wraps a journal file, failing the operations that are set to
+// fail. A failed write writes half of its data first.
+type faultyFile struct {
+	journalFile
+	failWrite, failSync, failTruncate bool
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if f.failWrite {
+		n, _ := f.journalFile.Write(p[:len(p)/2])
+		return n, errors.New("write failed")
+	}
+	return f.journalFile.Write(p)
+}
+
+func (f *faultyFile) Sync() error {
+	if f.failSync {
+		return errors.New("sync failed")
+	}
+	return f.journalFile.Sync()
+}
+
+func (f *faultyFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("truncate failed")
+	}
+	return f.journalFile.Truncate(size)
+}
+
+// A testJournaledStore records the entries applied to it.
+type testJournaledStore struct {
+	applied []string
+}
+
+func (s *testJournaledStore) apply(op string, data json.RawMessage) error {
+	s.applied = append(s.applied, op)
+	return nil
+}
+
+func (s *testJournaledStore) commit() error { return nil }
+
+func TestJournalFailedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.journal")
+	j, _, err := openJournal(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &faultyFile{journalFile: j.f}
+	j.f = f
+	s := new(testJournaledStore)
+
+	// failed writes and syncs should leave no trace in the journal
+	if err := j.record(s, "a", nil); err != nil {
+		t.Fatal(err)
+	}
+	f.failWrite = true
+	if err := j.record(s, "b", nil); err == nil {
+		t.Fatal("expected write to fail")
+	}
+	f.failWrite, f.failSync = false, true
+	if err := j.record(s, "c", nil); err == nil {
+		t.Fatal("expected sync to fail")
+	}
+	f.failSync = false
+	if err := j.record(s, "d", nil); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	j, entries, err := openJournal(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, e := range entries {
+		ops = append(ops, e.Op)
+	}
+	if len(ops) != 2 || ops[0] != "a" || ops[1] != "d" || entries[1].Seq != 2 {
+		t.Fatalf("expected entries a and d, got %v", entries)
+	} else if len(s.applied) != 2 {
+		t.Fatal("failed entries were applied:", s.applied)
+	}
+
+	// if a failed entry cannot be removed, the journal should refuse further
+	// entries
+	f = &faultyFile{journalFile: j.f, failSync: true, failTruncate: true}
+	j.f = f
+	if err := j.record(s, "e", nil); err == nil {
+		t.Fatal("expected sync to fail")
+	}
+	f.failSync, f.failTruncate = false, false
+	if err := j.record(s, "f", nil); err == nil {
+		t.Fatal("expected unusable journal to refuse entries")
+	}
+	j.Close()
+}
@@ -1,6 +1,8 @@
 package stores
 
 import (
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,10 +11,13 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"gitlab.com/NebulousLabs/bolt"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/renterd/object"
 	"go.sia.tech/renterd/slab"
+	"lukechampine.com/frand"
 )
 
 type refSector struct {
@@ -20,10 +25,21 @@ type refSector struct {
 	Root   consensus.Hash256
 }
 
+func (rs refSector) key() string {
+	return hostIDKey(rs.HostID) + string(rs.Root[:])
+}
+
+func hostIDKey(id uint32) string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], id)
+	return string(b[:])
+}
+
 type refSlab struct {
 	MinShards uint8
 	Shards    []refSector
 	Refs      uint32
+	Added     time.Time // if added by AddSlabs
 }
 
 type refSlice struct {
@@ -33,8 +49,157 @@ type refSlice struct {
 }
 
 type refObject struct {
-	Key   object.EncryptionKey
-	Slabs []refSlice
+	Key      object.EncryptionKey
+	Slabs    []refSlice
+	Metadata object.Metadata
+}
+
+func (ro refObject) size() (n int64) {
+	for _, rs := range ro.Slabs {
+		n += int64(rs.Length)
+	}
+	return
+}
+
+// versionID returns the object's version ID. Objects stored before version IDs
+// were assigned to unversioned objects have the null version.
+func (ro refObject) versionID() string {
+	if ro.Metadata.VersionID == "" {
+		return object.NullVersionID
+	}
+	return ro.Metadata.VersionID
+}
+
+func copyMetadata(md object.Metadata) object.Metadata {
+	if md.User != nil {
+		user := make(map[string]string, len(md.User))
+		for k, v := range md.User {
+			user[k] = v
+		}
+		md.User = user
+	}
+	return md
+}
+
+// An objectVersion is a noncurrent version of an object, or a delete marker.
+type objectVersion struct {
+	ID           string // only set for delete markers
+	Object       refObject
+	DeleteMarker bool
+	Created      time.Time
+	Superseded   time.Time
+}
+
+// newVersionID returns a random version ID.
+func newVersionID() string {
+	return hex.EncodeToString(frand.Bytes(16))
+}
+
+// A refBucket is a namespace for objects. Internally, objects are keyed by
+// their bucket name and key, separated by a colon.
+type refBucket struct {
+	Created  time.Time
+	Settings object.BucketSettings
+	size     int64
+}
+
+func objectKey(bucket, key string) string {
+	return bucket + ":" + key
+}
+
+func splitObjectKey(k string) (bucket, key string) {
+	i := strings.IndexByte(k, ':')
+	return k[:i], k[i+1:]
+}
+
+func bucketOf(k string) string {
+	bucket, _ := splitObjectKey(k)
+	return bucket
+}
+
+func validateBucketName(name string) error {
+	if len(name) == 0 || len(name) > 63 {
+		return errors.New("bucket name must be between 1 and 63 characters long")
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z') && !('0' <= c && c <= '9') && c != '-' && c != '.' {
+			return fmt.Errorf("bucket name contains invalid character %q", c)
+		}
+	}
+	return nil
+}
+
+// A dirIndex tracks the immediate children of a directory, along with the
+// total size and number of objects beneath it. The children are kept sorted by
+// each field that listings can be sorted by, so that pages can be found by
+// binary search.
+type dirIndex struct {
+	objects  uint64
+	size     int64
+	children map[string]object.Entry // keyed by the child's full key
+
+	byName, bySize, byModified []string
+}
+
+func newDirIndex() *dirIndex {
+	return &dirIndex{children: make(map[string]object.Entry)}
+}
+
+// sorted returns the children's keys, sorted by the specified field.
+func (d *dirIndex) sorted(sortBy string) *[]string {
+	switch sortBy {
+	case object.SortBySize:
+		return &d.bySize
+	case object.SortByModified:
+		return &d.byModified
+	}
+	return &d.byName
+}
+
+// search returns the position of the first child, sorted by the specified
+// field, that does not sort before e.
+func (d *dirIndex) search(sortBy string, e object.Entry) int {
+	opts, keys := object.ListOptions{SortBy: sortBy}, *d.sorted(sortBy)
+	return sort.Search(len(keys), func(i int) bool {
+		return !opts.Less(d.children[keys[i]], e)
+	})
+}
+
+var sortFields = []string{object.SortByName, object.SortBySize, object.SortByModified}
+
+// set adds or updates the child e, whose Name is its full key.
+func (d *dirIndex) set(e object.Entry) {
+	d.remove(e.Name)
+	d.children[e.Name] = e
+	for _, sortBy := range sortFields {
+		keys, i := d.sorted(sortBy), d.search(sortBy, e)
+		*keys = append(*keys, "")
+		copy((*keys)[i+1:], (*keys)[i:])
+		(*keys)[i] = e.Name
+	}
+}
+
+// remove removes the child with the specified key, if present.
+func (d *dirIndex) remove(key string) {
+	e, ok := d.children[key]
+	if !ok {
+		return
+	}
+	for _, sortBy := range sortFields {
+		keys, i := d.sorted(sortBy), d.search(sortBy, e)
+		*keys = append((*keys)[:i], (*keys)[i+1:]...)
+	}
+	delete(d.children, key)
+}
+
+// parentDirs returns the directories containing key, outermost first.
+func parentDirs(key string) (dirs []string) {
+	for i := 0; i < len(key)-1; i++ {
+		if key[i] == '/' {
+			dirs = append(dirs, key[:i+1])
+		}
+	}
+	return
 }
 
 // EphemeralObjectStore implements api.ObjectStore in memory.
@@ -42,7 +207,190 @@ type EphemeralObjectStore struct {
 	hosts   []consensus.PublicKey
 	slabs   map[string]refSlab
 	objects map[string]refObject
-	mu      sync.Mutex
+	dirs    map[string]*dirIndex
+	garbage []refSector
+	buckets map[string]*refBucket
+	changes changeSet
+
+	// noncurrent versions of each object, oldest first
+	versions   map[string][]objectVersion
+	versioning map[string]object.VersioningPolicy
+
+	mu sync.Mutex
+}
+
+// policyFor returns the versioning policy of the longest prefix matching key,
+// or the policy of its bucket if no prefix matches.
+func (es *EphemeralObjectStore) policyFor(key string) object.VersioningPolicy {
+	var policy object.VersioningPolicy
+	if b, ok := es.buckets[bucketOf(key)]; ok {
+		policy = b.Settings.Versioning
+	}
+	longest := -1
+	for prefix, p := range es.versioning {
+		if strings.HasPrefix(key, prefix) && len(prefix) > longest {
+			policy, longest = p, len(prefix)
+		}
+	}
+	return policy
+}
+
+// pruneVersions removes the noncurrent versions of key that are not retained
+// under policy, releasing their slabs.
+func (es *EphemeralObjectStore) pruneVersions(key string, policy object.VersioningPolicy, now time.Time) {
+	vs := es.versions[key]
+	var kept []objectVersion
+	var noncurrent int
+	for i := len(vs) - 1; i >= 0; i-- {
+		v := vs[i]
+		expired := !policy.Enabled || policy.KeepDays > 0 && !v.Superseded.IsZero() && now.Sub(v.Superseded) > time.Duration(policy.KeepDays)*24*time.Hour
+		if !v.DeleteMarker {
+			noncurrent++
+			expired = expired || (policy.KeepVersions > 0 && noncurrent > policy.KeepVersions)
+		}
+		if expired {
+			if !v.DeleteMarker {
+				es.releaseObject(key, v.Object)
+			}
+			continue
+		}
+		kept = append(kept, v)
+	}
+	// restore order, dropping the oldest delete markers, since they no longer
+	// hide anything
+	for len(kept) > 0 && kept[len(kept)-1].DeleteMarker {
+		kept = kept[:len(kept)-1]
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	if len(kept) == 0 {
+		delete(es.versions, key)
+	} else {
+		es.versions[key] = kept
+	}
+	es.changes.mark("versions", key)
+}
+
+// pruneUnversioned removes the noncurrent versions of the keys beginning with
+// keyPrefix whose versioning has been disabled.
+func (es *EphemeralObjectStore) pruneUnversioned(keyPrefix string) {
+	for key := range es.versions {
+		if policy := es.policyFor(key); strings.HasPrefix(key, keyPrefix) && !policy.Enabled {
+			// the time is irrelevant, since no versions are retained
+			es.pruneVersions(key, policy, time.Time{})
+		}
+	}
+}
+
+// PruneVersions implements api.ObjectStore.
+func (es *EphemeralObjectStore) PruneVersions() error {
+	return es.pruneVersionsAt(time.Now().UTC())
+}
+
+func (es *EphemeralObjectStore) pruneVersionsAt(now time.Time) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	for key := range es.versions {
+		es.pruneVersions(key, es.policyFor(key), now)
+	}
+	return nil
+}
+
+// VersioningPolicies implements api.ObjectStore.
+func (es *EphemeralObjectStore) VersioningPolicies(bucket string) (map[string]object.VersioningPolicy, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if _, ok := es.buckets[bucket]; !ok {
+		return nil, errors.New("bucket not found")
+	}
+	policies := make(map[string]object.VersioningPolicy)
+	for prefix, p := range es.versioning {
+		if b, prefix := splitObjectKey(prefix); b == bucket {
+			policies[prefix] = p
+		}
+	}
+	return policies, nil
+}
+
+// SetVersioningPolicy implements api.ObjectStore.
+func (es *EphemeralObjectStore) SetVersioningPolicy(bucket, prefix string, policy object.VersioningPolicy) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if err := es.checkBucket(bucket); err != nil {
+		return err
+	}
+	if policy == (object.VersioningPolicy{}) {
+		delete(es.versioning, objectKey(bucket, prefix))
+	} else {
+		es.versioning[objectKey(bucket, prefix)] = policy
+	}
+	es.changes.mark("versioning", objectKey(bucket, prefix))
+	es.pruneUnversioned(objectKey(bucket, prefix))
+	return nil
+}
+
+func (es *EphemeralObjectStore) indexObject(key string, ro refObject) {
+	dirs := parentDirs(key)
+	size := ro.size()
+	child := object.Entry{Name: key, Size: size, Objects: 1, Metadata: ro.Metadata}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d, ok := es.dirs[dirs[i]]
+		if !ok {
+			d = newDirIndex()
+			es.dirs[dirs[i]] = d
+		}
+		d.objects++
+		d.size += size
+		d.set(child)
+		child = object.Entry{Name: dirs[i], Size: d.size, Objects: d.objects}
+	}
+}
+
+func (es *EphemeralObjectStore) unindexObject(key string, ro refObject) {
+	dirs := parentDirs(key)
+	size := ro.size()
+	child, empty := object.Entry{Name: key}, true
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := es.dirs[dirs[i]]
+		d.objects--
+		d.size -= size
+		if empty {
+			d.remove(child.Name)
+		} else {
+			d.set(child)
+		}
+		if empty = d.objects == 0; empty {
+			delete(es.dirs, dirs[i])
+		}
+		child = object.Entry{Name: dirs[i], Size: d.size, Objects: d.objects}
+	}
+}
+
+// rebuildIndex recomputes the directory index and the size of each bucket.
+func (es *EphemeralObjectStore) rebuildIndex() error {
+	es.dirs = make(map[string]*dirIndex)
+	for _, b := range es.buckets {
+		b.size = 0
+	}
+	for key, ro := range es.objects {
+		b, ok := es.buckets[bucketOf(key)]
+		if !ok {
+			return fmt.Errorf("object %q is in an unknown bucket", key)
+		}
+		es.indexObject(key, ro)
+		b.size += ro.size()
+	}
+	for key, vs := range es.versions {
+		b, ok := es.buckets[bucketOf(key)]
+		if !ok {
+			return fmt.Errorf("versions of %q are in an unknown bucket", key)
+		}
+		for _, v := range vs {
+			b.size += v.Object.size()
+		}
+	}
+	return nil
 }
 
 func (es *EphemeralObjectStore) addHost(hostKey consensus.PublicKey) uint32 {
@@ -52,17 +400,46 @@ func (es *EphemeralObjectStore) addHost(hostKey consensus.PublicKey) uint32 {
 		}
 	}
 	es.hosts = append(es.hosts, hostKey)
+	es.changes.mark("hosts", hostIDKey(uint32(len(es.hosts)-1)))
 	return uint32(len(es.hosts) - 1)
 }
 
-// Put implements api.ObjectStore.
-func (es *EphemeralObjectStore) Put(key string, o object.Object) error {
-	es.mu.Lock()
-	defer es.mu.Unlock()
-	ro := refObject{
-		Key:   o.Key,
-		Slabs: make([]refSlice, len(o.Slabs)),
+// unreferenceSlab queues the sectors of a slab that is no longer referenced by
+// any object for deletion.
+func (es *EphemeralObjectStore) unreferenceSlab(id string) {
+	for _, sector := range es.slabs[id].Shards {
+		es.garbage = append(es.garbage, sector)
+		es.changes.mark("garbage", sector.key())
 	}
+	delete(es.slabs, id)
+	es.changes.mark("slabs", id)
+}
+
+// rereferenceSlab removes the sectors of a slab that is referenced again from
+// the deletion queue.
+func (es *EphemeralObjectStore) rereferenceSlab(rs refSlab) {
+	if len(es.garbage) == 0 {
+		return
+	}
+	inSlab := make(map[refSector]bool, len(rs.Shards))
+	for _, sector := range rs.Shards {
+		inSlab[sector] = true
+	}
+	garbage := es.garbage[:0]
+	for _, sector := range es.garbage {
+		if !inSlab[sector] {
+			garbage = append(garbage, sector)
+		} else {
+			es.changes.mark("garbage", sector.key())
+		}
+	}
+	es.garbage = garbage
+}
+
+// referenceSlabs increments the refcounts of the slabs in o, adding them to the
+// store if necessary.
+func (es *EphemeralObjectStore) referenceSlabs(o object.Object) []refSlice {
+	slices := make([]refSlice, len(o.Slabs))
 	for i, ss := range o.Slabs {
 		rs, ok := es.slabs[ss.Key.String()]
 		if !ok {
@@ -73,24 +450,173 @@ func (es *EphemeralObjectStore) Put(key string, o object.Object) error {
 					Root:   sector.Root,
 				}
 			}
-			rs = refSlab{ss.MinShards, shards, 0}
+			rs = refSlab{MinShards: ss.MinShards, Shards: shards}
+			es.rereferenceSlab(rs)
 		}
 		rs.Refs++
 		es.slabs[ss.Key.String()] = rs
-		ro.Slabs[i] = refSlice{ss.Key, ss.Offset, ss.Length}
+		es.changes.mark("slabs", ss.Key.String())
+		slices[i] = refSlice{ss.Key, ss.Offset, ss.Length}
+	}
+	return slices
+}
+
+// releaseSlabs decrements the refcounts of the slabs in ro, queueing any slabs
+// that are no longer referenced for deletion.
+func (es *EphemeralObjectStore) releaseSlabs(ro refObject) {
+	for _, s := range ro.Slabs {
+		rs, ok := es.slabs[s.SlabID.String()]
+		if !ok || rs.Refs == 0 {
+			continue // shouldn't happen, but benign
+		}
+		rs.Refs--
+		es.slabs[s.SlabID.String()] = rs
+		es.changes.mark("slabs", s.SlabID.String())
+		if rs.Refs == 0 {
+			es.unreferenceSlab(s.SlabID.String())
+		}
+	}
+}
+
+// unreferencedSlabGracePeriod is how long a slab added by AddSlabs may remain
+// unreferenced before its sectors are queued for deletion. Clients upload
+// slabs before storing the object that references them, so the period must
+// comfortably exceed the time between the two.
+const unreferencedSlabGracePeriod = 24 * time.Hour
+
+// AddSlabs implements api.ObjectStore. The slabs are stored without any
+// references; if no object references them within
+// unreferencedSlabGracePeriod, the next sweep queues their sectors for
+// deletion.
+func (es *EphemeralObjectStore) AddSlabs(slabs []slab.Slab) error {
+	return es.addSlabsAt(slabs, time.Now().UTC())
+}
+
+func (es *EphemeralObjectStore) addSlabsAt(slabs []slab.Slab, now time.Time) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	for _, ss := range slabs {
+		if _, ok := es.slabs[ss.Key.String()]; ok {
+			continue
+		}
+		shards := make([]refSector, len(ss.Shards))
+		for i, sector := range ss.Shards {
+			shards[i] = refSector{
+				HostID: es.addHost(sector.Host),
+				Root:   sector.Root,
+			}
+		}
+		rs := refSlab{MinShards: ss.MinShards, Shards: shards, Added: now}
+		es.rereferenceSlab(rs)
+		es.slabs[ss.Key.String()] = rs
+		es.changes.mark("slabs", ss.Key.String())
 	}
-	es.objects[key] = ro
 	return nil
 }
 
-// Get implements api.ObjectStore.
-func (es *EphemeralObjectStore) Get(key string) (object.Object, error) {
+// SweepSlabs queues the sectors of slabs that were added by AddSlabs, but not
+// referenced by an object within unreferencedSlabGracePeriod, for deletion.
+func (es *EphemeralObjectStore) SweepSlabs() error {
+	return es.sweepSlabsAt(time.Now().UTC())
+}
+
+func (es *EphemeralObjectStore) sweepSlabsAt(now time.Time) error {
 	es.mu.Lock()
 	defer es.mu.Unlock()
-	ro, ok := es.objects[key]
+	es.sweepSlabs(now)
+	return nil
+}
+
+// sweepSlabs queues the sectors of slabs that have been unreferenced since
+// before now-unreferencedSlabGracePeriod for deletion. es.mu must be held.
+func (es *EphemeralObjectStore) sweepSlabs(now time.Time) {
+	for id, rs := range es.slabs {
+		if rs.Refs == 0 && now.Sub(rs.Added) >= unreferencedSlabGracePeriod {
+			es.unreferenceSlab(id)
+		}
+	}
+}
+
+// releaseObject releases the slabs of ro, which was stored under key.
+func (es *EphemeralObjectStore) releaseObject(key string, ro refObject) {
+	es.releaseSlabs(ro)
+	es.buckets[bucketOf(key)].size -= ro.size()
+}
+
+// Put implements api.ObjectStore.
+func (es *EphemeralObjectStore) Put(bucket, key string, o object.Object) error {
+	return es.putAt(bucket, key, o, time.Now().UTC(), newVersionID())
+}
+
+// canPut returns the error, if any, that storing o under key would return.
+// es.mu must be held.
+func (es *EphemeralObjectStore) canPut(bucket, key string, o object.Object) error {
+	b, ok := es.buckets[bucket]
 	if !ok {
-		return object.Object{}, errors.New("not found")
+		return errors.New("bucket not found")
+	}
+	key = objectKey(bucket, key)
+	if quota := b.Settings.Quota; quota > 0 {
+		size := b.size + o.Size()
+		if old, ok := es.objects[key]; ok && !es.policyFor(key).Enabled {
+			size -= old.size()
+		}
+		if size > quota {
+			return errors.New("bucket quota exceeded")
+		}
+	}
+	return nil
+}
+
+// putAt stores o under key. If versioning is enabled for key, the new version
+// has the specified ID.
+func (es *EphemeralObjectStore) putAt(bucket, key string, o object.Object, now time.Time, versionID string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if err := es.canPut(bucket, key, o); err != nil {
+		return err
+	}
+	b := es.buckets[bucket]
+	key = objectKey(bucket, key)
+	policy := es.policyFor(key)
+
+	ro := refObject{
+		Key:      o.Key,
+		Slabs:    es.referenceSlabs(o),
+		Metadata: copyMetadata(o.Metadata),
+	}
+	ro.Metadata.Created = now
+	ro.Metadata.Modified = now
+	ro.Metadata.ETag = o.ComputeETag()
+	ro.Metadata.VersionID = object.NullVersionID
+	b.size += ro.size()
+
+	if old, ok := es.objects[key]; ok {
+		ro.Metadata.Created = old.Metadata.Created
+		es.unindexObject(key, old)
+		if policy.Enabled {
+			es.versions[key] = append(es.versions[key], objectVersion{
+				Object:     old,
+				Superseded: now,
+			})
+		} else {
+			es.releaseObject(key, old)
+		}
+	} else if vs := es.versions[key]; len(vs) > 0 && vs[len(vs)-1].Superseded.IsZero() {
+		// supersede the current delete marker
+		vs[len(vs)-1].Superseded = now
 	}
+	if policy.Enabled {
+		ro.Metadata.VersionID = versionID
+	}
+	es.objects[key] = ro
+	es.changes.mark("objects", key)
+	es.indexObject(key, ro)
+	es.pruneVersions(key, policy, now)
+	return nil
+}
+
+func (es *EphemeralObjectStore) object(ro refObject) (object.Object, error) {
 	slabs := make([]slab.Slice, len(ro.Slabs))
 	for i, rss := range ro.Slabs {
 		rs, ok := es.slabs[rss.SlabID.String()]
@@ -114,59 +640,340 @@ func (es *EphemeralObjectStore) Get(key string) (object.Object, error) {
 			Length: rss.Length,
 		}
 	}
+	md := copyMetadata(ro.Metadata)
+	md.VersionID = ro.versionID()
 	return object.Object{
-		Key:   ro.Key,
-		Slabs: slabs,
+		Key:      ro.Key,
+		Slabs:    slabs,
+		Metadata: md,
 	}, nil
 }
 
-// Delete implements api.ObjectStore.
-func (es *EphemeralObjectStore) Delete(key string) error {
+// Get implements api.ObjectStore.
+func (es *EphemeralObjectStore) Get(bucket, key string) (object.Object, error) {
 	es.mu.Lock()
 	defer es.mu.Unlock()
-	o, ok := es.objects[key]
+	ro, ok := es.objects[objectKey(bucket, key)]
 	if !ok {
-		return nil
+		return object.Object{}, errors.New("not found")
 	}
-	// decrement slab refcounts
-	for _, s := range o.Slabs {
-		rs, ok := es.slabs[s.SlabID.String()]
-		if !ok || rs.Refs == 0 {
-			continue // shouldn't happen, but benign
+	return es.object(ro)
+}
+
+// GetVersion implements api.ObjectStore.
+func (es *EphemeralObjectStore) GetVersion(bucket, key, versionID string) (object.Object, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	key = objectKey(bucket, key)
+	if ro, ok := es.objects[key]; ok && ro.versionID() == versionID {
+		return es.object(ro)
+	}
+	for _, v := range es.versions[key] {
+		if !v.DeleteMarker && v.Object.versionID() == versionID {
+			return es.object(v.Object)
 		}
-		rs.Refs--
-		if rs.Refs == 0 {
-			delete(es.slabs, s.SlabID.String())
-		} else {
-			es.slabs[s.SlabID.String()] = rs
+	}
+	return object.Object{}, errors.New("not found")
+}
+
+// Versions implements api.ObjectStore.
+func (es *EphemeralObjectStore) Versions(bucket, key string) ([]object.Version, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	key = objectKey(bucket, key)
+	var versions []object.Version
+	if ro, ok := es.objects[key]; ok {
+		versions = append(versions, object.Version{
+			ID:       ro.versionID(),
+			Size:     ro.size(),
+			Modified: ro.Metadata.Modified,
+			Latest:   true,
+		})
+	}
+	vs := es.versions[key]
+	for i := len(vs) - 1; i >= 0; i-- {
+		v := object.Version{
+			ID:       vs[i].Object.versionID(),
+			Size:     vs[i].Object.size(),
+			Modified: vs[i].Object.Metadata.Modified,
 		}
+		if vs[i].DeleteMarker {
+			v = object.Version{
+				ID:           vs[i].ID,
+				Modified:     vs[i].Created,
+				DeleteMarker: true,
+				Latest:       len(versions) == 0,
+			}
+		}
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("not found")
+	}
+	return versions, nil
+}
+
+// deleteObject deletes the object stored under key. If versioning is enabled
+// for key, the delete marker has the specified ID.
+func (es *EphemeralObjectStore) deleteObject(key string, now time.Time, versionID string) {
+	o, ok := es.objects[key]
+	if !ok {
+		return
 	}
+	es.unindexObject(key, o)
 	delete(es.objects, key)
+	es.changes.mark("objects", key)
+	if policy := es.policyFor(key); policy.Enabled {
+		es.versions[key] = append(es.versions[key], objectVersion{
+			Object:     o,
+			Superseded: now,
+		}, objectVersion{
+			ID:           versionID,
+			DeleteMarker: true,
+			Created:      now,
+		})
+		es.pruneVersions(key, policy, now)
+	} else {
+		es.releaseObject(key, o)
+	}
+}
+
+// Delete implements api.ObjectStore.
+func (es *EphemeralObjectStore) Delete(bucket, key string) error {
+	return es.deleteAt(bucket, key, time.Now().UTC(), newVersionID())
+}
+
+func (es *EphemeralObjectStore) deleteAt(bucket, key string, now time.Time, versionID string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.deleteObject(objectKey(bucket, key), now, versionID)
 	return nil
 }
 
+// DeletePrefix implements api.ObjectStore.
+func (es *EphemeralObjectStore) DeletePrefix(bucket, prefix string, dryRun bool) ([]string, int64, error) {
+	return es.deletePrefixAt(bucket, prefix, dryRun, time.Now().UTC(), nil)
+}
+
+// deletePrefixAt deletes the objects whose keys begin with prefix. The delete
+// marker of each versioned object has the ID that versionIDs maps its key to,
+// or a random ID if it has none.
+func (es *EphemeralObjectStore) deletePrefixAt(bucket, prefix string, dryRun bool, now time.Time, versionIDs map[string]string) ([]string, int64, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	var keys []string
+	var size int64
+	for k, o := range es.objects {
+		if strings.HasPrefix(k, objectKey(bucket, prefix)) {
+			keys = append(keys, k)
+			size += o.size()
+		}
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		_, keys[i] = splitObjectKey(k)
+		if !dryRun {
+			versionID, ok := versionIDs[keys[i]]
+			if !ok {
+				versionID = newVersionID()
+			}
+			es.deleteObject(k, now, versionID)
+		}
+	}
+	return keys, size, nil
+}
+
 // List implements api.ObjectStore.
-func (es *EphemeralObjectStore) List(path string) []string {
+func (es *EphemeralObjectStore) List(bucket, path string, opts object.ListOptions) ([]object.Entry, bool, error) {
 	if !strings.HasSuffix(path, "/") {
-		panic("path must end in /")
+		return nil, false, errors.New("path must end in /")
 	}
 	es.mu.Lock()
 	defer es.mu.Unlock()
-	var keys []string
-	seen := make(map[string]bool)
+	if _, ok := es.buckets[bucket]; !ok {
+		return nil, false, errors.New("bucket not found")
+	}
+	d, ok := es.dirs[objectKey(bucket, path)]
+	if !ok {
+		return nil, false, nil
+	}
+	marker, err := opts.MarkerEntry()
+	if err != nil {
+		return nil, false, err
+	}
+	marker.Name = objectKey(bucket, marker.Name)
+
+	// walk the children in order, starting after the marker
+	sortBy := opts.SortBy
+	if sortBy != object.SortBySize && sortBy != object.SortByModified {
+		sortBy = object.SortByName
+	}
+	keys := *d.sorted(sortBy)
+	child := func(n int) object.Entry {
+		if opts.Descending {
+			n = len(keys) - 1 - n
+		}
+		return d.children[keys[n]]
+	}
+	start := 0
+	if opts.Marker != "" {
+		less := object.ListOptions{SortBy: sortBy, Descending: opts.Descending}.Less
+		start = sort.Search(len(keys), func(n int) bool {
+			return less(marker, child(n))
+		})
+	}
+	end, more := len(keys), false
+	if opts.Limit > 0 && end-start > opts.Limit {
+		end, more = start+opts.Limit, true
+	}
+	entries := make([]object.Entry, 0, end-start)
+	for n := start; n < end; n++ {
+		e := child(n)
+		_, e.Name = splitObjectKey(e.Name)
+		e.Metadata = copyMetadata(e.Metadata)
+		entries = append(entries, e)
+	}
+	return entries, more, nil
+}
+
+// GarbageSectors implements api.ObjectStore.
+func (es *EphemeralObjectStore) GarbageSectors() ([]slab.Sector, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	sectors := make([]slab.Sector, len(es.garbage))
+	for i, sector := range es.garbage {
+		sectors[i] = slab.Sector{
+			Host: es.hosts[sector.HostID],
+			Root: sector.Root,
+		}
+	}
+	return sectors, nil
+}
+
+// RemoveGarbageSectors implements api.ObjectStore.
+func (es *EphemeralObjectStore) RemoveGarbageSectors(sectors []slab.Sector) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	remove := make(map[slab.Sector]bool, len(sectors))
+	for _, sector := range sectors {
+		remove[sector] = true
+	}
+	garbage := es.garbage[:0]
+	for _, sector := range es.garbage {
+		if !remove[slab.Sector{Host: es.hosts[sector.HostID], Root: sector.Root}] {
+			garbage = append(garbage, sector)
+		} else {
+			es.changes.mark("garbage", sector.key())
+		}
+	}
+	es.garbage = garbage
+	return nil
+}
+
+func (es *EphemeralObjectStore) bucket(name string, b *refBucket) object.Bucket {
+	return object.Bucket{
+		Name:     name,
+		Created:  b.Created,
+		Size:     b.size,
+		Settings: b.Settings,
+	}
+}
+
+// Buckets implements api.ObjectStore.
+func (es *EphemeralObjectStore) Buckets() ([]object.Bucket, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	buckets := make([]object.Bucket, 0, len(es.buckets))
+	for name, b := range es.buckets {
+		buckets = append(buckets, es.bucket(name, b))
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+	return buckets, nil
+}
+
+// Bucket implements api.ObjectStore.
+func (es *EphemeralObjectStore) Bucket(name string) (object.Bucket, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	b, ok := es.buckets[name]
+	if !ok {
+		return object.Bucket{}, errors.New("bucket not found")
+	}
+	return es.bucket(name, b), nil
+}
+
+// SetBucket implements api.ObjectStore. If the bucket does not exist, it is
+// created.
+func (es *EphemeralObjectStore) SetBucket(name string, settings object.BucketSettings) error {
+	return es.setBucketAt(name, settings, time.Now().UTC())
+}
+
+func (es *EphemeralObjectStore) setBucketAt(name string, settings object.BucketSettings, now time.Time) error {
+	if err := validateBucketName(name); err != nil {
+		return err
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	b, ok := es.buckets[name]
+	if !ok {
+		b = &refBucket{Created: now}
+		es.buckets[name] = b
+	}
+	b.Settings = settings
+	es.changes.mark("buckets", name)
+	es.pruneUnversioned(objectKey(name, ""))
+	return nil
+}
+
+// checkBucket returns an error if the named bucket does not exist. es.mu must
+// be held.
+func (es *EphemeralObjectStore) checkBucket(name string) error {
+	if _, ok := es.buckets[name]; !ok {
+		return errors.New("bucket not found")
+	}
+	return nil
+}
+
+// canDeleteBucket returns the error, if any, that deleting the named bucket
+// would return. es.mu must be held.
+func (es *EphemeralObjectStore) canDeleteBucket(name string) error {
+	if name == object.DefaultBucket {
+		return errors.New("cannot delete the default bucket")
+	}
 	for k := range es.objects {
-		if strings.HasPrefix(k, path) {
-			if rem := k[len(path):]; strings.ContainsRune(rem, '/') {
-				k = path + rem[:strings.IndexRune(rem, '/')+1]
-			}
-			if !seen[k] {
-				keys = append(keys, k)
-				seen[k] = true
-			}
+		if b, _ := splitObjectKey(k); b == name {
+			return errors.New("bucket is not empty")
 		}
 	}
-	sort.Strings(keys)
-	return keys
+	for k := range es.versions {
+		if b, _ := splitObjectKey(k); b == name {
+			return errors.New("bucket is not empty")
+		}
+	}
+	return nil
+}
+
+// DeleteBucket implements api.ObjectStore. Only empty buckets can be deleted,
+// and the default bucket cannot be deleted at all.
+func (es *EphemeralObjectStore) DeleteBucket(name string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if err := es.canDeleteBucket(name); err != nil {
+		return err
+	} else if _, ok := es.buckets[name]; !ok {
+		return nil
+	}
+	for prefix := range es.versioning {
+		if b, _ := splitObjectKey(prefix); b == name {
+			delete(es.versioning, prefix)
+			es.changes.mark("versioning", prefix)
+		}
+	}
+	delete(es.buckets, name)
+	es.changes.mark("buckets", name)
+	return nil
 }
 
 // NewEphemeralObjectStore returns a new EphemeralObjectStore.
@@ -174,9 +981,53 @@ func NewEphemeralObjectStore() *EphemeralObjectStore {
 	return &EphemeralObjectStore{
 		slabs:   make(map[string]refSlab),
 		objects: make(map[string]refObject),
+		dirs:    make(map[string]*dirIndex),
+		buckets: map[string]*refBucket{
+			object.DefaultBucket: {Created: time.Now().UTC()},
+		},
+
+		versions:   make(map[string][]objectVersion),
+		versioning: make(map[string]object.VersioningPolicy),
 	}
 }
 
+// persistData returns the state of the store. The caller must not modify it.
+func (es *EphemeralObjectStore) persistData() jsonObjectPersistData {
+	return jsonObjectPersistData{
+		Hosts:      es.hosts,
+		Slabs:      es.slabs,
+		Objects:    es.objects,
+		Garbage:    es.garbage,
+		Versions:   es.versions,
+		Versioning: es.versioning,
+		Buckets:    es.buckets,
+	}
+}
+
+// setPersistData replaces the state of the store with p.
+func (es *EphemeralObjectStore) setPersistData(p jsonObjectPersistData) error {
+	es.hosts = p.Hosts
+	es.garbage = p.Garbage
+	es.buckets = p.Buckets
+	es.slabs = p.Slabs
+	if es.slabs == nil {
+		es.slabs = make(map[string]refSlab)
+	}
+	es.objects = p.Objects
+	if es.objects == nil {
+		es.objects = make(map[string]refObject)
+	}
+	es.versions = p.Versions
+	if es.versions == nil {
+		es.versions = make(map[string][]objectVersion)
+	}
+	es.versioning = p.Versioning
+	if es.versioning == nil {
+		es.versioning = make(map[string]object.VersioningPolicy)
+	}
+	return es.rebuildIndex()
+}
+
 // JSONObjectStore implements api.ObjectStore in memory, backed by a JSON file.
 type JSONObjectStore struct {
 	*EphemeralObjectStore
@@ -184,20 +1035,19 @@ type JSONObjectStore struct {
 }
 
 type jsonObjectPersistData struct {
-	Hosts   []consensus.PublicKey
-	Slabs   map[string]refSlab
-	Objects map[string]refObject
+	Hosts      []consensus.PublicKey
+	Slabs      map[string]refSlab
+	Objects    map[string]refObject
+	Garbage    []refSector
+	Versions   map[string][]objectVersion
+	Versioning map[string]object.VersioningPolicy
+	Buckets    map[string]*refBucket
 }
 
 func (s *JSONObjectStore) save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	p := jsonObjectPersistData{
-		Hosts:   s.hosts,
-		Slabs:   s.slabs,
-		Objects: s.objects,
-	}
-	js, err := json.MarshalIndent(p, "", "  ")
+	js, err := json.MarshalIndent(s.persistData(), "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to encode JSON: %w", err)
 	}
@@ -230,21 +1080,104 @@ func (s *JSONObjectStore) load() error {
 	} else if err := json.Unmarshal(js, &p); err != nil {
 		return err
 	}
-	s.EphemeralObjectStore.hosts = p.Hosts
-	s.EphemeralObjectStore.slabs = p.Slabs
-	s.EphemeralObjectStore.objects = p.Objects
+	if p.Buckets == nil {
+		// migrate objects stored before buckets were introduced into the
+		// default bucket
+		p.Buckets = map[string]*refBucket{
+			object.DefaultBucket: {Created: time.Now().UTC()},
+		}
+		objects := make(map[string]refObject, len(p.Objects))
+		for k, o := range p.Objects {
+			objects[objectKey(object.DefaultBucket, k)] = o
+		}
+		p.Objects = objects
+		versions := make(map[string][]objectVersion, len(p.Versions))
+		for k, vs := range p.Versions {
+			versions[objectKey(object.DefaultBucket, k)] = vs
+		}
+		p.Versions = versions
+		versioning := make(map[string]object.VersioningPolicy, len(p.Versioning))
+		for prefix, policy := range p.Versioning {
+			versioning[objectKey(object.DefaultBucket, prefix)] = policy
+		}
+		p.Versioning = versioning
+	}
+	if err := s.EphemeralObjectStore.setPersistData(p); err != nil {
+		return err
+	}
+	s.EphemeralObjectStore.sweepSlabs(time.Now().UTC())
 	return nil
 }
 
 // Put implements api.ObjectStore.
-func (s *JSONObjectStore) Put(key string, o object.Object) error {
-	s.EphemeralObjectStore.Put(key, o)
+func (s *JSONObjectStore) Put(bucket, key string, o object.Object) error {
+	if err := s.EphemeralObjectStore.Put(bucket, key, o); err != nil {
+		return err
+	}
 	return s.save()
 }
 
 // Delete implements api.ObjectStore.
-func (s *JSONObjectStore) Delete(key string) error {
-	s.EphemeralObjectStore.Delete(key)
+func (s *JSONObjectStore) Delete(bucket, key string) error {
+	s.EphemeralObjectStore.Delete(bucket, key)
+	return s.save()
+}
+
+// DeletePrefix implements api.ObjectStore.
+func (s *JSONObjectStore) DeletePrefix(bucket, prefix string, dryRun bool) ([]string, int64, error) {
+	keys, size, _ := s.EphemeralObjectStore.DeletePrefix(bucket, prefix, dryRun)
+	if dryRun || len(keys) == 0 {
+		return keys, size, nil
+	}
+	return keys, size, s.save()
+}
+
+// PruneVersions implements api.ObjectStore.
+func (s *JSONObjectStore) PruneVersions() error {
+	s.EphemeralObjectStore.PruneVersions()
+	return s.save()
+}
+
+// SetVersioningPolicy implements api.ObjectStore.
+func (s *JSONObjectStore) SetVersioningPolicy(bucket, prefix string, policy object.VersioningPolicy) error {
+	if err := s.EphemeralObjectStore.SetVersioningPolicy(bucket, prefix, policy); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// SetBucket implements api.ObjectStore.
+func (s *JSONObjectStore) SetBucket(name string, settings object.BucketSettings) error {
+	if err := s.EphemeralObjectStore.SetBucket(name, settings); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// DeleteBucket implements api.ObjectStore.
+func (s *JSONObjectStore) DeleteBucket(name string) error {
+	if err := s.EphemeralObjectStore.DeleteBucket(name); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// AddSlabs implements api.ObjectStore.
+func (s *JSONObjectStore) AddSlabs(slabs []slab.Slab) error {
+	s.EphemeralObjectStore.AddSlabs(slabs)
+	return s.save()
+}
+
+// SweepSlabs queues the sectors of slabs that were added by AddSlabs, but not
+// referenced by an object within unreferencedSlabGracePeriod, for deletion.
+func (s *JSONObjectStore) SweepSlabs() error {
+	s.EphemeralObjectStore.SweepSlabs()
+	return s.save()
+}
+
+// RemoveGarbageSectors implements api.ObjectStore.
+func (s *JSONObjectStore) RemoveGarbageSectors(sectors []slab.Sector) error {
+	s.EphemeralObjectStore.RemoveGarbageSectors(sectors)
 	return s.save()
 }
 
@@ -259,3 +1192,434 @@ func NewJSONObjectStore(dir string) (*JSONObjectStore, error) {
 	}
 	return s, nil
 }
+
+// BoltObjectStore implements api.ObjectStore in memory, backed by a bolt
+// database. Mutations are recorded in a journal before being applied, and
+// the modified entries are periodically checkpointed to the database.
+type BoltObjectStore struct {
+	*EphemeralObjectStore
+	db      *bolt.DB
+	journal *journal
+}
+
+var boltObjectTables = []string{"objects", "slabs", "hosts", "garbage", "versions", "versioning", "buckets"}
+
+type (
+	// Version IDs are random; entries record them so that replaying an entry
+	// reproduces them.
+	objectPutEntry struct {
+		Bucket    string
+		Key       string
+		Object    object.Object
+		Time      time.Time
+		VersionID string
+	}
+
+	objectDeleteEntry struct {
+		Bucket    string
+		Key       string
+		Time      time.Time
+		VersionID string
+	}
+
+	objectDeletePrefixEntry struct {
+		Bucket     string
+		Prefix     string
+		Time       time.Time
+		VersionIDs map[string]string
+	}
+
+	addSlabsEntry struct {
+		Slabs []slab.Slab
+		Time  time.Time
+	}
+
+	versioningEntry struct {
+		Bucket string
+		Prefix string
+		Policy object.VersioningPolicy
+	}
+
+	bucketEntry struct {
+		Name     string
+		Settings object.BucketSettings
+		Time     time.Time
+	}
+)
+
+func (s *BoltObjectStore) apply(op string, data json.RawMessage) error {
+	switch op {
+	case "put":
+		var e objectPutEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.putAt(e.Bucket, e.Key, e.Object, e.Time, e.VersionID)
+	case "delete":
+		var e objectDeleteEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.deleteAt(e.Bucket, e.Key, e.Time, e.VersionID)
+	case "deletePrefix":
+		var e objectDeletePrefixEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		_, _, err := s.EphemeralObjectStore.deletePrefixAt(e.Bucket, e.Prefix, false, e.Time, e.VersionIDs)
+		return err
+	case "addSlabs":
+		var e addSlabsEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.addSlabsAt(e.Slabs, e.Time)
+	case "sweepSlabs":
+		var now time.Time
+		if err := json.Unmarshal(data, &now); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.sweepSlabsAt(now)
+	case "removeGarbage":
+		var sectors []slab.Sector
+		if err := json.Unmarshal(data, &sectors); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.RemoveGarbageSectors(sectors)
+	case "pruneVersions":
+		var now time.Time
+		if err := json.Unmarshal(data, &now); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.pruneVersionsAt(now)
+	case "setVersioning":
+		var e versioningEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.SetVersioningPolicy(e.Bucket, e.Prefix, e.Policy)
+	case "setBucket":
+		var e bucketEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.setBucketAt(e.Name, e.Settings, e.Time)
+	case "deleteBucket":
+		var name string
+		if err := json.Unmarshal(data, &name); err != nil {
+			return err
+		}
+		return s.EphemeralObjectStore.DeleteBucket(name)
+	default:
+		return fmt.Errorf("unknown journal operation %q", op)
+	}
+}
+
+func (s *BoltObjectStore) commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var garbage map[string]bool
+	if len(s.changes["garbage"]) > 0 {
+		garbage = make(map[string]bool, len(s.garbage))
+		for _, sector := range s.garbage {
+			garbage[sector.key()] = true
+		}
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := createTables(tx, boltObjectTables...); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "seq", s.journal.seq); err != nil {
+			return err
+		}
+		return s.changes.write(tx, nil, func(table, key string) (v interface{}, ok bool) {
+			switch table {
+			case "objects":
+				v, ok = s.objects[key]
+			case "slabs":
+				v, ok = s.slabs[key]
+			case "hosts":
+				if id := binary.BigEndian.Uint32([]byte(key)); int(id) < len(s.hosts) {
+					v, ok = s.hosts[id], true
+				}
+			case "garbage":
+				v, ok = struct{}{}, garbage[key]
+			case "versions":
+				v, ok = s.versions[key]
+			case "versioning":
+				v, ok = s.versioning[key]
+			case "buckets":
+				v, ok = s.buckets[key]
+			}
+			return
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.changes = make(changeSet)
+	return nil
+}
+
+func (s *BoltObjectStore) load() (seq uint64, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		if err := getJSON(tx, "meta", "seq", &seq); err != nil {
+			return err
+		}
+		s.buckets = make(map[string]*refBucket)
+		err := tx.Bucket([]byte("buckets")).ForEach(func(k, js []byte) error {
+			b := new(refBucket)
+			s.buckets[string(k)] = b
+			return json.Unmarshal(js, b)
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket([]byte("objects")).ForEach(func(k, js []byte) error {
+			var ro refObject
+			if err := json.Unmarshal(js, &ro); err != nil {
+				return err
+			}
+			s.objects[string(k)] = ro
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket([]byte("slabs")).ForEach(func(k, js []byte) error {
+			var rs refSlab
+			if err := json.Unmarshal(js, &rs); err != nil {
+				return err
+			}
+			s.slabs[string(k)] = rs
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// keys are big-endian, so hosts are visited in ID order
+		err = tx.Bucket([]byte("hosts")).ForEach(func(k, js []byte) error {
+			var hostKey consensus.PublicKey
+			if err := json.Unmarshal(js, &hostKey); err != nil {
+				return err
+			}
+			s.hosts = append(s.hosts, hostKey)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket([]byte("garbage")).ForEach(func(k, _ []byte) error {
+			sector := refSector{HostID: binary.BigEndian.Uint32(k[:4])}
+			copy(sector.Root[:], k[4:])
+			s.garbage = append(s.garbage, sector)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket([]byte("versions")).ForEach(func(k, js []byte) error {
+			var vs []objectVersion
+			if err := json.Unmarshal(js, &vs); err != nil {
+				return err
+			}
+			s.versions[string(k)] = vs
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket([]byte("versioning")).ForEach(func(k, js []byte) error {
+			var policy object.VersioningPolicy
+			if err := json.Unmarshal(js, &policy); err != nil {
+				return err
+			}
+			s.versioning[string(k)] = policy
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return s.rebuildIndex()
+	})
+	return
+}
+
+// markAll marks every entry in the store as modified.
+func (s *BoltObjectStore) markAll() {
+	for key := range s.objects {
+		s.changes.mark("objects", key)
+	}
+	for id := range s.slabs {
+		s.changes.mark("slabs", id)
+	}
+	for id := range s.hosts {
+		s.changes.mark("hosts", hostIDKey(uint32(id)))
+	}
+	for _, sector := range s.garbage {
+		s.changes.mark("garbage", sector.key())
+	}
+	for key := range s.versions {
+		s.changes.mark("versions", key)
+	}
+	for prefix := range s.versioning {
+		s.changes.mark("versioning", prefix)
+	}
+	for name := range s.buckets {
+		s.changes.mark("buckets", name)
+	}
+}
+
+// check calls fn with s.mu held, so that a mutation can be validated before
+// it is journaled.
+func (s *BoltObjectStore) check(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn()
+}
+
+// Put implements api.ObjectStore.
+func (s *BoltObjectStore) Put(bucket, key string, o object.Object) error {
+	s.journal.mu.Lock()
+	defer s.journal.mu.Unlock()
+	if err := s.check(func() error { return s.canPut(bucket, key, o) }); err != nil {
+		return err
+	}
+	return s.journal.recordLocked(s, "put", objectPutEntry{bucket, key, o, time.Now().UTC(), newVersionID()})
+}
+
+// Delete implements api.ObjectStore.
+func (s *BoltObjectStore) Delete(bucket, key string) error {
+	return s.journal.record(s, "delete", objectDeleteEntry{bucket, key, time.Now().UTC(), newVersionID()})
+}
+
+// DeletePrefix implements api.ObjectStore.
+func (s *BoltObjectStore) DeletePrefix(bucket, prefix string, dryRun bool) ([]string, int64, error) {
+	s.journal.mu.Lock()
+	defer s.journal.mu.Unlock()
+	keys, size, _ := s.EphemeralObjectStore.DeletePrefix(bucket, prefix, true)
+	if dryRun || len(keys) == 0 {
+		return keys, size, nil
+	}
+	versionIDs := make(map[string]string, len(keys))
+	for _, key := range keys {
+		versionIDs[key] = newVersionID()
+	}
+	err := s.journal.recordLocked(s, "deletePrefix", objectDeletePrefixEntry{bucket, prefix, time.Now().UTC(), versionIDs})
+	return keys, size, err
+}
+
+// AddSlabs implements api.ObjectStore.
+func (s *BoltObjectStore) AddSlabs(slabs []slab.Slab) error {
+	return s.journal.record(s, "addSlabs", addSlabsEntry{slabs, time.Now().UTC()})
+}
+
+// SweepSlabs queues the sectors of slabs that were added by AddSlabs, but not
+// referenced by an object within unreferencedSlabGracePeriod, for deletion.
+func (s *BoltObjectStore) SweepSlabs() error {
+	return s.journal.record(s, "sweepSlabs", time.Now().UTC())
+}
+
+// PruneVersions implements api.ObjectStore.
+func (s *BoltObjectStore) PruneVersions() error {
+	return s.journal.record(s, "pruneVersions", time.Now().UTC())
+}
+
+// SetVersioningPolicy implements api.ObjectStore.
+func (s *BoltObjectStore) SetVersioningPolicy(bucket, prefix string, policy object.VersioningPolicy) error {
+	s.journal.mu.Lock()
+	defer s.journal.mu.Unlock()
+	if err := s.check(func() error { return s.checkBucket(bucket) }); err != nil {
+		return err
+	}
+	return s.journal.recordLocked(s, "setVersioning", versioningEntry{bucket, prefix, policy})
+}
+
+// SetBucket implements api.ObjectStore.
+func (s *BoltObjectStore) SetBucket(name string, settings object.BucketSettings) error {
+	if err := validateBucketName(name); err != nil {
+		return err
+	}
+	return s.journal.record(s, "setBucket", bucketEntry{name, settings, time.Now().UTC()})
+}
+
+// DeleteBucket implements api.ObjectStore.
+func (s *BoltObjectStore) DeleteBucket(name string) error {
+	s.journal.mu.Lock()
+	defer s.journal.mu.Unlock()
+	if err := s.check(func() error { return s.canDeleteBucket(name) }); err != nil {
+		return err
+	}
+	return s.journal.recordLocked(s, "deleteBucket", name)
+}
+
+// RemoveGarbageSectors implements api.ObjectStore.
+func (s *BoltObjectStore) RemoveGarbageSectors(sectors []slab.Sector) error {
+	return s.journal.record(s, "removeGarbage", sectors)
+}
+
+// Close writes a final checkpoint and closes the underlying database.
+func (s *BoltObjectStore) Close() error {
+	s.journal.mu.Lock()
+	defer s.journal.mu.Unlock()
+	if err := s.journal.checkpoint(s); err != nil {
+		return err
+	} else if err := s.journal.Close(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// NewBoltObjectStore returns a new BoltObjectStore. If the database does not
+// exist yet, the state of the JSONObjectStore in dir, if any, is imported.
+// Otherwise, any journal entries written after the last checkpoint are
+// replayed, and slabs that were uploaded but left unreferenced for longer than
+// unreferencedSlabGracePeriod are queued for deletion.
+func NewBoltObjectStore(dir string) (_ *BoltObjectStore, err error) {
+	db, fresh, err := openBoltDB(dir, "objects")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+	s := &BoltObjectStore{
+		EphemeralObjectStore: NewEphemeralObjectStore(),
+		db:                   db,
+	}
+	s.changes = make(changeSet)
+	var seq uint64
+	if fresh {
+		js := &JSONObjectStore{EphemeralObjectStore: s.EphemeralObjectStore, dir: dir}
+		if err := js.load(); err != nil {
+			return nil, err
+		}
+		s.markAll()
+	} else if seq, err = s.load(); err != nil {
+		return nil, err
+	}
+
+	j, entries, err := openJournal(filepath.Join(dir, "objects.journal"), seq)
+	if err != nil {
+		return nil, err
+	}
+	s.journal = j
+	if !fresh {
+		if err := j.replay(s, entries); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+	s.sweepSlabs(time.Now().UTC())
+	if err := j.checkpoint(s); err != nil {
+		j.Close()
+		return nil, err
+	} else if fresh {
+		if err := retireJSONFile(dir, "objects"); err != nil {
+			j.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
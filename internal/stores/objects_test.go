@@ -1,8 +1,12 @@
 package stores
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"go.sia.tech/renterd/object"
 	"go.sia.tech/renterd/slab"
@@ -19,7 +23,7 @@ func TestList(t *testing.T) {
 		"/gab/guub",
 	}
 	for _, path := range paths {
-		es.Put(path, object.Object{})
+		es.Put(object.DefaultBucket, path, object.Object{})
 	}
 	tests := []struct {
 		prefix string
@@ -31,13 +35,94 @@ func TestList(t *testing.T) {
 		{"/gab/", []string{"/gab/guub"}},
 	}
 	for _, test := range tests {
-		got := es.List(test.prefix)
+		entries, _, err := es.List(object.DefaultBucket, test.prefix, object.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name)
+		}
 		if !reflect.DeepEqual(got, test.want) {
 			t.Errorf("\nlist: %v\ngot:  %v\nwant: %v", test.prefix, got, test.want)
 		}
 	}
 }
 
+func TestListPagination(t *testing.T) {
+	es := NewEphemeralObjectStore()
+	objectWithSize := func(size uint32) object.Object {
+		return object.Object{Slabs: []slab.Slice{{
+			Slab:   slab.Slab{Key: slab.GenerateEncryptionKey()},
+			Length: size,
+		}}}
+	}
+	es.Put(object.DefaultBucket, "/a", objectWithSize(30))
+	es.Put(object.DefaultBucket, "/b", objectWithSize(10))
+	es.Put(object.DefaultBucket, "/c/d", objectWithSize(5))
+	es.Put(object.DefaultBucket, "/c/e/f", objectWithSize(7))
+	es.Put(object.DefaultBucket, "/d", objectWithSize(20))
+
+	names := func(entries []object.Entry) (names []string) {
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		return
+	}
+
+	// directories should report aggregates
+	entries, _, err := es.List(object.DefaultBucket, "/", object.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name == "/c/" && (e.Objects != 2 || e.Size != 12) {
+			t.Fatalf("wrong aggregates for /c/: %v objects, %v bytes", e.Objects, e.Size)
+		}
+	}
+
+	tests := []struct {
+		opts object.ListOptions
+		want []string
+		more bool
+	}{
+		{object.ListOptions{Limit: 2}, []string{"/a", "/b"}, true},
+		{object.ListOptions{Marker: "/b", Limit: 2}, []string{"/c/", "/d"}, false},
+		{object.ListOptions{Marker: "/bb"}, []string{"/c/", "/d"}, false},
+		{object.ListOptions{SortBy: object.SortBySize, Limit: 3}, []string{"/b", "/c/", "/d"}, true},
+		{object.ListOptions{SortBy: object.SortBySize, Marker: "20,/d", Limit: 3}, []string{"/a"}, false},
+		{object.ListOptions{SortBy: object.SortBySize, Descending: true, Marker: "20,/d"}, []string{"/c/", "/b"}, false},
+		{object.ListOptions{SortBy: object.SortBySize, Descending: true}, []string{"/a", "/d", "/c/", "/b"}, false},
+	}
+	for _, test := range tests {
+		entries, more, err := es.List(object.DefaultBucket, "/", test.opts)
+		if err != nil {
+			t.Fatal(err)
+		} else if got := names(entries); !reflect.DeepEqual(got, test.want) || more != test.more {
+			t.Errorf("\nlist: %+v\ngot:  %v (%v)\nwant: %v (%v)", test.opts, got, more, test.want, test.more)
+		}
+	}
+
+	// deleting the last object in a directory should remove it
+	es.Delete(object.DefaultBucket, "/c/d")
+	es.Delete(object.DefaultBucket, "/c/e/f")
+	if entries, _, _ := es.List(object.DefaultBucket, "/", object.ListOptions{}); !reflect.DeepEqual(names(entries), []string{"/a", "/b", "/d"}) {
+		t.Fatalf("unexpected entries: %v", names(entries))
+	}
+
+	// listings should resume after a marker whose entry no longer exists
+	opts := object.ListOptions{SortBy: object.SortBySize, Marker: "12,/c/"}
+	if entries, _, err := es.List(object.DefaultBucket, "/", opts); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(names(entries), []string{"/d", "/a"}) {
+		t.Fatalf("unexpected entries: %v", names(entries))
+	}
+	opts.Marker = "/c/"
+	if _, _, err := es.List(object.DefaultBucket, "/", opts); err == nil {
+		t.Fatal("expected error for invalid marker")
+	}
+}
+
 func randomObject() (o object.Object) {
 	n := frand.Intn(10)
 	o.Slabs = make([]slab.Slice, n)
@@ -63,6 +148,18 @@ func randomObject() (o object.Object) {
 	return
 }
 
+// objectOfSize returns an object with a single slab of the specified length.
+func objectOfSize(length uint32) object.Object {
+	o := randomObject()
+	for len(o.Slabs) == 0 {
+		o = randomObject()
+	}
+	o.Slabs = o.Slabs[:1]
+	o.Slabs[0].Offset = 0
+	o.Slabs[0].Length = length
+	return o
+}
+
 func TestJSONObjectStore(t *testing.T) {
 	dir := t.TempDir()
 	os, err := NewJSONObjectStore(dir)
@@ -72,15 +169,26 @@ func TestJSONObjectStore(t *testing.T) {
 
 	// put an object
 	obj := randomObject()
-	if err := os.Put("foo", obj); err != nil {
+	obj.Metadata.ContentType = "text/plain"
+	obj.Metadata.User = map[string]string{"foo": "bar"}
+	if err := os.Put(object.DefaultBucket, "foo", obj); err != nil {
 		t.Fatal(err)
 	}
 
 	// get the object
-	got, err := os.Get("foo")
+	got, err := os.Get(object.DefaultBucket, "foo")
 	if err != nil {
 		t.Fatal("object not found")
-	} else if !reflect.DeepEqual(got, obj) {
+	} else if got.Metadata.Created.IsZero() || got.Metadata.Modified.IsZero() {
+		t.Fatal("object timestamps were not set")
+	} else if got.Metadata.ETag != obj.ComputeETag() {
+		t.Fatal("object ETag was not set")
+	}
+	obj.Metadata.Created = got.Metadata.Created
+	obj.Metadata.Modified = got.Metadata.Modified
+	obj.Metadata.ETag = got.Metadata.ETag
+	obj.Metadata.VersionID = object.NullVersionID
+	if !reflect.DeepEqual(got, obj) {
 		t.Fatal("objects are not equal")
 	}
 
@@ -91,10 +199,429 @@ func TestJSONObjectStore(t *testing.T) {
 	}
 
 	// get the object
-	got, err = os.Get("foo")
+	got, err = os.Get(object.DefaultBucket, "foo")
 	if err != nil {
 		t.Fatal("object not found")
 	} else if !reflect.DeepEqual(got, obj) {
 		t.Fatal("objects are not equal")
 	}
 }
+
+func TestGarbageSectors(t *testing.T) {
+	es := NewEphemeralObjectStore()
+	obj := randomObject()
+	var numSectors int
+	for _, ss := range obj.Slabs {
+		numSectors += len(ss.Shards)
+	}
+	es.Put(object.DefaultBucket, "foo", obj)
+	es.Put(object.DefaultBucket, "bar", obj)
+
+	// sectors should only be queued once the last reference is dropped
+	es.Delete(object.DefaultBucket, "foo")
+	if sectors, _ := es.GarbageSectors(); len(sectors) != 0 {
+		t.Fatalf("expected no garbage sectors, got %v", len(sectors))
+	}
+	es.Delete(object.DefaultBucket, "bar")
+	if sectors, _ := es.GarbageSectors(); len(sectors) != numSectors {
+		t.Fatalf("expected %v garbage sectors, got %v", numSectors, len(sectors))
+	}
+
+	// referencing the slabs again should remove them from the queue
+	es.Put(object.DefaultBucket, "baz", obj)
+	if sectors, _ := es.GarbageSectors(); len(sectors) != 0 {
+		t.Fatalf("expected no garbage sectors, got %v", len(sectors))
+	}
+	es.Delete(object.DefaultBucket, "baz")
+	sectors, _ := es.GarbageSectors()
+	if len(sectors) != numSectors {
+		t.Fatalf("expected %v garbage sectors, got %v", numSectors, len(sectors))
+	}
+	es.RemoveGarbageSectors(sectors)
+	if sectors, _ := es.GarbageSectors(); len(sectors) != 0 {
+		t.Fatalf("expected no garbage sectors, got %v", len(sectors))
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	es := NewEphemeralObjectStore()
+	paths := []string{
+		"/foo/bar",
+		"/foo/baz/quux",
+		"/foobar",
+		"/gab/guub",
+	}
+	var size int64
+	for _, path := range paths {
+		o := randomObject()
+		if path != "/foobar" && path != "/gab/guub" {
+			size += o.Size()
+		}
+		es.Put(object.DefaultBucket, path, o)
+	}
+
+	// a dry run should not delete anything
+	want := []string{"/foo/bar", "/foo/baz/quux"}
+	keys, n, err := es.DeletePrefix(object.DefaultBucket, "/foo/", true)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(keys, want) || n != size {
+		t.Fatalf("dry run: got %v (%v), want %v (%v)", keys, n, want, size)
+	} else if got, _, _ := es.List(object.DefaultBucket, "/foo/", object.ListOptions{}); len(got) != 2 {
+		t.Fatalf("dry run deleted objects: %v", got)
+	}
+
+	keys, n, err = es.DeletePrefix(object.DefaultBucket, "/foo/", false)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(keys, want) || n != size {
+		t.Fatalf("got %v (%v), want %v (%v)", keys, n, want, size)
+	}
+	var remaining []string
+	entries, _, _ := es.List(object.DefaultBucket, "/", object.ListOptions{})
+	for _, e := range entries {
+		remaining = append(remaining, e.Name)
+	}
+	if !reflect.DeepEqual(remaining, []string{"/foobar", "/gab/"}) {
+		t.Fatalf("unexpected remaining objects: %v", remaining)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	es := NewEphemeralObjectStore()
+	numGarbage := func() int {
+		sectors, _ := es.GarbageSectors()
+		return len(sectors)
+	}
+
+	nonEmptyObject := func() object.Object {
+		o := randomObject()
+		for len(o.Slabs) == 0 {
+			o = randomObject()
+		}
+		return o
+	}
+
+	// without versioning, overwriting an object should release its slabs
+	es.Put(object.DefaultBucket, "/foo", nonEmptyObject())
+	es.Put(object.DefaultBucket, "/foo", object.Object{})
+	if numGarbage() == 0 {
+		t.Fatal("overwritten object's slabs were not released")
+	}
+	sectors, _ := es.GarbageSectors()
+	es.RemoveGarbageSectors(sectors)
+
+	// with versioning, prior versions should be retained
+	es.SetVersioningPolicy(object.DefaultBucket, "/ver/", object.VersioningPolicy{Enabled: true, KeepVersions: 2})
+	var ids []string
+	for i := 0; i < 3; i++ {
+		es.Put(object.DefaultBucket, "/ver/foo", nonEmptyObject())
+		got, _ := es.Get(object.DefaultBucket, "/ver/foo")
+		if got.Metadata.VersionID == "" {
+			t.Fatal("missing version ID")
+		}
+		ids = append(ids, got.Metadata.VersionID)
+	}
+	if numGarbage() != 0 {
+		t.Fatal("versioned object's slabs were released")
+	}
+	for _, id := range ids {
+		if _, err := es.GetVersion(object.DefaultBucket, "/ver/foo", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a fourth version should cause the first to be pruned
+	es.Put(object.DefaultBucket, "/ver/foo", nonEmptyObject())
+	if _, err := es.GetVersion(object.DefaultBucket, "/ver/foo", ids[0]); err == nil {
+		t.Fatal("expected first version to be pruned")
+	} else if numGarbage() == 0 {
+		t.Fatal("pruned version's slabs were not released")
+	}
+
+	// deleting should create a delete marker, pruning the second version
+	es.Delete(object.DefaultBucket, "/ver/foo")
+	if _, err := es.Get(object.DefaultBucket, "/ver/foo"); err == nil {
+		t.Fatal("deleted object should not be retrievable")
+	}
+	versions, err := es.Versions(object.DefaultBucket, "/ver/foo")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(versions) != 3 || !versions[0].DeleteMarker || !versions[0].Latest || versions[2].ID != ids[2] {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if _, err := es.GetVersion(object.DefaultBucket, "/ver/foo", ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	// objects stored before versioning was enabled should have the null version
+	es.Put(object.DefaultBucket, "/pre/foo", nonEmptyObject())
+	es.SetVersioningPolicy(object.DefaultBucket, "/pre/", object.VersioningPolicy{Enabled: true})
+	es.Put(object.DefaultBucket, "/pre/foo", nonEmptyObject())
+	versions, err = es.Versions(object.DefaultBucket, "/pre/foo")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(versions) != 2 || versions[1].ID != object.NullVersionID {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if _, err := es.GetVersion(object.DefaultBucket, "/pre/foo", object.NullVersionID); err != nil {
+		t.Fatal(err)
+	}
+
+	// versions written at the same instant should have distinct IDs
+	now := time.Now().UTC()
+	es.putAt(object.DefaultBucket, "/ver/bar", nonEmptyObject(), now, newVersionID())
+	es.putAt(object.DefaultBucket, "/ver/bar", nonEmptyObject(), now, newVersionID())
+	if versions, err := es.Versions(object.DefaultBucket, "/ver/bar"); err != nil {
+		t.Fatal(err)
+	} else if len(versions) != 2 || versions[0].ID == versions[1].ID {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+
+	// removing a policy should prune the versions it retained
+	sectors, _ = es.GarbageSectors()
+	es.RemoveGarbageSectors(sectors)
+	es.SetVersioningPolicy(object.DefaultBucket, "/ver/", object.VersioningPolicy{})
+	if versions, err := es.Versions(object.DefaultBucket, "/ver/bar"); err != nil {
+		t.Fatal(err)
+	} else if len(versions) != 1 || !versions[0].Latest {
+		t.Fatalf("unexpected versions: %+v", versions)
+	} else if _, err := es.Versions(object.DefaultBucket, "/ver/foo"); err == nil {
+		t.Fatal("expected deleted object's versions to be pruned")
+	} else if numGarbage() == 0 {
+		t.Fatal("pruned versions' slabs were not released")
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	es := NewEphemeralObjectStore()
+	if err := es.SetBucket("Invalid_Name", object.BucketSettings{}); err == nil {
+		t.Fatal("expected invalid bucket name to be rejected")
+	} else if err := es.Put("photos", "/foo", randomObject()); err == nil {
+		t.Fatal("expected put to nonexistent bucket to fail")
+	}
+
+	// objects in different buckets should not collide
+	obj := objectOfSize(100)
+	if err := es.SetBucket("photos", object.BucketSettings{Quota: 100}); err != nil {
+		t.Fatal(err)
+	} else if err := es.Put("photos", "/foo", obj); err != nil {
+		t.Fatal(err)
+	} else if _, err := es.Get(object.DefaultBucket, "/foo"); err == nil {
+		t.Fatal("object leaked into default bucket")
+	} else if entries, _, _ := es.List("photos", "/", object.ListOptions{}); len(entries) != 1 || entries[0].Name != "/foo" {
+		t.Fatal("bad listing:", entries)
+	} else if b, _ := es.Bucket("photos"); b.Size != obj.Size() {
+		t.Fatalf("expected bucket size %v, got %v", obj.Size(), b.Size)
+	}
+
+	// the quota should be enforced, but overwrites should be allowed
+	if err := es.Put("photos", "/bar", objectOfSize(1)); err == nil {
+		t.Fatal("expected quota to be enforced")
+	} else if err := es.Put("photos", "/foo", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	// only empty, non-default buckets can be deleted
+	if err := es.DeleteBucket(object.DefaultBucket); err == nil {
+		t.Fatal("expected default bucket deletion to fail")
+	} else if err := es.DeleteBucket("photos"); err == nil {
+		t.Fatal("expected non-empty bucket deletion to fail")
+	}
+	es.Delete("photos", "/foo")
+	if b, _ := es.Bucket("photos"); b.Size != 0 {
+		t.Fatal("bucket size not updated after delete:", b.Size)
+	} else if err := es.DeleteBucket("photos"); err != nil {
+		t.Fatal(err)
+	} else if buckets, _ := es.Buckets(); len(buckets) != 1 || buckets[0].Name != object.DefaultBucket {
+		t.Fatal("unexpected buckets:", buckets)
+	}
+}
+
+func TestBucketMigration(t *testing.T) {
+	// write a store in the pre-bucket format
+	dir := t.TempDir()
+	js, _ := json.Marshal(jsonObjectPersistData{
+		Objects:    map[string]refObject{"/foo": {Key: object.GenerateEncryptionKey()}},
+		Versioning: map[string]object.VersioningPolicy{"/ver/": {Enabled: true}},
+	})
+	if err := os.WriteFile(filepath.Join(dir, "objects.json"), js, 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewJSONObjectStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := s.Get(object.DefaultBucket, "/foo"); err != nil {
+		t.Fatal("object was not migrated to default bucket")
+	} else if policies, _ := s.VersioningPolicies(object.DefaultBucket); !policies["/ver/"].Enabled {
+		t.Fatal("versioning policy was not migrated to default bucket")
+	}
+
+	// a store with objects in unknown buckets should fail to load
+	js, _ = json.Marshal(jsonObjectPersistData{
+		Buckets: map[string]*refBucket{object.DefaultBucket: {}},
+		Objects: map[string]refObject{objectKey("photos", "/foo"): {Key: object.GenerateEncryptionKey()}},
+	})
+	dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "objects.json"), js, 0660); err != nil {
+		t.Fatal(err)
+	} else if _, err := NewJSONObjectStore(dir); err == nil {
+		t.Fatal("expected store with unknown bucket to fail to load")
+	}
+}
+
+func TestBoltObjectStore(t *testing.T) {
+	dir := t.TempDir()
+
+	// create a JSON store, which should be migrated
+	js, err := NewJSONObjectStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated := randomObject()
+	if err := js.Put(object.DefaultBucket, "/migrated", migrated); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewBoltObjectStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(filepath.Join(dir, "objects.json")); !os.IsNotExist(err) {
+		t.Fatal("JSON file was not retired after migration")
+	} else if _, err := s.Get(object.DefaultBucket, "/migrated"); err != nil {
+		t.Fatal("object was not migrated:", err)
+	}
+
+	// exercise each table
+	if err := s.SetBucket("photos", object.BucketSettings{MinShards: 2}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetVersioningPolicy("photos", "/ver/", object.VersioningPolicy{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	obj := randomObject()
+	for i := 0; i < 2; i++ {
+		if err := s.Put("photos", "/ver/foo", randomObject()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("photos", "/bar", obj); err != nil {
+		t.Fatal(err)
+	} else if err := s.Delete(object.DefaultBucket, "/migrated"); err != nil {
+		t.Fatal(err)
+	}
+	wantGarbage, _ := s.GarbageSectors()
+	wantBuckets, _ := s.Buckets()
+	wantVersions, _ := s.Versions("photos", "/ver/foo")
+	want, _ := s.Get("photos", "/bar")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reload the store
+	s, err = NewBoltObjectStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, err := s.Get("photos", "/bar"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Fatal("objects are not equal")
+	} else if _, err := s.Get(object.DefaultBucket, "/migrated"); err == nil {
+		t.Fatal("deleted object was persisted")
+	} else if got, _ := s.Versions("photos", "/ver/foo"); !reflect.DeepEqual(got, wantVersions) {
+		t.Fatal("versions are not equal")
+	} else if got, _ := s.Buckets(); !reflect.DeepEqual(got, wantBuckets) {
+		t.Fatal("buckets are not equal:", got, wantBuckets)
+	} else if got, _ := s.GarbageSectors(); len(got) != len(wantGarbage) {
+		t.Fatalf("expected %v garbage sectors, got %v", len(wantGarbage), len(got))
+	}
+}
+
+func TestBoltObjectStoreJournal(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewBoltObjectStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := randomObject()
+	if err := s.Put(object.DefaultBucket, "/foo", obj); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := s.Get(object.DefaultBucket, "/foo")
+
+	// record an uploaded slab that is never referenced by an object
+	orphan := randomObject()
+	for len(orphan.Slabs) == 0 {
+		orphan = randomObject()
+	}
+	if err := s.AddSlabs([]slab.Slab{orphan.Slabs[0].Slab}); err != nil {
+		t.Fatal(err)
+	}
+
+	// record versions, whose random IDs must survive replay
+	if err := s.SetVersioningPolicy(object.DefaultBucket, "/ver/", object.VersioningPolicy{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Put(object.DefaultBucket, "/ver/foo", randomObject()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantVersions, _ := s.Versions(object.DefaultBucket, "/ver/foo")
+	if wantVersions[0].ID == wantVersions[1].ID {
+		t.Fatal("versions have the same ID")
+	}
+
+	// invalid mutations should not be journaled
+	seq := s.journal.seq
+	if err := s.Put("nonexistent", "/foo", obj); err == nil {
+		t.Fatal("expected put to nonexistent bucket to fail")
+	} else if err := s.DeleteBucket(object.DefaultBucket); err == nil {
+		t.Fatal("expected default bucket deletion to fail")
+	} else if s.journal.seq != seq {
+		t.Fatal("invalid mutations were journaled")
+	}
+
+	// simulate a crash: close without checkpointing, leaving a torn entry at
+	// the end of the journal
+	s.journal.f.Write([]byte(`{"seq":3,"op":"put","da`))
+	s.journal.Close()
+	s.db.Close()
+
+	s, err = NewBoltObjectStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, err := s.Get(object.DefaultBucket, "/foo"); err != nil {
+		t.Fatal("journaled object was lost:", err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Fatal("replayed object does not match original")
+	} else if got, _ := s.Versions(object.DefaultBucket, "/ver/foo"); !reflect.DeepEqual(got, wantVersions) {
+		t.Fatal("replayed versions do not match originals")
+	}
+
+	// the unreferenced slab may still be awaiting its object, so it should
+	// only be swept once the grace period has passed
+	if garbage, _ := s.GarbageSectors(); len(garbage) != 0 {
+		t.Fatal("recently added slab was queued for deletion")
+	} else if err := s.SweepSlabs(); err != nil {
+		t.Fatal(err)
+	} else if garbage, _ := s.GarbageSectors(); len(garbage) != 0 {
+		t.Fatal("recently added slab was queued for deletion")
+	} else if err := s.journal.record(s, "sweepSlabs", time.Now().Add(unreferencedSlabGracePeriod)); err != nil {
+		t.Fatal(err)
+	} else if garbage, _ := s.GarbageSectors(); len(garbage) != len(orphan.Slabs[0].Shards) {
+		t.Fatalf("expected %v orphaned sectors to be queued for deletion, got %v", len(orphan.Slabs[0].Shards), len(garbage))
+	}
+
+	// the torn entry should have been discarded, so new entries can be
+	// appended
+	if err := s.Delete(object.DefaultBucket, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.Get(object.DefaultBucket, "/foo"); err == nil {
+		t.Fatal("object was not deleted")
+	}
+}
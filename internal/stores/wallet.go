@@ -1,27 +1,95 @@
 package stores
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
+	"gitlab.com/NebulousLabs/bolt"
 	"go.sia.tech/renterd/internal/consensus"
 	"go.sia.tech/renterd/wallet"
 	"go.sia.tech/siad/modules"
 	"go.sia.tech/siad/types"
 )
 
-// EphemeralWalletStore implements wallet.SingleAddressStore in memory.
+// EphemeralWalletStore implements wallet.SeedStore in memory.
 type EphemeralWalletStore struct {
 	tip     consensus.ChainIndex
 	ccid    modules.ConsensusChangeID
-	addr    types.UnlockHash
 	scElems []wallet.SiacoinElement
 	txns    []wallet.Transaction
 	mu      sync.Mutex
+
+	// values of every owned output ever seen, including spent outputs, so that
+	// the value of a transaction's inputs can be determined
+	outputValues map[types.OutputID]types.Currency
+
+	// expiration of each output reserved by a funded transaction
+	reserved map[types.OutputID]time.Time
+
+	// transaction sets originating from the wallet, tracked until they
+	// confirm
+	pending map[types.TransactionID]wallet.PendingTransaction
+
+	// The store watches every address up to gap addresses beyond the last
+	// address that was issued or received an output.
+	deriveAddr func(index uint64) types.UnlockHash
+	gap        uint64
+	addrs      map[types.UnlockHash]uint64
+	watched    uint64
+	issued     uint64
+	used       uint64
+
+	changes changeSet
+}
+
+// watch derives any addresses within the gap limit that are not yet watched.
+func (s *EphemeralWalletStore) watch() {
+	limit := s.issued
+	if s.used > limit {
+		limit = s.used
+	}
+	for ; s.watched < limit+s.gap; s.watched++ {
+		s.addrs[s.deriveAddr(s.watched)] = s.watched
+	}
+}
+
+// AddressIndex implements wallet.SeedStore.
+func (s *EphemeralWalletStore) AddressIndex(addr types.UnlockHash) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, ok := s.addrs[addr]
+	return index, ok
+}
+
+// Addresses implements wallet.SeedStore.
+func (s *EphemeralWalletStore) Addresses() ([]wallet.AddressInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]wallet.AddressInfo, s.issued)
+	for addr, index := range s.addrs {
+		if index < s.issued {
+			addrs[index] = wallet.AddressInfo{Address: addr, Index: index}
+		}
+	}
+	return addrs, nil
+}
+
+// IssueAddress implements wallet.SeedStore.
+func (s *EphemeralWalletStore) IssueAddress() (wallet.AddressInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := s.issued
+	s.issued++
+	s.watch()
+	return wallet.AddressInfo{Address: s.deriveAddr(index), Index: index}, nil
 }
 
 // Balance implements wallet.SingleAddressStore.
@@ -63,50 +131,217 @@ func (s *EphemeralWalletStore) Transactions(since time.Time, max int) ([]wallet.
 	return txns, nil
 }
 
-func transactionIsRelevant(txn types.Transaction, addr types.UnlockHash) bool {
+// Reservations implements wallet.SingleAddressStore.
+func (s *EphemeralWalletStore) Reservations() ([]wallet.Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs := make([]wallet.Reservation, 0, len(s.reserved))
+	for id, exp := range s.reserved {
+		rs = append(rs, wallet.Reservation{ID: id, Expiration: exp})
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Expiration.Before(rs[j].Expiration)
+	})
+	return rs, nil
+}
+
+// ReserveOutputs implements wallet.SingleAddressStore.
+func (s *EphemeralWalletStore) ReserveOutputs(ids []types.OutputID, expiration time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.reserved[id] = expiration
+		s.changes.mark("reservations", string(id[:]))
+	}
+	return nil
+}
+
+// ReleaseOutputs implements wallet.SingleAddressStore.
+func (s *EphemeralWalletStore) ReleaseOutputs(ids []types.OutputID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := s.reserved[id]; ok {
+			delete(s.reserved, id)
+			s.changes.mark("reservations", string(id[:]))
+		}
+	}
+	return nil
+}
+
+// TrackTransactionSet implements wallet.SeedStore.
+func (s *EphemeralWalletStore) TrackTransactionSet(txns []types.Transaction) error {
+	if len(txns) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pt := newPendingTransaction(txns)
+	s.pending[pt.ID] = pt
+	s.changes.mark("pending", string(pt.ID[:]))
+	return nil
+}
+
+// newPendingTransaction returns a newly tracked pending transaction set.
+func newPendingTransaction(txns []types.Transaction) wallet.PendingTransaction {
+	return wallet.PendingTransaction{
+		ID:             txns[len(txns)-1].ID(),
+		TransactionSet: append([]types.Transaction(nil), txns...),
+		Status:         wallet.PendingStatusPending,
+		Added:          time.Now(),
+	}
+}
+
+// PendingTransactions implements wallet.SeedStore.
+func (s *EphemeralWalletStore) PendingTransactions() ([]wallet.PendingTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pts := make([]wallet.PendingTransaction, 0, len(s.pending))
+	for _, pt := range s.pending {
+		pts = append(pts, pt)
+	}
+	sort.Slice(pts, func(i, j int) bool {
+		return pts[i].Added.Before(pts[j].Added)
+	})
+	return pts, nil
+}
+
+// MarkPendingFailed implements wallet.SeedStore.
+func (s *EphemeralWalletStore) MarkPendingFailed(id types.TransactionID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pt, err := s.failedPending(id, reason)
+	if err != nil {
+		return err
+	}
+	s.pending[id] = pt
+	s.changes.mark("pending", string(id[:]))
+	return nil
+}
+
+// failedPending returns the tracked transaction set with the specified ID,
+// marked as failed. s.mu must be held.
+func (s *EphemeralWalletStore) failedPending(id types.TransactionID, reason string) (wallet.PendingTransaction, error) {
+	pt, ok := s.pending[id]
+	if !ok {
+		return wallet.PendingTransaction{}, fmt.Errorf("transaction set %v is not tracked", id)
+	}
+	pt.Status = wallet.PendingStatusFailed
+	pt.Height = s.tip.Height
+	pt.Reason = reason
+	return pt, nil
+}
+
+// updatePending updates the status of the tracked transaction sets to reflect
+// the application of block at the specified height.
+func (s *EphemeralWalletStore) updatePending(block types.Block, height uint64) {
+	if len(s.pending) == 0 {
+		return
+	}
+	confirmed := make(map[types.TransactionID]bool)
+	spentBy := make(map[types.SiacoinOutputID]types.TransactionID)
+	for _, txn := range block.Transactions {
+		txid := txn.ID()
+		confirmed[txid] = true
+		for _, sci := range txn.SiacoinInputs {
+			spentBy[sci.ParentID] = txid
+		}
+	}
+	for id, pt := range s.pending {
+		switch {
+		case confirmed[id]:
+			pt.Status = wallet.PendingStatusConfirmed
+			pt.Height = height
+			pt.Reason = ""
+		case pt.Status != wallet.PendingStatusPending:
+			continue
+		default:
+			if reason := conflictingSpend(pt.TransactionSet, spentBy); reason != "" {
+				pt.Status = wallet.PendingStatusFailed
+				pt.Height = height
+				pt.Reason = reason
+				break
+			}
+			// drop parents that were confirmed, so that the rest of the set
+			// can still be rebroadcast
+			unconfirmed := pt.TransactionSet[:0:0]
+			for _, txn := range pt.TransactionSet {
+				if !confirmed[txn.ID()] {
+					unconfirmed = append(unconfirmed, txn)
+				}
+			}
+			if len(unconfirmed) == len(pt.TransactionSet) {
+				continue
+			}
+			pt.TransactionSet = unconfirmed
+		}
+		s.pending[id] = pt
+		s.changes.mark("pending", string(id[:]))
+	}
+}
+
+// conflictingSpend describes the first input of txns that spentBy records as
+// spent by a transaction outside the set, or returns the empty string if there
+// is none.
+func conflictingSpend(txns []types.Transaction, spentBy map[types.SiacoinOutputID]types.TransactionID) string {
+	inSet := make(map[types.TransactionID]bool)
+	for _, txn := range txns {
+		inSet[txn.ID()] = true
+	}
+	for _, txn := range txns {
+		for _, sci := range txn.SiacoinInputs {
+			if spender, ok := spentBy[sci.ParentID]; ok && !inSet[spender] {
+				return fmt.Sprintf("input %v was spent by transaction %v", sci.ParentID, spender)
+			}
+		}
+	}
+	return ""
+}
+
+func transactionIsRelevant(txn types.Transaction, owns func(types.UnlockHash) bool) bool {
 	for i := range txn.SiacoinInputs {
-		if txn.SiacoinInputs[i].UnlockConditions.UnlockHash() == addr {
+		if owns(txn.SiacoinInputs[i].UnlockConditions.UnlockHash()) {
 			return true
 		}
 	}
 	for i := range txn.SiacoinOutputs {
-		if txn.SiacoinOutputs[i].UnlockHash == addr {
+		if owns(txn.SiacoinOutputs[i].UnlockHash) {
 			return true
 		}
 	}
 	for i := range txn.SiafundInputs {
-		if txn.SiafundInputs[i].UnlockConditions.UnlockHash() == addr {
+		if owns(txn.SiafundInputs[i].UnlockConditions.UnlockHash()) {
 			return true
 		}
-		if txn.SiafundInputs[i].ClaimUnlockHash == addr {
+		if owns(txn.SiafundInputs[i].ClaimUnlockHash) {
 			return true
 		}
 	}
 	for i := range txn.SiafundOutputs {
-		if txn.SiafundOutputs[i].UnlockHash == addr {
+		if owns(txn.SiafundOutputs[i].UnlockHash) {
 			return true
 		}
 	}
 	for i := range txn.FileContracts {
 		for _, sco := range txn.FileContracts[i].ValidProofOutputs {
-			if sco.UnlockHash == addr {
+			if owns(sco.UnlockHash) {
 				return true
 			}
 		}
 		for _, sco := range txn.FileContracts[i].MissedProofOutputs {
-			if sco.UnlockHash == addr {
+			if owns(sco.UnlockHash) {
 				return true
 			}
 		}
 	}
 	for i := range txn.FileContractRevisions {
 		for _, sco := range txn.FileContractRevisions[i].NewValidProofOutputs {
-			if sco.UnlockHash == addr {
+			if owns(sco.UnlockHash) {
 				return true
 			}
 		}
 		for _, sco := range txn.FileContractRevisions[i].NewMissedProofOutputs {
-			if sco.UnlockHash == addr {
+			if owns(sco.UnlockHash) {
 				return true
 			}
 		}
@@ -114,82 +349,296 @@ func transactionIsRelevant(txn types.Transaction, addr types.UnlockHash) bool {
 	return false
 }
 
+// walletTransaction annotates a transaction relevant to the wallet with the
+// value it transfers and its type.
+func (s *EphemeralWalletStore) walletTransaction(txn types.Transaction, index consensus.ChainIndex, timestamp time.Time, owns func(types.UnlockHash) bool) wallet.Transaction {
+	wt := wallet.Transaction{
+		Raw:       txn,
+		Index:     index,
+		ID:        txn.ID(),
+		Timestamp: timestamp,
+	}
+	for _, out := range txn.SiacoinOutputs {
+		if owns(out.UnlockHash) {
+			wt.Inflow = wt.Inflow.Add(out.Value)
+		}
+	}
+	var funded bool
+	for _, in := range txn.SiacoinInputs {
+		if owns(in.UnlockConditions.UnlockHash()) {
+			wt.Outflow = wt.Outflow.Add(s.outputValues[types.OutputID(in.ParentID)])
+			funded = true
+		}
+	}
+	if funded {
+		for _, fee := range txn.MinerFees {
+			wt.Fee = wt.Fee.Add(fee)
+		}
+	}
+
+	switch {
+	case funded && len(txn.FileContracts) > 0:
+		// renewals are identified by classifyRenewals
+		wt.Type = wallet.TransactionTypeContractFormation
+	case funded:
+		wt.Type = wallet.TransactionTypeSend
+	case wt.Inflow.IsZero() && len(txn.FileContractRevisions) > 0:
+		wt.Type = wallet.TransactionTypeContractRevision
+	default:
+		wt.Type = wallet.TransactionTypeReceive
+	}
+	return wt
+}
+
+// finalRevisions returns the revisions in txn that finalize a contract, as the
+// host does when the contract is renewed.
+func finalRevisions(txn types.Transaction) (revs []types.FileContractRevision) {
+	for _, rev := range txn.FileContractRevisions {
+		if rev.NewRevisionNumber == math.MaxUint64 {
+			revs = append(revs, rev)
+		}
+	}
+	return
+}
+
+// formedContracts returns the IDs of the contracts with the specified unlock
+// hash that wt forms or renews.
+func formedContracts(wt wallet.Transaction, uh types.UnlockHash) (ids []types.FileContractID) {
+	if wt.Type != wallet.TransactionTypeContractFormation && wt.Type != wallet.TransactionTypeContractRenewal {
+		return nil
+	}
+	for i, fc := range wt.Raw.FileContracts {
+		if fc.UnlockHash == uh {
+			ids = append(ids, wt.Raw.FileContractID(uint64(i)))
+		}
+	}
+	return
+}
+
+// renewalOf returns the index of the transaction, before the i'th transaction,
+// that renewed the contract finalized by rev, or -1 if there is none. A renewed
+// contract keeps the unlock hash of its parent, so the renewal is the latest
+// contract with that unlock hash formed after the parent.
+func (s *EphemeralWalletStore) renewalOf(i int, rev types.FileContractRevision) int {
+	for j := i - 1; j >= 0; j-- {
+		ids := formedContracts(s.txns[j], rev.NewUnlockHash)
+		if len(ids) == 0 {
+			continue
+		}
+		for _, id := range ids {
+			if id == rev.ParentID {
+				return -1
+			}
+		}
+		return j
+	}
+	return -1
+}
+
+// classifyRenewals marks the contract formations that renew a contract, given
+// that the i'th transaction was just added. Since the host broadcasts the final
+// revision of the renewed contract separately from the renewal, either may be
+// confirmed first.
+func (s *EphemeralWalletStore) classifyRenewals(i int) {
+	wt := &s.txns[i]
+	for _, rev := range finalRevisions(wt.Raw) {
+		if j := s.renewalOf(i, rev); j >= 0 && s.txns[j].Type == wallet.TransactionTypeContractFormation {
+			s.txns[j].Type = wallet.TransactionTypeContractRenewal
+			s.changes.mark("transactions", txnIndexKey(j))
+		}
+	}
+	if wt.Type != wallet.TransactionTypeContractFormation {
+		return
+	}
+	for _, fc := range wt.Raw.FileContracts {
+	search:
+		for j := i - 1; j >= 0; j-- {
+			for _, rev := range finalRevisions(s.txns[j].Raw) {
+				if rev.NewUnlockHash == fc.UnlockHash {
+					if s.renewalOf(j, rev) < 0 {
+						wt.Type = wallet.TransactionTypeContractRenewal
+						return
+					}
+					break search
+				}
+			}
+			if len(formedContracts(s.txns[j], fc.UnlockHash)) > 0 {
+				break
+			}
+		}
+	}
+}
+
 // ProcessConsensusChange implements modules.ConsensusSetSubscriber.
 func (s *EphemeralWalletStore) ProcessConsensusChange(cc modules.ConsensusChange) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	owns := func(addr types.UnlockHash) bool {
+		_, ok := s.addrs[addr]
+		return ok
+	}
 	for _, diff := range cc.SiacoinOutputDiffs {
-		if diff.SiacoinOutput.UnlockHash != s.addr {
+		index, ok := s.addrs[diff.SiacoinOutput.UnlockHash]
+		if !ok {
 			continue
 		}
+		if _, ok := s.outputValues[types.OutputID(diff.ID)]; !ok {
+			s.outputValues[types.OutputID(diff.ID)] = diff.SiacoinOutput.Value
+			s.changes.mark("outputs", string(diff.ID[:]))
+		}
 		if diff.Direction == modules.DiffApply {
+			if index >= s.used {
+				s.used = index + 1
+				s.watch()
+			}
 			// add
 			s.scElems = append(s.scElems, wallet.SiacoinElement{
 				SiacoinOutput: diff.SiacoinOutput,
 				ID:            types.OutputID(diff.ID),
 			})
+			s.changes.mark("elements", string(diff.ID[:]))
 		} else {
-			// remove
+			// remove, along with any reservation, since the output has been
+			// spent
+			if _, ok := s.reserved[types.OutputID(diff.ID)]; ok {
+				delete(s.reserved, types.OutputID(diff.ID))
+				s.changes.mark("reservations", string(diff.ID[:]))
+			}
 			for i := range s.scElems {
 				if s.scElems[i].ID == types.OutputID(diff.ID) {
 					s.scElems[i] = s.scElems[len(s.scElems)-1]
 					s.scElems = s.scElems[:len(s.scElems)-1]
+					s.changes.mark("elements", string(diff.ID[:]))
 					break
 				}
 			}
 		}
 	}
 
-	for _, block := range cc.RevertedBlocks {
-		for _, txn := range block.Transactions {
-			if transactionIsRelevant(txn, s.addr) {
-				s.txns = s.txns[:len(s.txns)-1]
+	// sets that confirmed or failed in a reverted block are pending again
+	if len(cc.RevertedBlocks) > 0 {
+		for id, pt := range s.pending {
+			if pt.Status != wallet.PendingStatusPending && pt.Height > uint64(cc.InitialHeight()) {
+				pt.Status = wallet.PendingStatusPending
+				pt.Height = 0
+				pt.Reason = ""
+				s.pending[id] = pt
+				s.changes.mark("pending", string(id[:]))
 			}
 		}
 	}
 
-	for _, block := range cc.AppliedBlocks {
+	for _, block := range cc.RevertedBlocks {
+		n := 0
+		for _, mp := range block.MinerPayouts {
+			if owns(mp.UnlockHash) {
+				n++
+			}
+		}
 		for _, txn := range block.Transactions {
-			if transactionIsRelevant(txn, s.addr) {
-				var inflow, outflow types.Currency
-				for _, out := range txn.SiacoinOutputs {
-					if out.UnlockHash == s.addr {
-						inflow = inflow.Add(out.Value)
-					}
-				}
-				for _, in := range txn.SiacoinInputs {
-					if in.UnlockConditions.UnlockHash() == s.addr {
-						inputValue := types.ZeroCurrency // V2: use in.Parent.value
-						outflow = outflow.Add(inputValue)
-					}
+			if transactionIsRelevant(txn, owns) {
+				n++
+			}
+		}
+		for ; n > 0; n-- {
+			// a reverted final revision no longer identifies a renewal
+			last := len(s.txns) - 1
+			for _, rev := range finalRevisions(s.txns[last].Raw) {
+				if j := s.renewalOf(last, rev); j >= 0 {
+					s.txns[j].Type = wallet.TransactionTypeContractFormation
+					s.changes.mark("transactions", txnIndexKey(j))
 				}
+			}
+			s.txns = s.txns[:len(s.txns)-1]
+			s.changes.mark("transactions", txnIndexKey(len(s.txns)))
+		}
+	}
 
+	for j, block := range cc.AppliedBlocks {
+		index := consensus.ChainIndex{
+			Height: uint64(cc.BlockHeight) - uint64(len(cc.AppliedBlocks)-1-j),
+			ID:     consensus.BlockID(block.ID()),
+		}
+		timestamp := time.Unix(int64(block.Timestamp), 0)
+		s.updatePending(block, index.Height)
+		for i, mp := range block.MinerPayouts {
+			if owns(mp.UnlockHash) {
 				s.txns = append(s.txns, wallet.Transaction{
-					Raw:       txn,
-					Index:     s.tip,
-					Inflow:    inflow,
-					Outflow:   outflow,
-					ID:        txn.ID(),
-					Timestamp: time.Unix(int64(block.Timestamp), 0),
+					Index:     index,
+					ID:        types.TransactionID(block.MinerPayoutID(uint64(i))),
+					Inflow:    mp.Value,
+					Type:      wallet.TransactionTypeMinerPayout,
+					Timestamp: timestamp,
 				})
+				s.changes.mark("transactions", txnIndexKey(len(s.txns)-1))
+			}
+		}
+		for _, txn := range block.Transactions {
+			if transactionIsRelevant(txn, owns) {
+				s.txns = append(s.txns, s.walletTransaction(txn, index, timestamp, owns))
+				s.changes.mark("transactions", txnIndexKey(len(s.txns)-1))
+				s.classifyRenewals(len(s.txns) - 1)
 			}
 		}
 	}
 
+	// forget sets that confirmed or failed long ago
+	for id, pt := range s.pending {
+		if pt.Status != wallet.PendingStatusPending && pt.Height+pendingRetention < uint64(cc.BlockHeight) {
+			delete(s.pending, id)
+			s.changes.mark("pending", string(id[:]))
+		}
+	}
+
+	// prune expired reservations
+	for id, exp := range s.reserved {
+		if time.Now().After(exp) {
+			delete(s.reserved, id)
+			s.changes.mark("reservations", string(id[:]))
+		}
+	}
+
 	s.tip.Height = uint64(cc.InitialHeight()) + uint64(len(cc.AppliedBlocks)) - uint64(len(cc.RevertedBlocks))
 	s.tip.ID = consensus.BlockID(cc.AppliedBlocks[len(cc.AppliedBlocks)-1].ID())
 	s.ccid = cc.ID
 }
 
-// NewEphemeralWalletStore returns a new EphemeralWalletStore.
+// pendingRetention is the number of blocks for which a confirmed or failed
+// transaction set continues to be reported.
+const pendingRetention = 144
+
+func txnIndexKey(i int) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(i))
+	return string(b[:])
+}
+
+// NewEphemeralWalletStore returns a new EphemeralWalletStore that watches a
+// single address.
 func NewEphemeralWalletStore(addr types.UnlockHash) *EphemeralWalletStore {
-	return &EphemeralWalletStore{
-		addr: addr,
+	return NewEphemeralSeedStore(func(uint64) types.UnlockHash { return addr }, 0)
+}
+
+// NewEphemeralSeedStore returns a new EphemeralWalletStore that watches the
+// addresses returned by deriveAddr, up to gap addresses beyond the last one
+// used.
+func NewEphemeralSeedStore(deriveAddr func(index uint64) types.UnlockHash, gap uint64) *EphemeralWalletStore {
+	s := &EphemeralWalletStore{
+		deriveAddr: deriveAddr,
+		gap:        gap,
+		addrs:      make(map[types.UnlockHash]uint64),
+		issued:     1,
+
+		outputValues: make(map[types.OutputID]types.Currency),
+		reserved:     make(map[types.OutputID]time.Time),
+		pending:      make(map[types.TransactionID]wallet.PendingTransaction),
 	}
+	s.watch()
+	return s
 }
 
-// JSONWalletStore implements wallet.SingleAddressStore in memory, backed by a JSON file.
+// JSONWalletStore implements wallet.SeedStore in memory, backed by a JSON file.
 type JSONWalletStore struct {
 	*EphemeralWalletStore
 	dir      string
@@ -201,16 +650,31 @@ type jsonWalletPersistData struct {
 	CCID            modules.ConsensusChangeID
 	SiacoinElements []wallet.SiacoinElement
 	Transactions    []wallet.Transaction
+	AddressesIssued uint64
+	AddressesUsed   uint64
+	OutputValues    []jsonOutputValue
+}
+
+type jsonOutputValue struct {
+	ID    types.OutputID
+	Value types.Currency
 }
 
 func (s *JSONWalletStore) save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	values := make([]jsonOutputValue, 0, len(s.outputValues))
+	for id, v := range s.outputValues {
+		values = append(values, jsonOutputValue{id, v})
+	}
 	js, _ := json.MarshalIndent(jsonWalletPersistData{
 		Tip:             s.tip,
 		CCID:            s.ccid,
 		SiacoinElements: s.scElems,
 		Transactions:    s.txns,
+		AddressesIssued: s.issued,
+		AddressesUsed:   s.used,
+		OutputValues:    values,
 	}, "", "  ")
 
 	// atomic save
@@ -247,6 +711,17 @@ func (s *JSONWalletStore) load() (modules.ConsensusChangeID, error) {
 	s.ccid = p.CCID
 	s.scElems = p.SiacoinElements
 	s.txns = p.Transactions
+	if p.AddressesIssued > s.issued {
+		s.issued = p.AddressesIssued
+	}
+	s.used = p.AddressesUsed
+	s.watch()
+	for _, ov := range p.OutputValues {
+		s.outputValues[ov.ID] = ov.Value
+	}
+	for _, sce := range s.scElems {
+		s.outputValues[sce.ID] = sce.Value
+	}
 	return s.ccid, nil
 }
 
@@ -262,9 +737,9 @@ func (s *JSONWalletStore) ProcessConsensusChange(cc modules.ConsensusChange) {
 }
 
 // NewJSONWalletStore returns a new JSONWalletStore.
-func NewJSONWalletStore(dir string, addr types.UnlockHash) (*JSONWalletStore, modules.ConsensusChangeID, error) {
+func NewJSONWalletStore(dir string, deriveAddr func(index uint64) types.UnlockHash, gap uint64) (*JSONWalletStore, modules.ConsensusChangeID, error) {
 	s := &JSONWalletStore{
-		EphemeralWalletStore: NewEphemeralWalletStore(addr),
+		EphemeralWalletStore: NewEphemeralSeedStore(deriveAddr, gap),
 		dir:                  dir,
 		lastSave:             time.Now(),
 	}
@@ -274,3 +749,360 @@ func NewJSONWalletStore(dir string, addr types.UnlockHash) (*JSONWalletStore, mo
 	}
 	return s, ccid, nil
 }
+
+// BoltWalletStore implements wallet.SeedStore in memory, backed by a bolt
+// database.
+type BoltWalletStore struct {
+	*EphemeralWalletStore
+	db       *bolt.DB
+	lastSave time.Time
+}
+
+var boltWalletTables = []string{"elements", "transactions", "outputs", "reservations", "pending"}
+
+// txnsByTimestamp indexes wallet transactions by timestamp.
+var txnsByTimestamp = index{
+	table: "transactions",
+	name:  "timestamp",
+	key: func(js []byte) ([]byte, error) {
+		var txn struct{ Timestamp time.Time }
+		err := json.Unmarshal(js, &txn)
+		return timeIndexKey(txn.Timestamp), err
+	},
+}
+
+var boltWalletIndexes = []index{txnsByTimestamp}
+
+func (s *BoltWalletStore) commit() error {
+	defer observeStoreOp("wallet", "commit", time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elems := make(map[string]wallet.SiacoinElement, len(s.scElems))
+	for _, sce := range s.scElems {
+		elems[string(sce.ID[:])] = sce
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := createTables(tx, boltWalletTables...); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "tip", s.tip); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "ccid", s.ccid); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "issued", s.issued); err != nil {
+			return err
+		} else if err := putJSON(tx, "meta", "used", s.used); err != nil {
+			return err
+		}
+		return s.changes.write(tx, boltWalletIndexes, func(table, key string) (v interface{}, ok bool) {
+			switch table {
+			case "elements":
+				v, ok = elems[key]
+			case "transactions":
+				if i := binary.BigEndian.Uint64([]byte(key)); i < uint64(len(s.txns)) {
+					v, ok = s.txns[i], true
+				}
+			case "outputs":
+				var id types.OutputID
+				copy(id[:], key)
+				v, ok = s.outputValues[id]
+			case "reservations":
+				var id types.OutputID
+				copy(id[:], key)
+				v, ok = s.reserved[id]
+			case "pending":
+				var id types.TransactionID
+				copy(id[:], key)
+				v, ok = s.pending[id]
+			}
+			return
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.changes = make(changeSet)
+	return nil
+}
+
+func (s *BoltWalletStore) load() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if err := getJSON(tx, "meta", "tip", &s.tip); err != nil {
+			return err
+		} else if err := getJSON(tx, "meta", "ccid", &s.ccid); err != nil {
+			return err
+		} else if err := getJSON(tx, "meta", "issued", &s.issued); err != nil {
+			return err
+		} else if err := getJSON(tx, "meta", "used", &s.used); err != nil {
+			return err
+		}
+		s.watch()
+		err := tx.Bucket([]byte("elements")).ForEach(func(_, js []byte) error {
+			var sce wallet.SiacoinElement
+			if err := json.Unmarshal(js, &sce); err != nil {
+				return err
+			}
+			s.scElems = append(s.scElems, sce)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// keys are big-endian, so transactions are visited in order
+		err = tx.Bucket([]byte("transactions")).ForEach(func(_, js []byte) error {
+			var txn wallet.Transaction
+			if err := json.Unmarshal(js, &txn); err != nil {
+				return err
+			}
+			s.txns = append(s.txns, txn)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, sce := range s.scElems {
+			s.outputValues[sce.ID] = sce.Value
+		}
+		// databases created before output values, reservations, and pending
+		// transactions were recorded lack their tables
+		if b := tx.Bucket([]byte("outputs")); b != nil {
+			err := b.ForEach(func(k, js []byte) error {
+				var id types.OutputID
+				copy(id[:], k)
+				var v types.Currency
+				if err := json.Unmarshal(js, &v); err != nil {
+					return err
+				}
+				s.outputValues[id] = v
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if b := tx.Bucket([]byte("reservations")); b != nil {
+			err := b.ForEach(func(k, js []byte) error {
+				var id types.OutputID
+				copy(id[:], k)
+				var exp time.Time
+				if err := json.Unmarshal(js, &exp); err != nil {
+					return err
+				}
+				s.reserved[id] = exp
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if b := tx.Bucket([]byte("pending")); b != nil {
+			return b.ForEach(func(_, js []byte) error {
+				var pt wallet.PendingTransaction
+				if err := json.Unmarshal(js, &pt); err != nil {
+					return err
+				}
+				s.pending[pt.ID] = pt
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// ProcessConsensusChange implements chain.Subscriber.
+func (s *BoltWalletStore) ProcessConsensusChange(cc modules.ConsensusChange) {
+	s.EphemeralWalletStore.ProcessConsensusChange(cc)
+	if time.Since(s.lastSave) > 2*time.Minute {
+		if err := s.commit(); err != nil {
+			log.Fatalln("Couldn't save wallet state:", err)
+		}
+		s.lastSave = time.Now()
+	}
+}
+
+// Transactions implements wallet.SingleAddressStore. Transactions are read
+// from the database's timestamp index, in order of their timestamps, after any
+// outstanding changes to them are committed.
+func (s *BoltWalletStore) Transactions(since time.Time, max int) ([]wallet.Transaction, error) {
+	s.mu.Lock()
+	dirty := len(s.changes["transactions"]) != 0
+	s.mu.Unlock()
+	if dirty {
+		if err := s.commit(); err != nil {
+			return nil, err
+		}
+	}
+	defer observeStoreOp("wallet", "transactions", time.Now())
+	var txns []wallet.Transaction
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return txnsByTimestamp.scan(tx, timeIndexKey(since.Add(time.Nanosecond)), false, func(js []byte) (bool, error) {
+			if len(txns) == max {
+				return false, nil
+			}
+			var txn wallet.Transaction
+			if err := json.Unmarshal(js, &txn); err != nil {
+				return false, err
+			}
+			txns = append(txns, txn)
+			return true, nil
+		})
+	})
+	return txns, err
+}
+
+// update persists the changes made by fn. s.mu must be held.
+func (s *BoltWalletStore) update(fn func(tx *bolt.Tx) error) error {
+	return update(s.db, "wallet", boltWalletTables, fn)
+}
+
+// IssueAddress implements wallet.SeedStore. Issued addresses are persisted
+// before they are returned, so that they are never issued twice.
+func (s *BoltWalletStore) IssueAddress() (wallet.AddressInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := s.issued
+	err := s.update(func(tx *bolt.Tx) error {
+		return putJSON(tx, "meta", "issued", index+1)
+	})
+	if err != nil {
+		return wallet.AddressInfo{}, err
+	}
+	s.issued++
+	s.watch()
+	return wallet.AddressInfo{Address: s.deriveAddr(index), Index: index}, nil
+}
+
+// ReserveOutputs implements wallet.SingleAddressStore. Reservations are
+// persisted before they take effect, so that they survive a restart.
+func (s *BoltWalletStore) ReserveOutputs(ids []types.OutputID, expiration time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			if err := putJSON(tx, "reservations", string(id[:]), expiration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.reserved[id] = expiration
+	}
+	return nil
+}
+
+// ReleaseOutputs implements wallet.SingleAddressStore.
+func (s *BoltWalletStore) ReleaseOutputs(ids []types.OutputID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("reservations"))
+		for _, id := range ids {
+			if err := b.Delete(id[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(s.reserved, id)
+	}
+	return nil
+}
+
+// TrackTransactionSet implements wallet.SeedStore. Tracked sets are persisted
+// before they are tracked, so that they are rebroadcast after a restart.
+func (s *BoltWalletStore) TrackTransactionSet(txns []types.Transaction) error {
+	if len(txns) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pt := newPendingTransaction(txns)
+	err := s.update(func(tx *bolt.Tx) error {
+		return putJSON(tx, "pending", string(pt.ID[:]), pt)
+	})
+	if err != nil {
+		return err
+	}
+	s.pending[pt.ID] = pt
+	return nil
+}
+
+// MarkPendingFailed implements wallet.SeedStore.
+func (s *BoltWalletStore) MarkPendingFailed(id types.TransactionID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pt, err := s.failedPending(id, reason)
+	if err != nil {
+		return err
+	}
+	err = s.update(func(tx *bolt.Tx) error {
+		return putJSON(tx, "pending", string(id[:]), pt)
+	})
+	if err != nil {
+		return err
+	}
+	s.pending[id] = pt
+	return nil
+}
+
+// Close persists any outstanding changes and closes the underlying database.
+func (s *BoltWalletStore) Close() error {
+	if err := s.commit(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// NewBoltWalletStore returns a new BoltWalletStore. If the database does not
+// exist yet, the state of the JSONWalletStore in dir, if any, is imported.
+func NewBoltWalletStore(dir string, deriveAddr func(index uint64) types.UnlockHash, gap uint64) (*BoltWalletStore, modules.ConsensusChangeID, error) {
+	db, fresh, err := openBoltDB(dir, "wallet")
+	if err != nil {
+		return nil, modules.ConsensusChangeID{}, err
+	}
+	s := &BoltWalletStore{
+		EphemeralWalletStore: NewEphemeralSeedStore(deriveAddr, gap),
+		db:                   db,
+		lastSave:             time.Now(),
+	}
+	s.changes = make(changeSet)
+	if err := createIndexes(db, boltWalletIndexes...); err != nil {
+		db.Close()
+		return nil, modules.ConsensusChangeID{}, err
+	}
+	if fresh {
+		js := &JSONWalletStore{EphemeralWalletStore: s.EphemeralWalletStore, dir: dir}
+		if _, err := js.load(); err != nil {
+			db.Close()
+			return nil, modules.ConsensusChangeID{}, err
+		}
+		for _, sce := range s.scElems {
+			s.changes.mark("elements", string(sce.ID[:]))
+		}
+		for i := range s.txns {
+			s.changes.mark("transactions", txnIndexKey(i))
+		}
+		for id := range s.outputValues {
+			s.changes.mark("outputs", string(id[:]))
+		}
+		err := s.commit()
+		if err == nil {
+			err = retireJSONFile(dir, "wallet")
+		}
+		if err != nil {
+			db.Close()
+			return nil, modules.ConsensusChangeID{}, err
+		}
+	} else if err := s.load(); err != nil {
+		db.Close()
+		return nil, modules.ConsensusChangeID{}, err
+	}
+	return s, s.ccid, nil
+}
@@ -0,0 +1,294 @@
+package stores
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/types"
+	"lukechampine.com/frand"
+)
+
+func TestWalletHistory(t *testing.T) {
+	seed := wallet.Seed(frand.Entropy256())
+	s := NewEphemeralSeedStore(seed.Address, wallet.DefaultGapLimit)
+	sc := func(n uint64) types.Currency { return types.SiacoinPrecision.Mul64(n) }
+	other := types.UnlockHash(frand.Entropy256())
+
+	// applyBlock applies a block, along with the output diffs of its
+	// transactions
+	var height types.BlockHeight
+	applyBlock := func(b types.Block, spent []types.SiacoinOutputID, spentOutputs []types.SiacoinOutput) {
+		var cc modules.ConsensusChange
+		cc.AppliedBlocks = []types.Block{b}
+		for i, id := range spent {
+			cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+				Direction:     modules.DiffRevert,
+				ID:            id,
+				SiacoinOutput: spentOutputs[i],
+			})
+		}
+		for _, txn := range b.Transactions {
+			for i, sco := range txn.SiacoinOutputs {
+				cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+					Direction:     modules.DiffApply,
+					ID:            txn.SiacoinOutputID(uint64(i)),
+					SiacoinOutput: sco,
+				})
+			}
+		}
+		height++
+		cc.BlockHeight = height
+		s.ProcessConsensusChange(cc)
+	}
+
+	// receive a miner payout and a payment
+	recv := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: sc(10), UnlockHash: seed.Address(0)}},
+	}
+	applyBlock(types.Block{
+		MinerPayouts: []types.SiacoinOutput{{Value: sc(300), UnlockHash: seed.Address(0)}},
+		Transactions: []types.Transaction{recv},
+	}, nil, nil)
+
+	// spend the payment
+	send := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         recv.SiacoinOutputID(0),
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(0)),
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: sc(3), UnlockHash: other},
+			{Value: sc(6), UnlockHash: seed.Address(1)},
+		},
+		MinerFees: []types.Currency{sc(1)},
+	}
+	applyBlock(types.Block{Transactions: []types.Transaction{send}}, []types.SiacoinOutputID{recv.SiacoinOutputID(0)}, recv.SiacoinOutputs)
+
+	// form and renew contracts with the change; the renewal is identified by
+	// the final revision of the contract it renews, which confirms later
+	uh := types.UnlockHash(frand.Entropy256())
+	form := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         send.SiacoinOutputID(1),
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(1)),
+		}},
+		SiacoinOutputs: []types.SiacoinOutput{{Value: sc(4), UnlockHash: seed.Address(2)}},
+		FileContracts:  []types.FileContract{{Payout: sc(2), UnlockHash: uh}},
+	}
+	renew := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			ParentID:         form.SiacoinOutputID(0),
+			UnlockConditions: wallet.StandardUnlockConditions(seed.PublicKey(2)),
+		}},
+		FileContracts: []types.FileContract{{Payout: sc(2), UnlockHash: uh}},
+	}
+	contracts := types.Block{Transactions: []types.Transaction{form, renew}}
+	applyBlock(contracts, []types.SiacoinOutputID{send.SiacoinOutputID(1), form.SiacoinOutputID(0)}, []types.SiacoinOutput{send.SiacoinOutputs[1], form.SiacoinOutputs[0]})
+	if txns, _ := s.Transactions(time.Time{}, -1); txns[len(txns)-1].Type != wallet.TransactionTypeContractFormation {
+		t.Fatal("contract with unfinalized parent classified as", txns[len(txns)-1].Type)
+	}
+	finalize := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{{
+			ParentID:             form.FileContractID(0),
+			NewRevisionNumber:    math.MaxUint64,
+			NewValidProofOutputs: []types.SiacoinOutput{{Value: sc(1), UnlockHash: seed.Address(2)}},
+			NewUnlockHash:        uh,
+		}},
+	}
+	final := types.Block{Transactions: []types.Transaction{finalize}}
+	applyBlock(final, nil, nil)
+
+	txns, _ := s.Transactions(time.Time{}, -1)
+	exp := []struct {
+		typ                  string
+		inflow, outflow, fee types.Currency
+		height               uint64
+	}{
+		{wallet.TransactionTypeMinerPayout, sc(300), sc(0), sc(0), 1},
+		{wallet.TransactionTypeReceive, sc(10), sc(0), sc(0), 1},
+		{wallet.TransactionTypeSend, sc(6), sc(10), sc(1), 2},
+		{wallet.TransactionTypeContractFormation, sc(4), sc(6), sc(0), 3},
+		{wallet.TransactionTypeContractRenewal, sc(0), sc(4), sc(0), 3},
+		{wallet.TransactionTypeContractRevision, sc(0), sc(0), sc(0), 4},
+	}
+	if len(txns) != len(exp) {
+		t.Fatalf("expected %v transactions, got %v", len(exp), len(txns))
+	}
+	for i, e := range exp {
+		txn := txns[i]
+		if txn.Type != e.typ || !txn.Inflow.Equals(e.inflow) || !txn.Outflow.Equals(e.outflow) || !txn.Fee.Equals(e.fee) {
+			t.Errorf("transaction %v: expected %v (in %v, out %v, fee %v), got %v (in %v, out %v, fee %v)",
+				i, e.typ, e.inflow, e.outflow, e.fee, txn.Type, txn.Inflow, txn.Outflow, txn.Fee)
+		}
+		if txn.Index.Height != e.height {
+			t.Errorf("transaction %v has wrong height %v", i, txn.Index.Height)
+		}
+	}
+
+	// reverting the final revision should undo the renewal
+	var cc modules.ConsensusChange
+	cc.RevertedBlocks = []types.Block{final}
+	cc.AppliedBlocks = []types.Block{{}}
+	cc.BlockHeight = height
+	s.ProcessConsensusChange(cc)
+	if txns, _ := s.Transactions(time.Time{}, -1); len(txns) != 5 || txns[4].Type != wallet.TransactionTypeContractFormation {
+		t.Fatal("renewal not undone after revert")
+	}
+
+	// reverting the contracts should remove both of their entries
+	cc.RevertedBlocks = []types.Block{contracts}
+	s.ProcessConsensusChange(cc)
+	if txns, _ := s.Transactions(time.Time{}, -1); len(txns) != 3 {
+		t.Fatalf("expected 3 transactions after revert, got %v", len(txns))
+	}
+}
+
+func TestWalletReservations(t *testing.T) {
+	dir := t.TempDir()
+	seed := wallet.Seed(frand.Entropy256())
+	s, _, err := NewBoltWalletStore(dir, seed.Address, wallet.DefaultGapLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := wallet.NewSeedWallet(seed, s)
+
+	// receive two outputs
+	var cc modules.ConsensusChange
+	cc.AppliedBlocks = []types.Block{{}}
+	for i := 0; i < 2; i++ {
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+			Direction:     modules.DiffApply,
+			ID:            frand.Entropy256(),
+			SiacoinOutput: types.SiacoinOutput{Value: types.SiacoinPrecision, UnlockHash: seed.Address(0)},
+		})
+	}
+	cc.BlockHeight = 1
+	s.ProcessConsensusChange(cc)
+
+	// fund a transaction, then reopen the store; the reservation should
+	// survive
+	var txn types.Transaction
+	if _, err := w.FundTransaction(consensus.State{}, &txn, types.SiacoinPrecision, nil); err != nil {
+		t.Fatal(err)
+	} else if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, _, err = NewBoltWalletStore(dir, seed.Address, wallet.DefaultGapLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	w = wallet.NewSeedWallet(seed, s)
+	if rs, err := w.Reservations(); err != nil {
+		t.Fatal(err)
+	} else if len(rs) != 1 || rs[0].ID != types.OutputID(txn.SiacoinInputs[0].ParentID) {
+		t.Fatal("reservation was not persisted:", rs)
+	}
+
+	// an expired reservation should not prevent the output from being used
+	var other types.OutputID
+	for _, diff := range cc.SiacoinOutputDiffs {
+		if types.OutputID(diff.ID) != types.OutputID(txn.SiacoinInputs[0].ParentID) {
+			other = types.OutputID(diff.ID)
+		}
+	}
+	if err := s.ReserveOutputs([]types.OutputID{other}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	} else if _, err := w.FundTransaction(consensus.State{}, &types.Transaction{}, types.SiacoinPrecision, nil); err != nil {
+		t.Fatal("expired reservation should be ignored:", err)
+	}
+
+	// confirming the first transaction should release its reservation
+	cc = modules.ConsensusChange{AppliedBlocks: []types.Block{{Transactions: []types.Transaction{txn}}}}
+	cc.SiacoinOutputDiffs = []modules.SiacoinOutputDiff{{
+		Direction:     modules.DiffRevert,
+		ID:            txn.SiacoinInputs[0].ParentID,
+		SiacoinOutput: types.SiacoinOutput{Value: types.SiacoinPrecision, UnlockHash: seed.Address(0)},
+	}}
+	cc.BlockHeight = 2
+	s.ProcessConsensusChange(cc)
+	if rs, err := s.Reservations(); err != nil {
+		t.Fatal(err)
+	} else if len(rs) != 1 || rs[0].ID != other {
+		t.Fatal("spent output should no longer be reserved:", rs)
+	}
+}
+
+func TestWalletPending(t *testing.T) {
+	seed := wallet.Seed(frand.Entropy256())
+	s := NewEphemeralSeedStore(seed.Address, wallet.DefaultGapLimit)
+	var height types.BlockHeight
+	applyBlock := func(txns ...types.Transaction) types.Block {
+		b := types.Block{Timestamp: types.Timestamp(height), Transactions: txns}
+		height++
+		cc := modules.ConsensusChange{AppliedBlocks: []types.Block{b}, BlockHeight: height}
+		s.ProcessConsensusChange(cc)
+		return b
+	}
+	spend := func(id types.SiacoinOutputID) types.Transaction {
+		return types.Transaction{
+			SiacoinInputs:  []types.SiacoinInput{{ParentID: id}},
+			SiacoinOutputs: []types.SiacoinOutput{{Value: types.SiacoinPrecision, UnlockHash: seed.Address(0)}},
+			ArbitraryData:  [][]byte{frand.Bytes(8)},
+		}
+	}
+	status := func(id types.TransactionID) wallet.PendingTransaction {
+		t.Helper()
+		pts, err := s.PendingTransactions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pt := range pts {
+			if pt.ID == id {
+				return pt
+			}
+		}
+		t.Fatal("transaction set is not tracked")
+		return wallet.PendingTransaction{}
+	}
+
+	// track a parent and child, and a set that will be double-spent
+	parent := spend(frand.Entropy256())
+	child := spend(parent.SiacoinOutputID(0))
+	conflicted := spend(frand.Entropy256())
+	if err := s.TrackTransactionSet([]types.Transaction{parent, child}); err != nil {
+		t.Fatal(err)
+	} else if err := s.TrackTransactionSet([]types.Transaction{conflicted}); err != nil {
+		t.Fatal(err)
+	}
+
+	// confirming the parent should leave only the child pending; spending the
+	// input of the other set should fail it
+	applyBlock(parent, spend(conflicted.SiacoinInputs[0].ParentID))
+	if pt := status(child.ID()); pt.Status != wallet.PendingStatusPending || len(pt.TransactionSet) != 1 || pt.TransactionSet[0].ID() != child.ID() {
+		t.Fatal("only the child should remain pending:", pt)
+	} else if pt := status(conflicted.ID()); pt.Status != wallet.PendingStatusFailed || pt.Height != 1 || pt.Reason == "" {
+		t.Fatal("double-spent set should have failed:", pt)
+	}
+
+	// confirm the child
+	b := applyBlock(child)
+	if pt := status(child.ID()); pt.Status != wallet.PendingStatusConfirmed || pt.Height != 2 {
+		t.Fatal("set should be confirmed at height 2:", pt)
+	}
+
+	// reverting the block should make the set pending again
+	cc := modules.ConsensusChange{RevertedBlocks: []types.Block{b}, AppliedBlocks: []types.Block{{}}, BlockHeight: height}
+	s.ProcessConsensusChange(cc)
+	if pt := status(child.ID()); pt.Status != wallet.PendingStatusPending || pt.Height != 0 {
+		t.Fatal("set should be pending after revert:", pt)
+	}
+
+	// finished sets should eventually be forgotten
+	applyBlock(child)
+	for i := 0; i <= pendingRetention; i++ {
+		applyBlock()
+	}
+	if pts, _ := s.PendingTransactions(); len(pts) != 0 {
+		t.Fatal("finished sets should be pruned:", pts)
+	}
+}
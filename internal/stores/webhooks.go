@@ -0,0 +1,266 @@
+package stores
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"gitlab.com/NebulousLabs/bolt"
+	"go.sia.tech/renterd/webhooks"
+)
+
+// maxDeadLetters is the number of dead letters retained by a webhook store;
+// beyond it, the oldest are discarded.
+const maxDeadLetters = 1000
+
+// EphemeralWebhookStore implements webhooks.Store in memory.
+type EphemeralWebhookStore struct {
+	mu          sync.Mutex
+	webhooks    map[string]webhooks.Webhook
+	deadLetters map[string]webhooks.DeadLetter
+}
+
+// Webhooks implements webhooks.Store.
+func (s *EphemeralWebhookStore) Webhooks() ([]webhooks.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	whs := make([]webhooks.Webhook, 0, len(s.webhooks))
+	for _, wh := range s.webhooks {
+		whs = append(whs, wh)
+	}
+	sort.Slice(whs, func(i, j int) bool {
+		return whs[i].Created.Before(whs[j].Created)
+	})
+	return whs, nil
+}
+
+// AddWebhook implements webhooks.Store.
+func (s *EphemeralWebhookStore) AddWebhook(wh webhooks.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[wh.ID] = wh
+	return nil
+}
+
+// RemoveWebhook implements webhooks.Store.
+func (s *EphemeralWebhookStore) RemoveWebhook(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[id]; !ok {
+		return errors.New("no webhook with that ID")
+	}
+	delete(s.webhooks, id)
+	return nil
+}
+
+func (s *EphemeralWebhookStore) sortedDeadLetters() []webhooks.DeadLetter {
+	dls := make([]webhooks.DeadLetter, 0, len(s.deadLetters))
+	for _, dl := range s.deadLetters {
+		dls = append(dls, dl)
+	}
+	sort.Slice(dls, func(i, j int) bool {
+		return dls[i].Failed.Before(dls[j].Failed)
+	})
+	return dls
+}
+
+// DeadLetters implements webhooks.Store.
+func (s *EphemeralWebhookStore) DeadLetters() ([]webhooks.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedDeadLetters(), nil
+}
+
+// AddDeadLetter implements webhooks.Store.
+func (s *EphemeralWebhookStore) AddDeadLetter(dl webhooks.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	evicted := s.evictions(dl)
+	s.deadLetters[dl.ID] = dl
+	for _, id := range evicted {
+		delete(s.deadLetters, id)
+	}
+	return nil
+}
+
+// evictions returns the IDs of the dead letters that are discarded when dl is
+// added. s.mu must be held.
+func (s *EphemeralWebhookStore) evictions(dl webhooks.DeadLetter) []string {
+	dls := []webhooks.DeadLetter{dl}
+	for _, d := range s.deadLetters {
+		if d.ID != dl.ID {
+			dls = append(dls, d)
+		}
+	}
+	if len(dls) <= maxDeadLetters {
+		return nil
+	}
+	sort.Slice(dls, func(i, j int) bool {
+		return dls[i].Failed.Before(dls[j].Failed)
+	})
+	ids := make([]string, 0, len(dls)-maxDeadLetters)
+	for _, d := range dls[:len(dls)-maxDeadLetters] {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+// RemoveDeadLetter implements webhooks.Store.
+func (s *EphemeralWebhookStore) RemoveDeadLetter(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deadLetters[id]; !ok {
+		return errors.New("no dead letter with that ID")
+	}
+	delete(s.deadLetters, id)
+	return nil
+}
+
+// NewEphemeralWebhookStore returns a new EphemeralWebhookStore.
+func NewEphemeralWebhookStore() *EphemeralWebhookStore {
+	return &EphemeralWebhookStore{
+		webhooks:    make(map[string]webhooks.Webhook),
+		deadLetters: make(map[string]webhooks.DeadLetter),
+	}
+}
+
+// BoltWebhookStore implements webhooks.Store in memory, backed by a bolt
+// database. Every change is persisted before it is applied in memory.
+type BoltWebhookStore struct {
+	*EphemeralWebhookStore
+	db *bolt.DB
+}
+
+var boltWebhookTables = []string{"webhooks", "deadletters"}
+
+// update persists the changes made by fn. s.mu must be held.
+func (s *BoltWebhookStore) update(fn func(tx *bolt.Tx) error) error {
+	return update(s.db, "webhooks", boltWebhookTables, fn)
+}
+
+func (s *BoltWebhookStore) load() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte("webhooks")).ForEach(func(_, js []byte) error {
+			var wh webhooks.Webhook
+			if err := json.Unmarshal(js, &wh); err != nil {
+				return err
+			}
+			s.webhooks[wh.ID] = wh
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("deadletters")).ForEach(func(_, js []byte) error {
+			var dl webhooks.DeadLetter
+			if err := json.Unmarshal(js, &dl); err != nil {
+				return err
+			}
+			s.deadLetters[dl.ID] = dl
+			return nil
+		})
+	})
+}
+
+// AddWebhook implements webhooks.Store.
+func (s *BoltWebhookStore) AddWebhook(wh webhooks.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.update(func(tx *bolt.Tx) error {
+		return putJSON(tx, "webhooks", wh.ID, wh)
+	})
+	if err != nil {
+		return err
+	}
+	s.webhooks[wh.ID] = wh
+	return nil
+}
+
+// RemoveWebhook implements webhooks.Store.
+func (s *BoltWebhookStore) RemoveWebhook(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[id]; !ok {
+		return errors.New("no webhook with that ID")
+	}
+	err := s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("webhooks")).Delete([]byte(id))
+	})
+	if err != nil {
+		return err
+	}
+	delete(s.webhooks, id)
+	return nil
+}
+
+// AddDeadLetter implements webhooks.Store.
+func (s *BoltWebhookStore) AddDeadLetter(dl webhooks.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	evicted := s.evictions(dl)
+	err := s.update(func(tx *bolt.Tx) error {
+		if err := putJSON(tx, "deadletters", dl.ID, dl); err != nil {
+			return err
+		}
+		b := tx.Bucket([]byte("deadletters"))
+		for _, id := range evicted {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.deadLetters[dl.ID] = dl
+	for _, id := range evicted {
+		delete(s.deadLetters, id)
+	}
+	return nil
+}
+
+// RemoveDeadLetter implements webhooks.Store.
+func (s *BoltWebhookStore) RemoveDeadLetter(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.deadLetters[id]; !ok {
+		return errors.New("no dead letter with that ID")
+	}
+	err := s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("deadletters")).Delete([]byte(id))
+	})
+	if err != nil {
+		return err
+	}
+	delete(s.deadLetters, id)
+	return nil
+}
+
+// Close closes the underlying database.
+func (s *BoltWebhookStore) Close() error {
+	return s.db.Close()
+}
+
+// NewBoltWebhookStore returns a new BoltWebhookStore.
+func NewBoltWebhookStore(dir string) (*BoltWebhookStore, error) {
+	db, fresh, err := openBoltDB(dir, "webhooks")
+	if err != nil {
+		return nil, err
+	}
+	s := &BoltWebhookStore{
+		EphemeralWebhookStore: NewEphemeralWebhookStore(),
+		db:                    db,
+	}
+	if fresh {
+		err = s.update(func(*bolt.Tx) error { return nil })
+	} else {
+		err = s.load()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
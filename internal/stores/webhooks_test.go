@@ -0,0 +1,53 @@
+package stores
+
+import (
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/webhooks"
+)
+
+func TestBoltWebhookStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewBoltWebhookStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh := webhooks.Webhook{ID: "foo", URL: "http://example.com", Secret: "bar", Created: time.Now()}
+	if err := s.AddWebhook(wh); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddWebhook(webhooks.Webhook{ID: "baz"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.RemoveWebhook("baz"); err != nil {
+		t.Fatal(err)
+	} else if err := s.RemoveWebhook("baz"); err == nil {
+		t.Fatal("expected removal of unknown webhook to fail")
+	}
+	for i := 0; i < maxDeadLetters+1; i++ {
+		dl := webhooks.DeadLetter{ID: string(rune('a' + i)), WebhookID: wh.ID, Failed: time.Unix(int64(i), 0)}
+		if err := s.AddDeadLetter(dl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// webhooks and dead letters should survive a restart, with the oldest
+	// dead letter discarded
+	s, err = NewBoltWebhookStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if whs, err := s.Webhooks(); err != nil {
+		t.Fatal(err)
+	} else if len(whs) != 1 || whs[0].ID != wh.ID || whs[0].Secret != wh.Secret {
+		t.Fatal("webhook was not persisted:", whs)
+	}
+	if dls, err := s.DeadLetters(); err != nil {
+		t.Fatal(err)
+	} else if len(dls) != maxDeadLetters || dls[0].ID != "b" {
+		t.Fatalf("expected %v dead letters, oldest first, got %v", maxDeadLetters, len(dls))
+	}
+}
@@ -0,0 +1,28 @@
+package object
+
+import "time"
+
+// DefaultBucket is the name of the bucket that always exists, and which holds
+// any objects stored before buckets were introduced.
+const DefaultBucket = "default"
+
+// BucketSettings control how the objects in a bucket are stored. The
+// redundancy and host set are defaults for clients uploading to the bucket;
+// versioning and the quota are enforced by the object store.
+type BucketSettings struct {
+	MinShards   uint8
+	TotalShards uint8
+	HostSet     string
+	Versioning  VersioningPolicy
+	// Quota is the maximum total size of all versions of all objects in the
+	// bucket. Zero means no limit.
+	Quota int64
+}
+
+// A Bucket is a named collection of objects.
+type Bucket struct {
+	Name     string
+	Created  time.Time
+	Size     int64
+	Settings BucketSettings
+}
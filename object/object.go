@@ -3,11 +3,17 @@ package object
 import (
 	"bytes"
 	"crypto/cipher"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.sia.tech/renterd/slab"
+	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/chacha20"
 	"lukechampine.com/frand"
 )
@@ -33,8 +39,26 @@ func (k *EncryptionKey) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// NoOpKey is an EncryptionKey that does not encrypt. It is used for objects
+// whose data is only encrypted at the slab level, such as those imported from
+// siad.
+var NoOpKey = EncryptionKey{entropy: new([32]byte)}
+
+// IsNoOp reports whether k is the NoOpKey.
+func (k EncryptionKey) IsNoOp() bool {
+	return *k.entropy == [32]byte{}
+}
+
+// noOpStream is a cipher.Stream that leaves its input unchanged.
+type noOpStream struct{}
+
+func (noOpStream) XORKeyStream(dst, src []byte) { copy(dst, src) }
+
 // Encrypt returns a cipher.StreamReader that encrypts r with k.
 func (k EncryptionKey) Encrypt(r io.Reader) cipher.StreamReader {
+	if k.IsNoOp() {
+		return cipher.StreamReader{S: noOpStream{}, R: r}
+	}
 	c, _ := chacha20.NewUnauthenticatedCipher(k.entropy[:], make([]byte, 24))
 	return cipher.StreamReader{S: c, R: r}
 }
@@ -42,6 +66,9 @@ func (k EncryptionKey) Encrypt(r io.Reader) cipher.StreamReader {
 // Decrypt returns a cipher.StreamWriter that decrypts w with k, starting at the
 // specified offset.
 func (k EncryptionKey) Decrypt(w io.Writer, offset int64) cipher.StreamWriter {
+	if k.IsNoOp() {
+		return cipher.StreamWriter{S: noOpStream{}, W: w}
+	}
 	c, _ := chacha20.NewUnauthenticatedCipher(k.entropy[:], make([]byte, 24))
 	c.SetCounter(uint32(offset / 64))
 	var buf [64]byte
@@ -56,10 +83,143 @@ func GenerateEncryptionKey() EncryptionKey {
 	return key
 }
 
+// Metadata contains information about an object other than its data. The
+// ContentType and User fields are supplied by the client; the remaining fields
+// are maintained by the object store.
+type Metadata struct {
+	ContentType string
+	Created     time.Time
+	Modified    time.Time
+	ETag        string
+	VersionID   string
+	User        map[string]string
+}
+
 // An Object is a unit of data that has been stored on a host.
 type Object struct {
-	Key   EncryptionKey
-	Slabs []slab.Slice
+	Key      EncryptionKey
+	Slabs    []slab.Slice
+	Metadata Metadata
+}
+
+// NullVersionID is the version ID of objects stored while versioning was not
+// enabled for their key.
+const NullVersionID = "null"
+
+// A Version describes a single version of an object. Delete markers are
+// versions that record the deletion of an object; they have no data.
+type Version struct {
+	ID           string
+	Size         int64
+	Modified     time.Time
+	DeleteMarker bool
+	Latest       bool
+}
+
+// A VersioningPolicy determines whether prior versions of objects are retained
+// when they are overwritten or deleted, and for how long.
+type VersioningPolicy struct {
+	// Enabled is whether prior versions are retained. If it is false, any
+	// prior versions are removed.
+	Enabled bool
+	// KeepVersions is the maximum number of noncurrent versions retained for
+	// each object. Zero means no limit.
+	KeepVersions int
+	// KeepDays is the number of days that a version is retained after becoming
+	// noncurrent. Zero means no limit.
+	KeepDays int
+}
+
+// An Entry is an element of a directory listing: either an object, or a
+// directory containing other objects. Directory names end in /; for
+// directories, Size and Objects are the total size and number of all objects
+// beneath the directory, and Metadata is always empty.
+type Entry struct {
+	Name     string
+	Size     int64
+	Objects  uint64
+	Metadata Metadata
+}
+
+// Fields that directory listings can be sorted by.
+const (
+	SortByName     = "name"
+	SortBySize     = "size"
+	SortByModified = "modified"
+)
+
+// ListOptions control which entries of a directory listing are returned, and in
+// what order.
+type ListOptions struct {
+	// Marker identifies the last entry of the previous page, as returned by
+	// NextMarker; only entries that sort after it are returned. The entry
+	// need not exist anymore.
+	Marker string
+	// Limit is the maximum number of entries returned. If Limit is zero or
+	// negative, every entry is returned.
+	Limit int
+	// SortBy is the field that entries are sorted by. Ties are broken by name.
+	SortBy string
+	// Descending reverses the sort order.
+	Descending bool
+}
+
+// Less reports whether entry a sorts before entry b under the options.
+func (opts ListOptions) Less(a, b Entry) bool {
+	less := func(a, b Entry) bool {
+		switch opts.SortBy {
+		case SortBySize:
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case SortByModified:
+			if !a.Metadata.Modified.Equal(b.Metadata.Modified) {
+				return a.Metadata.Modified.Before(b.Metadata.Modified)
+			}
+		}
+		return a.Name < b.Name
+	}
+	if opts.Descending {
+		return less(b, a)
+	}
+	return less(a, b)
+}
+
+// NextMarker returns the marker of the page following entry e. When sorting by
+// size or modification time, the marker includes e's sort key, so that the
+// listing resumes in the right place even if e has since changed or been
+// deleted.
+func (opts ListOptions) NextMarker(e Entry) string {
+	switch opts.SortBy {
+	case SortBySize:
+		return strconv.FormatInt(e.Size, 10) + "," + e.Name
+	case SortByModified:
+		return e.Metadata.Modified.UTC().Format(time.RFC3339Nano) + "," + e.Name
+	}
+	return e.Name
+}
+
+// MarkerEntry returns an entry that sorts in the same place as the entry that
+// opts.Marker was created from.
+func (opts ListOptions) MarkerEntry() (Entry, error) {
+	if opts.Marker == "" || (opts.SortBy != SortBySize && opts.SortBy != SortByModified) {
+		return Entry{Name: opts.Marker}, nil
+	}
+	i := strings.IndexByte(opts.Marker, ',')
+	if i < 0 {
+		return Entry{}, errors.New("invalid marker")
+	}
+	key, e := opts.Marker[:i], Entry{Name: opts.Marker[i+1:]}
+	var err error
+	if opts.SortBy == SortBySize {
+		e.Size, err = strconv.ParseInt(key, 10, 64)
+	} else {
+		e.Metadata.Modified, err = time.Parse(time.RFC3339Nano, key)
+	}
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid marker: %w", err)
+	}
+	return e, nil
 }
 
 // Size returns the total size of the object.
@@ -71,6 +231,26 @@ func (o Object) Size() int64 {
 	return n
 }
 
+// ComputeETag returns a hash of the object's key and the layout of its data:
+// the key, offset, and length of each slab slice. Since slabs are encrypted, two
+// objects with identical plaintext will generally have different ETags;
+// however, an object's ETag only changes when its contents do, and not when its
+// sectors are migrated to other hosts.
+func (o Object) ComputeETag() string {
+	h, _ := blake2b.New256(nil)
+	if o.Key.entropy != nil {
+		h.Write(o.Key.entropy[:])
+	}
+	var buf [8]byte
+	for _, ss := range o.Slabs {
+		h.Write([]byte(ss.Key.String()))
+		binary.LittleEndian.PutUint32(buf[:4], ss.Offset)
+		binary.LittleEndian.PutUint32(buf[4:], ss.Length)
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // SplitSlabs splits a set of slabs into slices comprising objects with the
 // specified lengths.
 func SplitSlabs(slabs []slab.Slab, lengths []int) [][]slab.Slice {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"testing"
+	"time"
 
 	"go.sia.tech/renterd/internal/slabutil"
 	"go.sia.tech/renterd/object"
@@ -92,3 +93,44 @@ func TestMultipleObjects(t *testing.T) {
 		}
 	}
 }
+
+func TestListMarker(t *testing.T) {
+	e := object.Entry{Name: "/a,b", Size: 7}
+	e.Metadata.Modified = time.Unix(1234, 5678)
+	for _, sortBy := range []string{"", object.SortByName, object.SortBySize, object.SortByModified} {
+		opts := object.ListOptions{SortBy: sortBy}
+		opts.Marker = opts.NextMarker(e)
+		m, err := opts.MarkerEntry()
+		if err != nil {
+			t.Fatal(err)
+		} else if opts.Less(m, e) || opts.Less(e, m) {
+			t.Errorf("%q: marker %q does not sort with its entry", sortBy, opts.Marker)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	o := object.Object{
+		Key: object.GenerateEncryptionKey(),
+		Slabs: []slab.Slice{{
+			Slab: slab.Slab{
+				Key:       slab.GenerateEncryptionKey(),
+				MinShards: 1,
+				Shards:    []slab.Sector{{Root: frand.Entropy256()}},
+			},
+			Length: 100,
+		}},
+	}
+	etag := o.ComputeETag()
+
+	// migrating a sector should not change the ETag
+	o.Slabs[0].Shards = []slab.Sector{{Host: frand.Entropy256(), Root: frand.Entropy256()}}
+	if o.ComputeETag() != etag {
+		t.Fatal("ETag changed when sector was migrated")
+	}
+	// changing the layout should
+	o.Slabs[0].Length = 50
+	if o.ComputeETag() == etag {
+		t.Fatal("ETag did not change with object layout")
+	}
+}
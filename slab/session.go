@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/internal/metrics"
 	rhpv2 "go.sia.tech/renterd/rhp/v2"
 	"go.sia.tech/siad/types"
 )
@@ -44,6 +45,25 @@ func (hes HostErrorSet) Error() string {
 	return "\n" + strings.Join(strs, "\n")
 }
 
+// rpcBuckets are the buckets of the RPC duration histogram. Transferring a
+// sector can take far longer than a typical request.
+var rpcBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var (
+	rpcResults   = metrics.Default.NewCounterVec("renterd_host_rpc_total", "RPCs made to hosts through session pools.", "host", "rpc", "result")
+	rpcDurations = metrics.Default.NewHistogramVec("renterd_host_rpc_duration_seconds", "Duration of RPCs made to hosts through session pools, including acquiring the session.", rpcBuckets, "host", "rpc")
+)
+
+// recordRPC records the outcome and duration of an RPC.
+func recordRPC(hostKey consensus.PublicKey, rpc string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	rpcResults.With(hostKey.String(), rpc, result).Inc()
+	rpcDurations.With(hostKey.String(), rpc).ObserveSince(start)
+}
+
 // A sharedSession wraps a RHPv2 session with useful metadata and methods.
 type sharedSession struct {
 	sess     *rhpv2.Session
@@ -128,11 +148,12 @@ func (s *Session) PublicKey() consensus.PublicKey {
 }
 
 // UploadSector implements Host.
-func (s *Session) UploadSector(sector *[rhpv2.SectorSize]byte) (consensus.Hash256, error) {
+func (s *Session) UploadSector(sector *[rhpv2.SectorSize]byte) (_ consensus.Hash256, err error) {
 	currentHeight := s.pool.currentHeight()
 	if currentHeight == 0 {
 		panic("cannot upload without knowing current height") // developer error
 	}
+	defer func(start time.Time) { recordRPC(s.hostKey, "append", start, err) }(time.Now())
 	ss, err := s.pool.acquire(s)
 	if err != nil {
 		return consensus.Hash256{}, err
@@ -142,7 +163,8 @@ func (s *Session) UploadSector(sector *[rhpv2.SectorSize]byte) (consensus.Hash25
 }
 
 // DownloadSector implements Host.
-func (s *Session) DownloadSector(w io.Writer, root consensus.Hash256, offset, length uint32) error {
+func (s *Session) DownloadSector(w io.Writer, root consensus.Hash256, offset, length uint32) (err error) {
+	defer func(start time.Time) { recordRPC(s.hostKey, "read", start, err) }(time.Now())
 	ss, err := s.pool.acquire(s)
 	if err != nil {
 		return err
@@ -152,7 +174,8 @@ func (s *Session) DownloadSector(w io.Writer, root consensus.Hash256, offset, le
 }
 
 // DeleteSectors implements Host.
-func (s *Session) DeleteSectors(roots []consensus.Hash256) error {
+func (s *Session) DeleteSectors(roots []consensus.Hash256) (err error) {
+	defer func(start time.Time) { recordRPC(s.hostKey, "delete", start, err) }(time.Now())
 	ss, err := s.pool.acquire(s)
 	if err != nil {
 		return err
@@ -2,11 +2,16 @@ package slab
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"go.sia.tech/renterd/internal/consensus"
 	rhpv2 "go.sia.tech/renterd/rhp/v2"
+	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/chacha20"
 	"lukechampine.com/frand"
 )
@@ -14,10 +19,21 @@ import (
 // A EncryptionKey can encrypt and decrypt messages.
 type EncryptionKey struct {
 	entropy *[32]byte
+	siad    *siadKey
+}
+
+// A siadKey holds the parameters that siad uses to derive a separate nonce for
+// each piece of a chunk.
+type siadKey struct {
+	nonce [24]byte
+	chunk uint64
 }
 
 // String returns a hex-encoded representation of the key.
 func (k EncryptionKey) String() (s string) {
+	if k.siad != nil {
+		return fmt.Sprintf("siad:%x%x:%d", k.entropy[:], k.siad.nonce[:], k.siad.chunk)
+	}
 	return "key:" + hex.EncodeToString(k.entropy[:])
 }
 
@@ -28,8 +44,26 @@ func (k EncryptionKey) MarshalJSON() ([]byte, error) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface.
 func (k *EncryptionKey) UnmarshalJSON(b []byte) error {
+	s := bytes.Trim(b, `"`)
+	if bytes.HasPrefix(s, []byte("siad:")) {
+		var key [56]byte
+		var chunk uint64
+		parts := strings.Split(string(s), ":")
+		if len(parts) != 3 {
+			return errors.New("wrong siad key format")
+		} else if n, err := hex.Decode(key[:], []byte(parts[1])); err != nil {
+			return err
+		} else if n != len(key) {
+			return errors.New("wrong siad key length")
+		} else if chunk, err = strconv.ParseUint(parts[2], 10, 64); err != nil {
+			return err
+		}
+		*k = SiadEncryptionKey(key, chunk)
+		return nil
+	}
 	k.entropy = new([32]byte)
-	if n, err := hex.Decode(k.entropy[:], bytes.TrimPrefix(bytes.Trim(b, `"`), []byte("key:"))); err != nil {
+	k.siad = nil
+	if n, err := hex.Decode(k.entropy[:], bytes.TrimPrefix(s, []byte("key:"))); err != nil {
 		return err
 	} else if n != len(k.entropy) {
 		return errors.New("wrong seed length")
@@ -37,6 +71,29 @@ func (k *EncryptionKey) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// shardNonce returns the nonce used to encrypt the i'th shard.
+func (k EncryptionKey) shardNonce(i int) (nonce [24]byte) {
+	if k.siad == nil {
+		return [24]byte{1: byte(i)}
+	}
+	buf := make([]byte, 24+8+8)
+	copy(buf, k.siad.nonce[:])
+	binary.LittleEndian.PutUint64(buf[24:], k.siad.chunk)
+	binary.LittleEndian.PutUint64(buf[32:], uint64(i))
+	h := blake2b.Sum256(buf)
+	copy(nonce[:], h[:])
+	return
+}
+
+// SiadEncryptionKey returns the key of a slab uploaded by siad, given the
+// XChaCha20 master key of its file and the index of its chunk within that file.
+func SiadEncryptionKey(masterKey [56]byte, chunkIndex uint64) EncryptionKey {
+	key := EncryptionKey{entropy: new([32]byte), siad: &siadKey{chunk: chunkIndex}}
+	copy(key.entropy[:], masterKey[:32])
+	copy(key.siad.nonce[:], masterKey[32:])
+	return key
+}
+
 // GenerateEncryptionKey returns a random encryption key.
 func GenerateEncryptionKey() EncryptionKey {
 	key := EncryptionKey{entropy: new([32]byte)}
@@ -67,7 +124,7 @@ func (s Slab) Length() int {
 // different nonce for each shard.
 func (s Slab) Encrypt(shards [][]byte) {
 	for i, shard := range shards {
-		nonce := [24]byte{1: byte(i)}
+		nonce := s.Key.shardNonce(i)
 		c, _ := chacha20.NewUnauthenticatedCipher(s.Key.entropy[:], nonce[:])
 		c.XORKeyStream(shard, shard)
 	}
@@ -100,7 +157,7 @@ func (s Slice) SectorRegion() (offset, length uint32) {
 func (s Slice) Decrypt(shards [][]byte) {
 	offset := s.Offset / (rhpv2.LeafSize * uint32(s.MinShards))
 	for i, shard := range shards {
-		nonce := [24]byte{1: byte(i)}
+		nonce := s.Key.shardNonce(i)
 		c, _ := chacha20.NewUnauthenticatedCipher(s.Key.entropy[:], nonce[:])
 		c.SetCounter(offset)
 		c.XORKeyStream(shard, shard)
@@ -0,0 +1,55 @@
+package slab_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"go.sia.tech/renterd/slab"
+	"go.sia.tech/siad/crypto"
+	"lukechampine.com/frand"
+)
+
+func TestSiadEncryptionKey(t *testing.T) {
+	masterKey := crypto.GenerateSiaKey(crypto.TypeXChaCha20)
+	var mk [56]byte
+	copy(mk[:], masterKey.Key())
+	const chunkIndex = 7
+	s := slab.Slab{Key: slab.SiadEncryptionKey(mk, chunkIndex), MinShards: 2}
+
+	// shards encrypted by siad should decrypt correctly, including from an
+	// offset within the sector
+	shards := make([][]byte, 3)
+	plaintext := make([][]byte, len(shards))
+	for i := range shards {
+		plaintext[i] = frand.Bytes(4096)
+		shards[i] = masterKey.Derive(chunkIndex, uint64(i)).EncryptBytes(plaintext[i])
+	}
+	s.Encrypt(shards)
+	for i := range shards {
+		if !bytes.Equal(shards[i], plaintext[i]) {
+			t.Fatalf("shard %v decrypted incorrectly", i)
+		}
+	}
+	s.Encrypt(shards)
+	ss := slab.Slice{Slab: s, Offset: 128 * 2, Length: 64}
+	region := make([][]byte, len(shards))
+	for i := range shards {
+		region[i] = append([]byte(nil), shards[i][128:]...)
+	}
+	ss.Decrypt(region)
+	for i := range region {
+		if !bytes.Equal(region[i], plaintext[i][128:]) {
+			t.Fatalf("shard %v decrypted incorrectly at offset", i)
+		}
+	}
+
+	// keys should round-trip through JSON
+	js, _ := json.Marshal(s.Key)
+	var key slab.EncryptionKey
+	if err := json.Unmarshal(js, &key); err != nil {
+		t.Fatal(err)
+	} else if key.String() != s.Key.String() {
+		t.Fatalf("key did not round-trip: %v != %v", key, s.Key)
+	}
+}
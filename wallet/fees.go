@@ -0,0 +1,138 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/siad/types"
+)
+
+// A FeePriority determines how a transaction's fee compares to the fee
+// recommended by the transaction pool.
+type FeePriority string
+
+// Fee priorities. The empty priority is equivalent to FeePriorityMedium.
+const (
+	// FeePriorityLow pays half the recommended fee, for transactions that are
+	// not urgent.
+	FeePriorityLow FeePriority = "low"
+	// FeePriorityMedium pays the recommended fee.
+	FeePriorityMedium FeePriority = "medium"
+	// FeePriorityHigh pays twice the recommended fee.
+	FeePriorityHigh FeePriority = "high"
+)
+
+// Validate returns an error if p is not a known priority.
+func (p FeePriority) Validate() error {
+	switch p {
+	case "", FeePriorityLow, FeePriorityMedium, FeePriorityHigh:
+		return nil
+	default:
+		return fmt.Errorf("unknown fee priority %q", p)
+	}
+}
+
+// A FeePolicy bounds the fee per byte paid by wallet transactions.
+type FeePolicy struct {
+	MinFeePerByte types.Currency `json:"minFeePerByte"`
+	// MaxFeePerByte is ignored if it is zero.
+	MaxFeePerByte types.Currency `json:"maxFeePerByte"`
+}
+
+// FeePerByte returns the fee per byte to pay for a transaction with the
+// specified priority, given the fee per byte recommended by the transaction
+// pool.
+func (fp FeePolicy) FeePerByte(recommended types.Currency, priority FeePriority) types.Currency {
+	fee := recommended
+	switch priority {
+	case FeePriorityLow:
+		fee = fee.Div64(2)
+	case FeePriorityHigh:
+		fee = fee.Mul64(2)
+	}
+	if fee.Cmp(fp.MinFeePerByte) < 0 {
+		fee = fp.MinFeePerByte
+	}
+	if !fp.MaxFeePerByte.IsZero() && fee.Cmp(fp.MaxFeePerByte) > 0 {
+		fee = fp.MaxFeePerByte
+	}
+	return fee
+}
+
+// FeePolicy returns the fee policy of the wallet.
+func (w *SeedWallet) FeePolicy() FeePolicy {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.fees
+}
+
+// SetFeePolicy sets the fee policy of the wallet.
+func (w *SeedWallet) SetFeePolicy(fp FeePolicy) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.fees = fp
+}
+
+// BumpTransaction returns a signed child transaction that spends the first
+// output of parent controlled by the wallet, paying a fee large enough that
+// parent and the child together pay feePerByte. The child sends the rest of the
+// output's value to a fresh address.
+func (w *SeedWallet) BumpTransaction(cs consensus.State, parent types.Transaction, feePerByte types.Currency) (types.Transaction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watchOnly {
+		return types.Transaction{}, ErrWatchOnly
+	}
+	var sco types.SiacoinOutput
+	var index uint64
+	var child types.Transaction
+	for i, out := range parent.SiacoinOutputs {
+		if addrIndex, ok := w.store.AddressIndex(out.UnlockHash); ok {
+			sco, index = out, addrIndex
+			child.SiacoinInputs = []types.SiacoinInput{{
+				ParentID:         parent.SiacoinOutputID(uint64(i)),
+				UnlockConditions: StandardUnlockConditions(w.publicKey(index)),
+			}}
+			break
+		}
+	}
+	if len(child.SiacoinInputs) == 0 {
+		return types.Transaction{}, errors.New("transaction has no output controlled by the wallet")
+	}
+
+	// estimate the size of the signed child, overestimating the size of its
+	// fee and output values; addresses have a fixed size, so the output's
+	// address isn't needed yet
+	est := child
+	est.SiacoinOutputs = []types.SiacoinOutput{{Value: sco.Value}}
+	est.MinerFees = []types.Currency{sco.Value}
+	sig := StandardTransactionSignature(types.OutputID(child.SiacoinInputs[0].ParentID))
+	sig.Signature = make([]byte, 64)
+	est.TransactionSignatures = []types.TransactionSignature{sig}
+	size := uint64(parent.MarshalSiaSize() + est.MarshalSiaSize())
+
+	var paid types.Currency
+	for _, fee := range parent.MinerFees {
+		paid = paid.Add(fee)
+	}
+	target := feePerByte.Mul64(size)
+	if paid.Cmp(target) >= 0 {
+		return types.Transaction{}, errors.New("transaction already pays the target fee")
+	}
+	fee := target.Sub(paid)
+	if sco.Value.Cmp(fee) <= 0 {
+		return types.Transaction{}, fmt.Errorf("output worth %v H cannot pay a fee of %v H", sco.Value, fee)
+	}
+	addr, err := w.issueAddress()
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	child.SiacoinOutputs = []types.SiacoinOutput{{Value: sco.Value.Sub(fee), UnlockHash: addr.Address}}
+	child.MinerFees = []types.Currency{fee}
+	toSign := []types.OutputID{types.OutputID(child.SiacoinInputs[0].ParentID)}
+	if err := w.SignTransaction(cs, &child, toSign, types.FullCoveredFields); err != nil {
+		return types.Transaction{}, err
+	}
+	return child, nil
+}
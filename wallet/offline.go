@@ -0,0 +1,73 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/types"
+)
+
+// ErrWatchOnly is returned when a watch-only wallet is asked to sign a
+// transaction.
+var ErrWatchOnly = errors.New("wallet is watch-only and cannot sign transactions")
+
+// A SigningBundle is a funded transaction along with everything required to
+// sign it offline.
+type SigningBundle struct {
+	Transaction   types.Transaction   `json:"transaction"`
+	ToSign        []types.OutputID    `json:"toSign"`
+	CoveredFields types.CoveredFields `json:"coveredFields"`
+	// State is the state that signatures are computed against.
+	State consensus.State `json:"state"`
+	// Parents are the unconfirmed transactions that Transaction depends on;
+	// they must be broadcast along with it.
+	Parents []types.Transaction `json:"parents"`
+}
+
+// Outputs returns the outputs of the bundle's transaction that do not send
+// change back to the address of key, along with the miner fee; signers should
+// review them before signing.
+func (b *SigningBundle) Outputs(key consensus.PublicKey) (outputs []types.SiacoinOutput, fee types.Currency) {
+	for _, sco := range b.Transaction.SiacoinOutputs {
+		if sco.UnlockHash != StandardAddress(key) {
+			outputs = append(outputs, sco)
+		}
+	}
+	for _, mf := range b.Transaction.MinerFees {
+		fee = fee.Add(mf)
+	}
+	return
+}
+
+// Sign adds a signature to each of the inputs in b.ToSign using key, which
+// must control the address that each input spends from.
+func (b *SigningBundle) Sign(key consensus.PrivateKey) error {
+	uc := StandardUnlockConditions(key.PublicKey())
+	txn := &b.Transaction
+	for _, id := range b.ToSign {
+		var found bool
+		for _, in := range txn.SiacoinInputs {
+			if types.OutputID(in.ParentID) == id {
+				if in.UnlockConditions.UnlockHash() != uc.UnlockHash() {
+					return fmt.Errorf("input %v is not controlled by key %v", id, key.PublicKey())
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("no input spends " + id.String())
+		}
+		i := len(txn.TransactionSignatures)
+		txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+			ParentID:       crypto.Hash(id),
+			CoveredFields:  b.CoveredFields,
+			PublicKeyIndex: 0,
+		})
+		sig := key.SignHash(b.State.InputSigHash(*txn, i))
+		txn.TransactionSignatures[i].Signature = sig[:]
+	}
+	return nil
+}
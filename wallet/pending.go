@@ -0,0 +1,78 @@
+package wallet
+
+import (
+	"time"
+
+	"go.sia.tech/siad/types"
+)
+
+// Statuses of a PendingTransaction.
+const (
+	PendingStatusPending   = "pending"
+	PendingStatusConfirmed = "confirmed"
+	PendingStatusFailed    = "failed"
+)
+
+// A PendingTransaction is a transaction set originating from the wallet that
+// is tracked until it is confirmed.
+type PendingTransaction struct {
+	// ID is the ID of the last transaction in the set, which depends on the
+	// others.
+	ID types.TransactionID `json:"id"`
+	// TransactionSet contains the transactions of the set that have not been
+	// confirmed yet.
+	TransactionSet []types.Transaction `json:"transactionSet"`
+	Status         string              `json:"status"`
+	// Height is the height at which the set was confirmed or failed.
+	Height uint64 `json:"height,omitempty"`
+	// Reason describes why the set failed.
+	Reason string    `json:"reason,omitempty"`
+	Added  time.Time `json:"added"`
+}
+
+// A Relayer adds transaction sets to the transaction pool and relays them to
+// peers.
+type Relayer interface {
+	Transactions() []types.Transaction
+	AddTransactionSet(txns []types.Transaction) error
+	BroadcastTransaction(txn types.Transaction, dependsOn []types.Transaction)
+}
+
+// TrackTransactionSet tracks txns until its last transaction is confirmed.
+func (w *SeedWallet) TrackTransactionSet(txns []types.Transaction) error {
+	return w.store.TrackTransactionSet(txns)
+}
+
+// PendingTransactions returns the transaction sets tracked by the wallet,
+// including those that recently confirmed or failed.
+func (w *SeedWallet) PendingTransactions() ([]PendingTransaction, error) {
+	return w.store.PendingTransactions()
+}
+
+// Rebroadcast relays each pending transaction set to peers. Sets that have
+// dropped out of the transaction pool are added to it again; if the pool
+// rejects a set, it is marked as failed.
+func (w *SeedWallet) Rebroadcast(r Relayer) error {
+	pts, err := w.store.PendingTransactions()
+	if err != nil {
+		return err
+	}
+	inPool := make(map[types.TransactionID]bool)
+	for _, txn := range r.Transactions() {
+		inPool[txn.ID()] = true
+	}
+	for _, pt := range pts {
+		if pt.Status != PendingStatusPending || len(pt.TransactionSet) == 0 {
+			continue
+		}
+		if inPool[pt.ID] {
+			last := len(pt.TransactionSet) - 1
+			r.BroadcastTransaction(pt.TransactionSet[last], pt.TransactionSet[:last])
+		} else if err := r.AddTransactionSet(pt.TransactionSet); err != nil {
+			if err := w.store.MarkPendingFailed(pt.ID, err.Error()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"strings"
 
+	mnemonics "gitlab.com/NebulousLabs/entropy-mnemonics"
 	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/types"
 	"golang.org/x/crypto/blake2b"
 )
 
@@ -30,22 +33,63 @@ func NewSeedPhrase() string {
 	return encodeBIP39Phrase(&entropy)
 }
 
+// A Seed is the secret from which all of a wallet's keys are derived. Keys are
+// derived in the same way as siad, so a seed produces the same sequence of
+// addresses in both.
+type Seed [32]byte
+
+// PrivateKey returns the Ed25519 key at the specified index.
+func (s *Seed) PrivateKey(index uint64) consensus.PrivateKey {
+	buf := make([]byte, 32+8)
+	copy(buf[:32], s[:])
+	binary.LittleEndian.PutUint64(buf[32:], index)
+	seed := blake2b.Sum256(buf)
+	memclr(buf)
+	key := consensus.NewPrivateKeyFromSeed(seed[:])
+	memclr(seed[:])
+	return key
+}
+
+// PublicKey returns the public key at the specified index.
+func (s *Seed) PublicKey(index uint64) consensus.PublicKey {
+	key := s.PrivateKey(index)
+	defer memclr(key)
+	return key.PublicKey()
+}
+
+// Address returns the standard address of the key at the specified index.
+func (s *Seed) Address(index uint64) types.UnlockHash {
+	return StandardAddress(s.PublicKey(index))
+}
+
+// SeedFromPhrase returns the seed encoded by the supplied phrase, which is
+// either a 12-word BIP39 phrase or a 28- or 29-word siad seed.
+func SeedFromPhrase(phrase string) (Seed, error) {
+	if n := len(strings.Fields(phrase)); n == 28 || n == 29 {
+		seed, err := modules.StringToSeed(phrase, mnemonics.English)
+		if err != nil {
+			return Seed{}, err
+		}
+		return Seed(seed), nil
+	}
+	entropy, err := decodeBIP39Phrase(phrase)
+	if err != nil {
+		return Seed{}, err
+	}
+	seed := Seed(blake2b.Sum256(entropy[:]))
+	memclr(entropy[:])
+	return seed, nil
+}
+
 // KeyFromPhrase returns the Ed25519 key derived from the supplied seed phrase.
+// It is the first key of the phrase's seed.
 func KeyFromPhrase(phrase string) (consensus.PrivateKey, error) {
-	entropy, err := decodeBIP39Phrase(phrase)
+	seed, err := SeedFromPhrase(phrase)
 	if err != nil {
 		return nil, err
 	}
-	h := blake2b.Sum256(entropy[:])
-	memclr(entropy[:])
-	buf := make([]byte, 32+8)
-	copy(buf[:32], h[:])
-	memclr(h[:])
-	binary.LittleEndian.PutUint64(buf[32:], 0)
-	seed := blake2b.Sum256(buf)
-	key := consensus.NewPrivateKeyFromSeed(seed[:])
-	memclr(seed[:])
-	return key, nil
+	defer memclr(seed[:])
+	return seed.PrivateKey(0), nil
 }
 
 func bip39checksum(entropy *[16]byte) uint64 {
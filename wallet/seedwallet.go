@@ -0,0 +1,388 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/types"
+)
+
+const (
+	// DefaultGapLimit is the number of consecutive unused addresses that a
+	// SeedWallet watches beyond the last address that was used.
+	DefaultGapLimit = 20
+
+	// DefaultDefragThreshold is the number of spendable outputs above which a
+	// wallet should be defragmented.
+	DefaultDefragThreshold = 100
+
+	// DefaultDefragBatchSize is the maximum number of outputs merged by a
+	// single defrag transaction, which keeps the transaction well below the
+	// maximum transaction size.
+	DefaultDefragBatchSize = 64
+)
+
+// An AddressInfo is an address derived from a wallet's seed.
+type AddressInfo struct {
+	Address types.UnlockHash `json:"address"`
+	Index   uint64           `json:"index"`
+}
+
+// A SeedStore stores the state of a seed-based wallet, watching every address
+// derived from the seed up to a gap limit beyond the last address that was
+// issued or received an output. Address 0 is always issued. Implementations are
+// assumed to be thread safe.
+type SeedStore interface {
+	SingleAddressStore
+	// AddressIndex returns the index of addr, if it is watched by the store.
+	AddressIndex(addr types.UnlockHash) (uint64, bool)
+	// Addresses returns the addresses that have been issued, in order.
+	Addresses() ([]AddressInfo, error)
+	// IssueAddress issues the next address.
+	IssueAddress() (AddressInfo, error)
+
+	// TrackTransactionSet tracks txns until its last transaction is
+	// confirmed. Tracked sets are marked as confirmed or failed (if one of
+	// their inputs is spent by another transaction) as blocks are applied.
+	TrackTransactionSet(txns []types.Transaction) error
+	// PendingTransactions returns the tracked transaction sets, oldest first.
+	PendingTransactions() ([]PendingTransaction, error)
+	// MarkPendingFailed marks a tracked transaction set as failed.
+	MarkPendingFailed(id types.TransactionID, reason string) error
+}
+
+// A SeedWallet is a hot wallet that manages the outputs controlled by the
+// addresses derived from a seed. Change is sent to a fresh address.
+//
+// A watch-only SeedWallet knows only the public key of a single address. It
+// can fund transactions, but they must be signed offline; see SigningBundle.
+type SeedWallet struct {
+	seed  Seed
+	store SeedStore
+
+	watchOnly bool
+	watchKey  consensus.PublicKey
+
+	// for building transactions
+	mu        sync.Mutex
+	selection CoinSelection
+	fees      FeePolicy
+}
+
+// SetCoinSelection sets the strategy used to choose the outputs that fund
+// transactions. The default is CoinSelectionRandom.
+func (w *SeedWallet) SetCoinSelection(strategy CoinSelection) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.selection = strategy
+}
+
+// WatchOnly reports whether the wallet is unable to sign transactions.
+func (w *SeedWallet) WatchOnly() bool {
+	return w.watchOnly
+}
+
+// publicKey returns the public key of the address at the specified index.
+func (w *SeedWallet) publicKey(index uint64) consensus.PublicKey {
+	if w.watchOnly {
+		return w.watchKey
+	}
+	return w.seed.PublicKey(index)
+}
+
+// issueAddress issues a fresh address; watch-only wallets always return their
+// only address.
+func (w *SeedWallet) issueAddress() (AddressInfo, error) {
+	if w.watchOnly {
+		return AddressInfo{Address: StandardAddress(w.watchKey), Index: 0}, nil
+	}
+	return w.store.IssueAddress()
+}
+
+// Address returns the primary address of the wallet, address 0. Unlike the
+// fresh addresses issued for change, it never changes, so it can be handed out
+// as a stable receive address; NextAddress generates a new one.
+func (w *SeedWallet) Address() types.UnlockHash {
+	return StandardAddress(w.publicKey(0))
+}
+
+// Addresses returns the addresses that the wallet has issued.
+func (w *SeedWallet) Addresses() ([]AddressInfo, error) {
+	return w.store.Addresses()
+}
+
+// NextAddress issues a new address. Watch-only wallets always return their
+// only address.
+func (w *SeedWallet) NextAddress() (AddressInfo, error) {
+	return w.issueAddress()
+}
+
+// OwnsAddress reports whether addr is controlled by the wallet.
+func (w *SeedWallet) OwnsAddress(addr types.UnlockHash) bool {
+	_, ok := w.store.AddressIndex(addr)
+	return ok
+}
+
+// Balance returns the balance of the wallet.
+func (w *SeedWallet) Balance() types.Currency {
+	return w.store.Balance()
+}
+
+// UnspentOutputs returns the set of unspent Siacoin outputs controlled by the
+// wallet.
+func (w *SeedWallet) UnspentOutputs() ([]SiacoinElement, error) {
+	return w.store.UnspentSiacoinElements()
+}
+
+// Transactions returns up to max transactions relevant to the wallet that have
+// a timestamp later than since.
+func (w *SeedWallet) Transactions(since time.Time, max int) ([]Transaction, error) {
+	return w.store.Transactions(since, max)
+}
+
+// Reservations returns the outputs that are currently reserved by funded
+// transactions.
+func (w *SeedWallet) Reservations() ([]Reservation, error) {
+	return activeReservations(w.store)
+}
+
+// FundTransaction adds siacoin inputs worth at least the requested amount to
+// the provided transaction. A change output is also added, if necessary. The
+// inputs are reserved, and will not be available to future calls to
+// FundTransaction until they are released by ReleaseInputs, the transaction
+// is confirmed, or ReservationTimeout elapses.
+func (w *SeedWallet) FundTransaction(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction) ([]types.OutputID, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if amount.IsZero() {
+		return nil, nil
+	}
+
+	utxos, err := w.store.UnspentSiacoinElements()
+	if err != nil {
+		return nil, err
+	}
+	used, err := reservedOutputs(w.store)
+	if err != nil {
+		return nil, err
+	}
+	fundingElements, outputSum, err := selectInputs(cs, utxos, amount, used, pool, w.selection)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]types.SiacoinInput, len(fundingElements))
+	for i, sce := range fundingElements {
+		index, ok := w.store.AddressIndex(sce.UnlockHash)
+		if !ok {
+			return nil, fmt.Errorf("output %v does not belong to the wallet", sce.ID)
+		}
+		inputs[i] = types.SiacoinInput{
+			ParentID:         types.SiacoinOutputID(sce.ID),
+			UnlockConditions: StandardUnlockConditions(w.publicKey(index)),
+		}
+	}
+	if outputSum.Cmp(amount) > 0 {
+		change, err := w.issueAddress()
+		if err != nil {
+			return nil, err
+		}
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Value:      outputSum.Sub(amount),
+			UnlockHash: change.Address,
+		})
+	}
+
+	toSign := make([]types.OutputID, len(fundingElements))
+	for i, sce := range fundingElements {
+		toSign[i] = sce.ID
+	}
+	if err := w.store.ReserveOutputs(toSign, time.Now().Add(ReservationTimeout)); err != nil {
+		return nil, err
+	}
+	txn.SiacoinInputs = append(txn.SiacoinInputs, inputs...)
+	return toSign, nil
+}
+
+// Defrag consolidates the wallet's smallest spendable outputs if it has more
+// than threshold of them. Each returned transaction merges up to batchSize
+// outputs into a single output at a fresh address, paying feePerByte for each
+// byte of the transaction; outputs worth less than the fee required to spend
+// them are ignored. The transactions are signed, and their inputs are reserved
+// as if by FundTransaction.
+func (w *SeedWallet) Defrag(cs consensus.State, threshold, batchSize int, feePerByte types.Currency, pool []types.Transaction) ([]types.Transaction, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watchOnly {
+		return nil, ErrWatchOnly
+	} else if batchSize < 2 {
+		return nil, errors.New("batch size must be at least 2")
+	}
+	utxos, err := w.store.UnspentSiacoinElements()
+	if err != nil {
+		return nil, err
+	}
+	used, err := reservedOutputs(w.store)
+	if err != nil {
+		return nil, err
+	}
+	spendable := spendableOutputs(cs, utxos, used, pool)
+	n := len(spendable)
+	if n <= threshold {
+		return nil, nil
+	}
+
+	// ignore dust, then merge the smallest outputs first
+	input := types.Transaction{
+		SiacoinInputs:         []types.SiacoinInput{{UnlockConditions: StandardUnlockConditions(w.publicKey(0))}},
+		TransactionSignatures: []types.TransactionSignature{StandardTransactionSignature(types.OutputID{})},
+	}
+	input.TransactionSignatures[0].Signature = make([]byte, 64)
+	inputFee := feePerByte.Mul64(uint64(input.MarshalSiaSize() - (types.Transaction{}).MarshalSiaSize()))
+	candidates := spendable[:0]
+	for _, sce := range spendable {
+		if sce.Value.Cmp(inputFee) > 0 {
+			candidates = append(candidates, sce)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Value.Cmp(candidates[j].Value) < 0
+	})
+
+	var txns []types.Transaction
+	for n > threshold {
+		k := n - threshold + 1
+		if k > batchSize {
+			k = batchSize
+		}
+		if k > len(candidates) {
+			k = len(candidates)
+		}
+		if k < 2 {
+			break
+		}
+		txn, err := w.consolidate(cs, candidates[:k], feePerByte)
+		if err != nil {
+			for _, txn := range txns {
+				releaseInputs(w.store, txn)
+			}
+			return nil, err
+		}
+		txns = append(txns, txn)
+		candidates = candidates[k:]
+		n -= k - 1
+	}
+	return txns, nil
+}
+
+// consolidate returns a signed transaction merging elems into a single output
+// at a fresh address.
+func (w *SeedWallet) consolidate(cs consensus.State, elems []SiacoinElement, feePerByte types.Currency) (types.Transaction, error) {
+	addr, err := w.store.IssueAddress()
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	var total types.Currency
+	txn := types.Transaction{
+		SiacoinInputs: make([]types.SiacoinInput, len(elems)),
+	}
+	toSign := make([]types.OutputID, len(elems))
+	for i, sce := range elems {
+		index, ok := w.store.AddressIndex(sce.UnlockHash)
+		if !ok {
+			return types.Transaction{}, fmt.Errorf("output %v does not belong to the wallet", sce.ID)
+		}
+		txn.SiacoinInputs[i] = types.SiacoinInput{
+			ParentID:         types.SiacoinOutputID(sce.ID),
+			UnlockConditions: StandardUnlockConditions(w.publicKey(index)),
+		}
+		toSign[i] = sce.ID
+		total = total.Add(sce.Value)
+	}
+
+	// estimate the size of the signed transaction, overestimating the size
+	// of the fee and output values
+	est := txn
+	est.SiacoinOutputs = []types.SiacoinOutput{{Value: total, UnlockHash: addr.Address}}
+	est.MinerFees = []types.Currency{total}
+	for _, id := range toSign {
+		sig := StandardTransactionSignature(id)
+		sig.Signature = make([]byte, 64)
+		est.TransactionSignatures = append(est.TransactionSignatures, sig)
+	}
+	fee := feePerByte.Mul64(uint64(est.MarshalSiaSize()))
+	if total.Cmp(fee) <= 0 {
+		return types.Transaction{}, errors.New("outputs are not worth the fee required to merge them")
+	}
+	txn.SiacoinOutputs = []types.SiacoinOutput{{Value: total.Sub(fee), UnlockHash: addr.Address}}
+	txn.MinerFees = []types.Currency{fee}
+	if err := w.SignTransaction(cs, &txn, toSign, types.FullCoveredFields); err != nil {
+		return types.Transaction{}, err
+	} else if err := w.store.ReserveOutputs(toSign, time.Now().Add(ReservationTimeout)); err != nil {
+		return types.Transaction{}, err
+	}
+	return txn, nil
+}
+
+// ReleaseInputs is a helper function that releases the inputs of txn for use in
+// other transactions. It should only be called on transactions that are invalid
+// or will never be broadcast.
+func (w *SeedWallet) ReleaseInputs(txn types.Transaction) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	releaseInputs(w.store, txn)
+}
+
+// SignTransaction adds a signature to each of the specified inputs, using the
+// key of the address that each input spends from.
+func (w *SeedWallet) SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.OutputID, cf types.CoveredFields) error {
+	if w.watchOnly {
+		return ErrWatchOnly
+	}
+	for _, id := range toSign {
+		var index uint64
+		var found bool
+		for _, in := range txn.SiacoinInputs {
+			if types.OutputID(in.ParentID) == id {
+				index, found = w.store.AddressIndex(in.UnlockConditions.UnlockHash())
+				break
+			}
+		}
+		if !found {
+			return errors.New("no input controlled by the wallet spends " + id.String())
+		}
+		i := len(txn.TransactionSignatures)
+		txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+			ParentID:       crypto.Hash(id),
+			CoveredFields:  cf,
+			PublicKeyIndex: 0,
+		})
+		key := w.seed.PrivateKey(index)
+		sig := key.SignHash(cs.InputSigHash(*txn, i))
+		memclr(key)
+		txn.TransactionSignatures[i].Signature = sig[:]
+	}
+	return nil
+}
+
+// NewSeedWallet returns a new SeedWallet using the provided seed and store.
+func NewSeedWallet(seed Seed, store SeedStore) *SeedWallet {
+	return &SeedWallet{
+		seed:  seed,
+		store: store,
+	}
+}
+
+// NewWatchOnlyWallet returns a watch-only SeedWallet for the standard address
+// of pk. The store should watch only that address.
+func NewWatchOnlyWallet(pk consensus.PublicKey, store SeedStore) *SeedWallet {
+	return &SeedWallet{
+		store:     store,
+		watchOnly: true,
+		watchKey:  pk,
+	}
+}
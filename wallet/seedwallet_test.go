@@ -0,0 +1,352 @@
+package wallet_test
+
+import (
+	"errors"
+	"testing"
+
+	"gitlab.com/NebulousLabs/encoding"
+	mnemonics "gitlab.com/NebulousLabs/entropy-mnemonics"
+	"go.sia.tech/renterd/internal/consensus"
+	"go.sia.tech/renterd/internal/stores"
+	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/siad/crypto"
+	"go.sia.tech/siad/modules"
+	"go.sia.tech/siad/types"
+	"lukechampine.com/frand"
+)
+
+func TestSeedDerivation(t *testing.T) {
+	// addresses should match those derived by siad
+	var siadSeed modules.Seed
+	frand.Read(siadSeed[:])
+	phrase, err := modules.SeedToString(siadSeed, mnemonics.English)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := wallet.SeedFromPhrase(phrase)
+	if err != nil {
+		t.Fatal(err)
+	} else if seed != wallet.Seed(siadSeed) {
+		t.Fatal("siad phrase decoded incorrectly")
+	}
+	for _, index := range []uint64{0, 1, 1000} {
+		_, pk := crypto.GenerateKeyPairDeterministic(crypto.HashAll(siadSeed, index))
+		uc := types.UnlockConditions{
+			PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(pk)},
+			SignaturesRequired: 1,
+		}
+		if seed.Address(index) != uc.UnlockHash() {
+			t.Fatalf("address %v does not match siad", index)
+		}
+	}
+
+	// the key of a BIP39 phrase should be the first key of its seed
+	phrase = wallet.NewSeedPhrase()
+	key, err := wallet.KeyFromPhrase(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err = wallet.SeedFromPhrase(phrase)
+	if err != nil {
+		t.Fatal(err)
+	} else if seed.PublicKey(0) != key.PublicKey() {
+		t.Fatal("phrase key should be the seed's first key")
+	}
+}
+
+func TestSeedWallet(t *testing.T) {
+	seed := wallet.Seed(frand.Entropy256())
+	store := stores.NewEphemeralSeedStore(seed.Address, wallet.DefaultGapLimit)
+	w := wallet.NewSeedWallet(seed, store)
+
+	// pay addresses in separate blocks; each payment should extend the window
+	// of watched addresses
+	pay := func(index uint64) {
+		cc := modules.ConsensusChange{AppliedBlocks: []types.Block{{}}}
+		cc.SiacoinOutputDiffs = []modules.SiacoinOutputDiff{{
+			Direction: modules.DiffApply,
+			ID:        frand.Entropy256(),
+			SiacoinOutput: types.SiacoinOutput{
+				Value:      types.SiacoinPrecision,
+				UnlockHash: seed.Address(index),
+			},
+		}}
+		store.ProcessConsensusChange(cc)
+	}
+	for _, index := range []uint64{0, 15, 30, 30 + wallet.DefaultGapLimit + 1} {
+		pay(index)
+	}
+	utxos, err := w.UnspentOutputs()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(utxos) != 3 {
+		t.Fatalf("expected 3 outputs within the gap limit, got %v", len(utxos))
+	}
+
+	// issued addresses should be sequential
+	if addr, err := w.NextAddress(); err != nil {
+		t.Fatal(err)
+	} else if addr.Index != 1 || addr.Address != seed.Address(1) {
+		t.Fatal("wrong next address:", addr)
+	} else if w.Address() != seed.Address(0) {
+		t.Fatal("issuing an address should not change the primary address")
+	}
+
+	// fund and sign a transaction spending from every address
+	amount := types.SiacoinPrecision.Mul64(5).Div64(2)
+	txn := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: amount}},
+	}
+	var cs consensus.State
+	toSign, err := w.FundTransaction(cs, &txn, amount, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(txn.SiacoinInputs) != 3 || len(txn.SiacoinOutputs) != 2 {
+		t.Fatal("transaction should spend every output and add change")
+	} else if change := txn.SiacoinOutputs[1].UnlockHash; change != seed.Address(2) {
+		t.Fatal("change should be sent to a fresh address")
+	} else if w.Address() != seed.Address(0) {
+		t.Fatal("funding a transaction should not change the primary address")
+	}
+	if _, err := w.FundTransaction(cs, &types.Transaction{}, types.SiacoinPrecision, nil); err == nil {
+		t.Fatal("outputs should be in use")
+	}
+	if err := w.SignTransaction(cs, &txn, toSign, wallet.ExplicitCoveredFields(txn)); err != nil {
+		t.Fatal(err)
+	}
+	for i, sig := range txn.TransactionSignatures {
+		var pk consensus.PublicKey
+		for _, in := range txn.SiacoinInputs {
+			if crypto.Hash(in.ParentID) == sig.ParentID {
+				copy(pk[:], in.UnlockConditions.PublicKeys[0].Key)
+			}
+		}
+		var s consensus.Signature
+		copy(s[:], sig.Signature)
+		if !pk.VerifyHash(cs.InputSigHash(txn, i), s) {
+			t.Fatalf("signature %v is invalid", i)
+		}
+	}
+
+	w.ReleaseInputs(txn)
+	if _, err := w.FundTransaction(cs, &types.Transaction{}, types.SiacoinPrecision, nil); err != nil {
+		t.Fatal("released outputs should be usable:", err)
+	}
+}
+
+func TestSeedWalletDefrag(t *testing.T) {
+	seed := wallet.Seed(frand.Entropy256())
+	store := stores.NewEphemeralSeedStore(seed.Address, wallet.DefaultGapLimit)
+	w := wallet.NewSeedWallet(seed, store)
+
+	// receive outputs worth 1 through 10 SC, plus some dust
+	cc := modules.ConsensusChange{AppliedBlocks: []types.Block{{}}}
+	for i := 1; i <= 10; i++ {
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+			Direction: modules.DiffApply,
+			ID:        frand.Entropy256(),
+			SiacoinOutput: types.SiacoinOutput{
+				Value:      types.SiacoinPrecision.Mul64(uint64(i)),
+				UnlockHash: seed.Address(0),
+			},
+		})
+	}
+	cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, modules.SiacoinOutputDiff{
+		Direction:     modules.DiffApply,
+		ID:            frand.Entropy256(),
+		SiacoinOutput: types.SiacoinOutput{Value: types.NewCurrency64(1), UnlockHash: seed.Address(0)},
+	})
+	store.ProcessConsensusChange(cc)
+
+	// largest-first selection should spend only the 10 SC output
+	var cs consensus.State
+	w.SetCoinSelection(wallet.CoinSelectionLargestFirst)
+	txn := types.Transaction{}
+	if _, err := w.FundTransaction(cs, &txn, types.SiacoinPrecision.Mul64(9), nil); err != nil {
+		t.Fatal(err)
+	} else if len(txn.SiacoinInputs) != 1 {
+		t.Fatalf("expected 1 input, got %v", len(txn.SiacoinInputs))
+	}
+	w.ReleaseInputs(txn)
+
+	// defragmenting down to 5 outputs should merge the 8 smallest outputs,
+	// ignoring the dust, in batches of at most 4
+	fee := types.NewCurrency64(10)
+	txns, err := w.Defrag(cs, 5, 4, fee, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(txns) != 2 {
+		t.Fatalf("expected 2 transactions, got %v", len(txns))
+	}
+	var merged int
+	for _, txn := range txns {
+		merged += len(txn.SiacoinInputs)
+		var in types.Currency
+		for _, sci := range txn.SiacoinInputs {
+			if sci.UnlockConditions.UnlockHash() != seed.Address(0) {
+				t.Fatal("input spends wrong address")
+			}
+		}
+		for i := range txn.SiacoinInputs {
+			in = in.Add(types.SiacoinPrecision.Mul64(uint64(merged - len(txn.SiacoinInputs) + i + 1)))
+		}
+		if len(txn.SiacoinOutputs) != 1 || !w.OwnsAddress(txn.SiacoinOutputs[0].UnlockHash) {
+			t.Fatal("defrag should send to a single wallet output")
+		} else if out := txn.SiacoinOutputs[0].Value.Add(txn.MinerFees[0]); !out.Equals(in) {
+			t.Fatalf("expected outputs and fees to sum to %v, got %v", in, out)
+		} else if exp := fee.Mul64(uint64(len(encoding.Marshal(txn)))); txn.MinerFees[0].Cmp(exp) < 0 {
+			t.Fatalf("fee %v is below %v", txn.MinerFees[0], exp)
+		} else if len(txn.TransactionSignatures) != len(txn.SiacoinInputs) {
+			t.Fatal("transaction should be signed")
+		}
+	}
+	if merged != 8 {
+		t.Fatalf("expected 8 outputs to be merged, got %v", merged)
+	}
+
+	// the merged outputs should be in use
+	if txns, err := w.Defrag(cs, 2, 4, fee, nil); err != nil {
+		t.Fatal(err)
+	} else if len(txns) != 1 || len(txns[0].SiacoinInputs) != 2 {
+		t.Fatal("only the remaining outputs should be merged")
+	}
+}
+
+type mockRelayer struct {
+	pool      []types.Transaction
+	reject    error
+	relayed   []types.TransactionID
+	addedSets int
+}
+
+func (r *mockRelayer) Transactions() []types.Transaction { return r.pool }
+
+func (r *mockRelayer) AddTransactionSet(txns []types.Transaction) error {
+	if r.reject != nil {
+		return r.reject
+	}
+	r.addedSets++
+	r.pool = append(r.pool, txns...)
+	return nil
+}
+
+func (r *mockRelayer) BroadcastTransaction(txn types.Transaction, dependsOn []types.Transaction) {
+	r.relayed = append(r.relayed, txn.ID())
+}
+
+func TestSeedWalletRebroadcast(t *testing.T) {
+	seed := wallet.Seed(frand.Entropy256())
+	w := wallet.NewSeedWallet(seed, stores.NewEphemeralSeedStore(seed.Address, wallet.DefaultGapLimit))
+	txn := types.Transaction{ArbitraryData: [][]byte{frand.Bytes(8)}}
+	if err := w.TrackTransactionSet([]types.Transaction{txn}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a set missing from the pool should be re-added, then relayed
+	r := new(mockRelayer)
+	if err := w.Rebroadcast(r); err != nil {
+		t.Fatal(err)
+	} else if r.addedSets != 1 || len(r.relayed) != 0 {
+		t.Fatal("set should have been added to the pool")
+	}
+	if err := w.Rebroadcast(r); err != nil {
+		t.Fatal(err)
+	} else if r.addedSets != 1 || len(r.relayed) != 1 || r.relayed[0] != txn.ID() {
+		t.Fatal("set should have been relayed")
+	}
+
+	// a set rejected by the pool should fail
+	r = &mockRelayer{reject: errors.New("invalid set")}
+	if err := w.Rebroadcast(r); err != nil {
+		t.Fatal(err)
+	}
+	pts, err := w.PendingTransactions()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(pts) != 1 || pts[0].Status != wallet.PendingStatusFailed || pts[0].Reason != "invalid set" {
+		t.Fatal("rejected set should have failed:", pts)
+	}
+}
+
+func TestFeePolicy(t *testing.T) {
+	rec := types.NewCurrency64(100)
+	tests := []struct {
+		policy   wallet.FeePolicy
+		priority wallet.FeePriority
+		exp      uint64
+	}{
+		{wallet.FeePolicy{}, "", 100},
+		{wallet.FeePolicy{}, wallet.FeePriorityLow, 50},
+		{wallet.FeePolicy{}, wallet.FeePriorityHigh, 200},
+		{wallet.FeePolicy{MinFeePerByte: types.NewCurrency64(80)}, wallet.FeePriorityLow, 80},
+		{wallet.FeePolicy{MaxFeePerByte: types.NewCurrency64(150)}, wallet.FeePriorityHigh, 150},
+		{wallet.FeePolicy{MaxFeePerByte: types.NewCurrency64(150)}, wallet.FeePriorityMedium, 100},
+	}
+	for _, test := range tests {
+		if fee := test.policy.FeePerByte(rec, test.priority); !fee.Equals64(test.exp) {
+			t.Errorf("%+v %q: expected %v, got %v", test.policy, test.priority, test.exp, fee)
+		}
+	}
+	if err := wallet.FeePriority("urgent").Validate(); err == nil {
+		t.Error("expected unknown priority to be invalid")
+	}
+}
+
+func TestSeedWalletBump(t *testing.T) {
+	seed := wallet.Seed(frand.Entropy256())
+	w := wallet.NewSeedWallet(seed, stores.NewEphemeralSeedStore(seed.Address, wallet.DefaultGapLimit))
+
+	// a parent paying a small fee, with change sent back to the wallet
+	parent := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: frand.Entropy256()}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision, UnlockHash: types.UnlockHash(frand.Entropy256())},
+			{Value: types.SiacoinPrecision, UnlockHash: seed.Address(0)},
+		},
+		MinerFees: []types.Currency{types.NewCurrency64(1)},
+	}
+	var cs consensus.State
+	feePerByte := types.NewCurrency64(1000)
+	child, err := w.BumpTransaction(cs, parent, feePerByte)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(child.SiacoinInputs) != 1 || child.SiacoinInputs[0].ParentID != parent.SiacoinOutputID(1) {
+		t.Fatal("child should spend the parent's change output")
+	} else if len(child.TransactionSignatures) != 1 {
+		t.Fatal("child should be signed")
+	} else if len(child.SiacoinOutputs) != 1 || !w.OwnsAddress(child.SiacoinOutputs[0].UnlockHash) {
+		t.Fatal("child should send the rest of the output to the wallet")
+	} else if !child.SiacoinOutputs[0].Value.Add(child.MinerFees[0]).Equals(types.SiacoinPrecision) {
+		t.Fatal("child outputs and fee should sum to the change output")
+	}
+	size := uint64(len(encoding.Marshal(parent)) + len(encoding.Marshal(child)))
+	if paid := parent.MinerFees[0].Add(child.MinerFees[0]); paid.Cmp(feePerByte.Mul64(size)) < 0 {
+		t.Fatalf("parent and child pay %v, below %v", paid, feePerByte.Mul64(size))
+	}
+
+	// a parent that already pays enough, has an output too small to pay the
+	// fee, or has no wallet output, can't be bumped; failed bumps should not
+	// issue addresses
+	issued, err := w.Addresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.MinerFees[0] = types.SiacoinPrecision
+	if _, err := w.BumpTransaction(cs, parent, feePerByte); err == nil {
+		t.Fatal("expected bump of well-paying transaction to fail")
+	}
+	parent.MinerFees[0] = types.NewCurrency64(1)
+	parent.SiacoinOutputs[1].Value = types.NewCurrency64(1)
+	if _, err := w.BumpTransaction(cs, parent, feePerByte); err == nil {
+		t.Fatal("expected bump of tiny output to fail")
+	}
+	parent.SiacoinOutputs = parent.SiacoinOutputs[:1]
+	if _, err := w.BumpTransaction(cs, parent, feePerByte); err == nil {
+		t.Fatal("expected bump without a wallet output to fail")
+	}
+	if addrs, err := w.Addresses(); err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != len(issued) {
+		t.Fatalf("failed bumps issued %v addresses", len(addrs)-len(issued))
+	}
+}
@@ -2,7 +2,9 @@ package wallet
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
@@ -39,6 +41,18 @@ func StandardTransactionSignature(id types.OutputID) types.TransactionSignature
 	}
 }
 
+// SignedSize returns the encoded size of txn once each of the inputs in toSign
+// has been given a standard signature.
+func SignedSize(txn types.Transaction, toSign []types.OutputID) int {
+	txn.TransactionSignatures = append([]types.TransactionSignature(nil), txn.TransactionSignatures...)
+	for _, id := range toSign {
+		sig := StandardTransactionSignature(id)
+		sig.Signature = make([]byte, 64)
+		txn.TransactionSignatures = append(txn.TransactionSignatures, sig)
+	}
+	return txn.MarshalSiaSize()
+}
+
 // ExplicitCoveredFields returns a CoveredFields that covers all elements
 // present in txn.
 func ExplicitCoveredFields(txn types.Transaction) (cf types.CoveredFields) {
@@ -82,23 +96,180 @@ type SiacoinElement struct {
 	MaturityHeight uint64
 }
 
+// Types of wallet transactions.
+const (
+	TransactionTypeReceive           = "receive"
+	TransactionTypeSend              = "send"
+	TransactionTypeContractFormation = "contractFormation"
+	TransactionTypeContractRenewal   = "contractRenewal"
+	TransactionTypeContractRevision  = "contractRevision"
+	TransactionTypeMinerPayout       = "minerPayout"
+)
+
 // A Transaction is an on-chain transaction relevant to a particular wallet,
-// paired with useful metadata.
+// paired with useful metadata. Inflow is the value of the outputs controlled by
+// the wallet, and Outflow is the value of the inputs it spent, including Fee.
+// Miner payouts are represented by a Transaction whose ID is the ID of the
+// payout output and whose Raw transaction is empty.
 type Transaction struct {
 	Raw       types.Transaction
 	Index     consensus.ChainIndex
 	ID        types.TransactionID
 	Inflow    types.Currency
 	Outflow   types.Currency
+	Fee       types.Currency
+	Type      string
 	Timestamp time.Time
 }
 
+// A CoinSelection is a strategy for choosing the outputs that fund a
+// transaction.
+type CoinSelection int
+
+const (
+	// CoinSelectionRandom chooses outputs randomly.
+	CoinSelectionRandom CoinSelection = iota
+	// CoinSelectionLargestFirst chooses the largest outputs first, minimizing
+	// the number of inputs.
+	CoinSelectionLargestFirst
+)
+
+// String implements fmt.Stringer.
+func (c CoinSelection) String() string {
+	switch c {
+	case CoinSelectionRandom:
+		return "random"
+	case CoinSelectionLargestFirst:
+		return "largest"
+	default:
+		return fmt.Sprintf("CoinSelection(%d)", int(c))
+	}
+}
+
+// ParseCoinSelection parses a CoinSelection from its string form.
+func ParseCoinSelection(s string) (CoinSelection, error) {
+	for _, c := range []CoinSelection{CoinSelectionRandom, CoinSelectionLargestFirst} {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown coin selection strategy %q", s)
+}
+
+// spendableOutputs returns the elements of utxos that are mature, not in use,
+// and not spent by a transaction in pool.
+func spendableOutputs(cs consensus.State, utxos []SiacoinElement, used map[types.OutputID]bool, pool []types.Transaction) []SiacoinElement {
+	// avoid reusing any inputs currently in the transaction pool
+	inPool := make(map[types.OutputID]bool)
+	for _, ptxn := range pool {
+		for _, in := range ptxn.SiacoinInputs {
+			inPool[types.OutputID(in.ParentID)] = true
+		}
+	}
+	spendable := utxos[:0:0]
+	for _, sce := range utxos {
+		if !used[sce.ID] && !inPool[sce.ID] && cs.Index.Height >= sce.MaturityHeight {
+			spendable = append(spendable, sce)
+		}
+	}
+	return spendable
+}
+
+// selectInputs chooses spendable elements from utxos, using the specified
+// strategy, until their total value is at least amount. Elements that are in
+// use or spent by a transaction in pool are skipped.
+func selectInputs(cs consensus.State, utxos []SiacoinElement, amount types.Currency, used map[types.OutputID]bool, pool []types.Transaction, strategy CoinSelection) ([]SiacoinElement, types.Currency, error) {
+	utxos = spendableOutputs(cs, utxos, used, pool)
+	switch strategy {
+	case CoinSelectionLargestFirst:
+		sort.Slice(utxos, func(i, j int) bool {
+			return utxos[i].Value.Cmp(utxos[j].Value) > 0
+		})
+	default:
+		frand.Shuffle(len(utxos), reflect.Swapper(utxos))
+	}
+
+	var outputSum types.Currency
+	var fundingElements []SiacoinElement
+	for _, sce := range utxos {
+		fundingElements = append(fundingElements, sce)
+		outputSum = outputSum.Add(sce.Value)
+		if outputSum.Cmp(amount) >= 0 {
+			break
+		}
+	}
+	if outputSum.Cmp(amount) < 0 {
+		return nil, types.Currency{}, errors.New("insufficient balance")
+	}
+	return fundingElements, outputSum, nil
+}
+
+// ReservationTimeout is how long the inputs of a funded transaction remain
+// reserved if the transaction is never broadcast or released.
+const ReservationTimeout = time.Hour
+
+// A Reservation marks an output as in use by a transaction that has not been
+// confirmed yet.
+type Reservation struct {
+	ID         types.OutputID `json:"id"`
+	Expiration time.Time      `json:"expiration"`
+}
+
 // A SingleAddressStore stores the state of a single-address wallet.
 // Implementations are assumed to be thread safe.
 type SingleAddressStore interface {
 	Balance() types.Currency
 	UnspentSiacoinElements() ([]SiacoinElement, error)
 	Transactions(since time.Time, max int) ([]Transaction, error)
+
+	// Reservations returns the reserved outputs, including expired
+	// reservations that have not been pruned yet. Reservations are released
+	// automatically when their outputs are spent on-chain.
+	Reservations() ([]Reservation, error)
+	// ReserveOutputs reserves the specified outputs until expiration.
+	ReserveOutputs(ids []types.OutputID, expiration time.Time) error
+	// ReleaseOutputs releases the specified outputs.
+	ReleaseOutputs(ids []types.OutputID) error
+}
+
+// activeReservations returns the reservations in store that have not expired.
+func activeReservations(store SingleAddressStore) ([]Reservation, error) {
+	rs, err := store.Reservations()
+	if err != nil {
+		return nil, err
+	}
+	active := rs[:0]
+	for _, r := range rs {
+		if time.Now().Before(r.Expiration) {
+			active = append(active, r)
+		}
+	}
+	return active, nil
+}
+
+// reservedOutputs returns the set of outputs in store with an active
+// reservation.
+func reservedOutputs(store SingleAddressStore) (map[types.OutputID]bool, error) {
+	rs, err := activeReservations(store)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[types.OutputID]bool, len(rs))
+	for _, r := range rs {
+		used[r.ID] = true
+	}
+	return used, nil
+}
+
+// releaseInputs releases the inputs of txn in store.
+func releaseInputs(store SingleAddressStore, txn types.Transaction) {
+	ids := make([]types.OutputID, len(txn.SiacoinInputs))
+	for i, in := range txn.SiacoinInputs {
+		ids[i] = types.OutputID(in.ParentID)
+	}
+	// if the release fails, the outputs are freed once the reservation
+	// expires
+	_ = store.ReleaseOutputs(ids)
 }
 
 // A TransactionPool contains transactions that have not yet been included in a
@@ -115,8 +286,7 @@ type SingleAddressWallet struct {
 	store SingleAddressStore
 
 	// for building transactions
-	mu   sync.Mutex
-	used map[types.OutputID]bool
+	mu sync.Mutex
 }
 
 // PrivateKey returns the private key of the wallet.
@@ -146,10 +316,17 @@ func (w *SingleAddressWallet) Transactions(since time.Time, max int) ([]Transact
 	return w.store.Transactions(since, max)
 }
 
+// Reservations returns the outputs that are currently reserved by funded
+// transactions.
+func (w *SingleAddressWallet) Reservations() ([]Reservation, error) {
+	return activeReservations(w.store)
+}
+
 // FundTransaction adds siacoin inputs worth at least the requested amount to
 // the provided transaction. A change output is also added, if necessary. The
-// inputs will not be available to future calls to FundTransaction unless
-// ReleaseInputs is called.
+// inputs are reserved, and will not be available to future calls to
+// FundTransaction until they are released by ReleaseInputs, the transaction
+// is confirmed, or ReservationTimeout elapses.
 func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction) ([]types.OutputID, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -157,35 +334,17 @@ func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Tra
 		return nil, nil
 	}
 
-	// avoid reusing any inputs currently in the transaction pool
-	inPool := make(map[types.OutputID]bool)
-	for _, ptxn := range pool {
-		for _, in := range ptxn.SiacoinInputs {
-			inPool[types.OutputID(in.ParentID)] = true
-		}
-	}
-
 	utxos, err := w.store.UnspentSiacoinElements()
 	if err != nil {
 		return nil, err
 	}
-	// choose outputs randomly
-	frand.Shuffle(len(utxos), reflect.Swapper(utxos))
-
-	var outputSum types.Currency
-	var fundingElements []SiacoinElement
-	for _, sce := range utxos {
-		if w.used[sce.ID] || inPool[sce.ID] || cs.Index.Height < sce.MaturityHeight {
-			continue
-		}
-		fundingElements = append(fundingElements, sce)
-		outputSum = outputSum.Add(sce.Value)
-		if outputSum.Cmp(amount) >= 0 {
-			break
-		}
+	used, err := reservedOutputs(w.store)
+	if err != nil {
+		return nil, err
 	}
-	if outputSum.Cmp(amount) < 0 {
-		return nil, errors.New("insufficient balance")
+	fundingElements, outputSum, err := selectInputs(cs, utxos, amount, used, pool, CoinSelectionRandom)
+	if err != nil {
+		return nil, err
 	} else if outputSum.Cmp(amount) > 0 {
 		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
 			Value:      outputSum.Sub(amount),
@@ -195,14 +354,17 @@ func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Tra
 
 	toSign := make([]types.OutputID, len(fundingElements))
 	for i, sce := range fundingElements {
+		toSign[i] = sce.ID
+	}
+	if err := w.store.ReserveOutputs(toSign, time.Now().Add(ReservationTimeout)); err != nil {
+		return nil, err
+	}
+	for _, sce := range fundingElements {
 		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
 			ParentID:         types.SiacoinOutputID(sce.ID),
 			UnlockConditions: StandardUnlockConditions(w.priv.PublicKey()),
 		})
-		toSign[i] = sce.ID
-		w.used[sce.ID] = true
 	}
-
 	return toSign, nil
 }
 
@@ -210,9 +372,9 @@ func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Tra
 // other transactions. It should only be called on transactions that are invalid
 // or will never be broadcast.
 func (w *SingleAddressWallet) ReleaseInputs(txn types.Transaction) {
-	for _, in := range txn.SiacoinInputs {
-		delete(w.used, types.OutputID(in.ParentID))
-	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	releaseInputs(w.store, txn)
 }
 
 // SignTransaction adds a signature to each of the specified inputs.
@@ -236,6 +398,5 @@ func NewSingleAddressWallet(priv consensus.PrivateKey, store SingleAddressStore)
 		priv:  priv,
 		addr:  StandardAddress(priv.PublicKey()),
 		store: store,
-		used:  make(map[types.OutputID]bool),
 	}
 }
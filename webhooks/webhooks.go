@@ -0,0 +1,410 @@
+// Package webhooks delivers node events to registered HTTP endpoints.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/events"
+	"lukechampine.com/frand"
+)
+
+// TypeTest is the type of the event delivered by Manager.Test.
+const TypeTest = "webhook.test"
+
+// Headers set on each delivery.
+const (
+	// HeaderSignature holds "sha256=" followed by the hex-encoded HMAC-SHA256
+	// of the request body, keyed with the webhook's secret.
+	HeaderSignature = "Renterd-Signature"
+	HeaderEvent     = "Renterd-Event"
+	HeaderWebhook   = "Renterd-Webhook"
+)
+
+// Delivery defaults.
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = 5 * time.Second
+)
+
+// A Webhook is an endpoint that receives node events.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events lists the event types delivered to the webhook. If it is empty,
+	// every event is delivered.
+	Events  []string  `json:"events,omitempty"`
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Wants returns true if events of the specified type are delivered to the
+// webhook.
+func (wh Webhook) Wants(typ string) bool {
+	if len(wh.Events) == 0 {
+		return true
+	}
+	for _, t := range wh.Events {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// A DeadLetter is an event that could not be delivered to a webhook.
+type DeadLetter struct {
+	ID        string       `json:"id"`
+	WebhookID string       `json:"webhookID"`
+	URL       string       `json:"url"`
+	Event     events.Event `json:"event"`
+	Attempts  int          `json:"attempts"`
+	Error     string       `json:"error"`
+	Failed    time.Time    `json:"failed"`
+}
+
+// A Store stores webhooks and dead letters.
+type Store interface {
+	Webhooks() ([]Webhook, error)
+	AddWebhook(wh Webhook) error
+	RemoveWebhook(id string) error
+	DeadLetters() ([]DeadLetter, error)
+	AddDeadLetter(dl DeadLetter) error
+	RemoveDeadLetter(id string) error
+}
+
+// Sign returns the value of the HeaderSignature header for a delivery of body
+// to a webhook with the specified secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if signature is the HeaderSignature of body, for a
+// webhook with the specified secret.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func newID() string {
+	return hex.EncodeToString(frand.Bytes(8))
+}
+
+// maxQueued is the number of events that can wait to be delivered to each
+// webhook. Events published while a webhook's queue is full are added to the
+// dead letters.
+const maxQueued = 1000
+
+// A Manager delivers the events published to a bus to the webhooks in a
+// store. Each webhook receives its events in order, one at a time. Failed
+// deliveries are retried with exponential backoff; events that still cannot be
+// delivered are added to the store's dead letters.
+type Manager struct {
+	store       Store
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+
+	// the queues of the workers delivering to each webhook, keyed by webhook
+	// ID; only accessed by run
+	queues map[string]chan events.Event
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Webhooks returns the registered webhooks, without their secrets.
+func (m *Manager) Webhooks() ([]Webhook, error) {
+	whs, err := m.store.Webhooks()
+	for i := range whs {
+		whs[i].Secret = ""
+	}
+	return whs, err
+}
+
+// Register registers a webhook that receives events of the specified types,
+// or all events if types is empty. If secret is empty, a random secret is
+// generated. The returned webhook includes its secret.
+func (m *Manager) Register(rawURL string, types []string, secret string) (Webhook, error) {
+	if u, err := url.Parse(rawURL); err != nil {
+		return Webhook{}, err
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("webhook URL %q is not an absolute HTTP URL", rawURL)
+	}
+	for _, typ := range types {
+		if !events.KnownType(typ) && typ != TypeTest {
+			return Webhook{}, fmt.Errorf("unknown event type %q", typ)
+		}
+	}
+	if secret == "" {
+		secret = hex.EncodeToString(frand.Bytes(32))
+	}
+	wh := Webhook{
+		ID:      newID(),
+		URL:     rawURL,
+		Events:  types,
+		Secret:  secret,
+		Created: time.Now(),
+	}
+	if err := m.store.AddWebhook(wh); err != nil {
+		return Webhook{}, err
+	}
+	return wh, nil
+}
+
+// Delete removes the webhook with the specified ID. Events that are already
+// queued for the webhook are still delivered.
+func (m *Manager) Delete(id string) error {
+	return m.store.RemoveWebhook(id)
+}
+
+func (m *Manager) webhook(id string) (Webhook, error) {
+	whs, err := m.store.Webhooks()
+	if err != nil {
+		return Webhook{}, err
+	}
+	for _, wh := range whs {
+		if wh.ID == id {
+			return wh, nil
+		}
+	}
+	return Webhook{}, errors.New("no webhook with that ID")
+}
+
+// Test delivers an event of type TypeTest to the webhook with the specified
+// ID, without retrying.
+func (m *Manager) Test(id string) error {
+	wh, err := m.webhook(id)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(struct {
+		ID string `json:"id"`
+	}{wh.ID})
+	return m.send(wh, events.Event{
+		Type:      TypeTest,
+		Timestamp: time.Now(),
+		Data:      data,
+	})
+}
+
+// DeadLetters returns the events that could not be delivered.
+func (m *Manager) DeadLetters() ([]DeadLetter, error) {
+	return m.store.DeadLetters()
+}
+
+// RetryDeadLetter attempts to deliver a dead letter once more, removing it if
+// the delivery succeeds.
+func (m *Manager) RetryDeadLetter(id string) error {
+	dls, err := m.store.DeadLetters()
+	if err != nil {
+		return err
+	}
+	for _, dl := range dls {
+		if dl.ID != id {
+			continue
+		}
+		wh, err := m.webhook(dl.WebhookID)
+		if err != nil {
+			return err
+		} else if err := m.send(wh, dl.Event); err != nil {
+			return err
+		}
+		return m.store.RemoveDeadLetter(id)
+	}
+	return errors.New("no dead letter with that ID")
+}
+
+// DiscardDeadLetter removes a dead letter without delivering it.
+func (m *Manager) DiscardDeadLetter(id string) error {
+	return m.store.RemoveDeadLetter(id)
+}
+
+// send makes a single delivery attempt.
+func (m *Manager) send(wh Webhook, e events.Event) error {
+	body, _ := json.Marshal(e)
+	req, err := http.NewRequestWithContext(m.ctx, "POST", wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, Sign(wh.Secret, body))
+	req.Header.Set(HeaderEvent, e.Type)
+	req.Header.Set(HeaderWebhook, wh.ID)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook responded with %v: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// deliver delivers e to wh, retrying with exponential backoff. If every
+// attempt fails, or the manager is closed first, e is added to the dead
+// letters.
+func (m *Manager) deliver(wh Webhook, e events.Event) {
+	var attempts int
+	var err error
+retry:
+	for {
+		attempts++
+		if err = m.send(wh, e); err == nil {
+			return
+		} else if attempts == m.maxAttempts {
+			break
+		}
+		select {
+		case <-time.After(m.backoff << (attempts - 1)):
+		case <-m.ctx.Done():
+			break retry
+		}
+	}
+	m.addDeadLetter(wh, e, attempts, err)
+}
+
+func (m *Manager) addDeadLetter(wh Webhook, e events.Event, attempts int, err error) {
+	dl := DeadLetter{
+		ID:        newID(),
+		WebhookID: wh.ID,
+		URL:       wh.URL,
+		Event:     e,
+		Attempts:  attempts,
+		Error:     err.Error(),
+		Failed:    time.Now(),
+	}
+	if err := m.store.AddDeadLetter(dl); err != nil {
+		log.Printf("WARN: could not record undelivered event %v for webhook %v: %v", e.ID, wh.ID, err)
+	}
+}
+
+// work delivers the events in queue to wh, in order, until queue is closed.
+// Once the manager is closed, the remaining events are added to the dead
+// letters.
+func (m *Manager) work(wh Webhook, queue <-chan events.Event) {
+	defer m.wg.Done()
+	for e := range queue {
+		if m.ctx.Err() != nil {
+			m.addDeadLetter(wh, e, 0, errors.New("webhook manager was closed"))
+			continue
+		}
+		m.deliver(wh, e)
+	}
+}
+
+// dispatch queues e for delivery to the webhooks that want it, starting a
+// worker for each webhook that does not have one, and stopping the workers of
+// webhooks that were deleted once their queues are empty.
+func (m *Manager) dispatch(e events.Event) {
+	whs, err := m.store.Webhooks()
+	if err != nil {
+		log.Printf("WARN: could not load webhooks to deliver event %v: %v", e.ID, err)
+		return
+	}
+	registered := make(map[string]bool)
+	for _, wh := range whs {
+		registered[wh.ID] = true
+		if !wh.Wants(e.Type) {
+			continue
+		}
+		queue, ok := m.queues[wh.ID]
+		if !ok {
+			queue = make(chan events.Event, maxQueued)
+			m.queues[wh.ID] = queue
+			m.wg.Add(1)
+			go m.work(wh, queue)
+		}
+		select {
+		case queue <- e:
+		default:
+			m.addDeadLetter(wh, e, 0, errors.New("too many events are waiting to be delivered"))
+		}
+	}
+	for id, queue := range m.queues {
+		if !registered[id] {
+			close(queue)
+			delete(m.queues, id)
+		}
+	}
+}
+
+// run dispatches the events published to eb until the manager is closed.
+func (m *Manager) run(eb *events.Bus) {
+	defer m.wg.Done()
+	sub := eb.Subscribe(0)
+	lastID := sub.LastID
+	for {
+		// a subscription is closed if it falls behind; resume it from the last
+		// dispatched event
+		for _, e := range sub.Missed {
+			if e.ID > lastID {
+				m.dispatch(e)
+				lastID = e.ID
+			}
+		}
+		for open := true; open; {
+			select {
+			case <-m.ctx.Done():
+				sub.Close()
+				for id, queue := range m.queues {
+					close(queue)
+					delete(m.queues, id)
+				}
+				return
+			case e, ok := <-sub.C:
+				if open = ok; ok {
+					m.dispatch(e)
+					lastID = e.ID
+				}
+			}
+		}
+		sub = eb.Subscribe(lastID)
+		if sub.Reset {
+			log.Printf("WARN: webhook deliveries fell behind; some events after %v were not delivered", lastID)
+		}
+	}
+}
+
+// Close stops delivering events, adding those that are being retried or are
+// waiting to be delivered to the dead letters.
+func (m *Manager) Close() error {
+	m.cancel()
+	m.wg.Wait()
+	return nil
+}
+
+// NewManager returns a manager that delivers the events published to eb to the
+// webhooks in store. Each delivery is attempted up to maxAttempts times, with
+// the delay between attempts doubling from backoff.
+func NewManager(store Store, eb *events.Bus, maxAttempts int, backoff time.Duration) *Manager {
+	m := &Manager{
+		store:       store,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		queues:      make(map[string]chan events.Event),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.wg.Add(1)
+	go m.run(eb)
+	return m
+}
@@ -0,0 +1,160 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/events"
+	"go.sia.tech/renterd/internal/stores"
+	"go.sia.tech/renterd/webhooks"
+)
+
+// receiver records the events delivered to it, failing deliveries while fail
+// is set, and failing the next failNext deliveries.
+type receiver struct {
+	mu       sync.Mutex
+	fail     bool
+	failNext int
+	attempts int
+	received []events.Event
+	ch       chan struct{}
+	t        *testing.T
+	secret   string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() { r.ch <- struct{}{} }()
+	r.attempts++
+	body, _ := ioutil.ReadAll(req.Body)
+	if !webhooks.Verify(r.secret, body, req.Header.Get(webhooks.HeaderSignature)) {
+		r.t.Error("invalid signature")
+	}
+	if r.fail || r.failNext > 0 {
+		r.failNext--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var e events.Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		r.t.Error(err)
+	} else if req.Header.Get(webhooks.HeaderEvent) != e.Type {
+		r.t.Error("event header does not match body")
+	}
+	r.received = append(r.received, e)
+}
+
+func (r *receiver) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-r.ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+	}
+}
+
+func TestManager(t *testing.T) {
+	r := &receiver{ch: make(chan struct{}, 100), t: t, secret: "foo"}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	eb := events.NewBus(events.DefaultBacklog)
+	store := stores.NewEphemeralWebhookStore()
+	m := webhooks.NewManager(store, eb, 3, time.Millisecond)
+	defer m.Close()
+
+	if _, err := m.Register("ftp://example.com", nil, ""); err == nil {
+		t.Fatal("expected non-HTTP URL to be rejected")
+	} else if _, err := m.Register(srv.URL, []string{"foo"}, ""); err == nil {
+		t.Fatal("expected unknown event type to be rejected")
+	}
+	wh, err := m.Register(srv.URL, []string{events.TypeObjectCreated, webhooks.TypeTest}, r.secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if whs, err := m.Webhooks(); err != nil {
+		t.Fatal(err)
+	} else if len(whs) != 1 || whs[0].ID != wh.ID || whs[0].Secret != "" {
+		t.Fatal("webhooks should be listed without their secrets:", whs)
+	}
+
+	// test deliveries are made immediately
+	if err := m.Test(wh.ID); err != nil {
+		t.Fatal(err)
+	}
+	r.wait(t)
+
+	// only events of the registered types are delivered
+	eb.Publish(events.TypeBlock, events.Block{})
+	eb.Publish(events.TypeObjectCreated, events.Object{Key: "/foo"})
+	r.wait(t)
+	r.mu.Lock()
+	if len(r.received) != 2 || r.received[0].Type != webhooks.TypeTest || r.received[1].Type != events.TypeObjectCreated {
+		t.Fatal("unexpected deliveries:", r.received)
+	}
+	r.fail = true
+	r.mu.Unlock()
+
+	// failed deliveries are retried, then become dead letters
+	eb.Publish(events.TypeObjectCreated, events.Object{Key: "/bar"})
+	for i := 0; i < 3; i++ {
+		r.wait(t)
+	}
+	var dls []webhooks.DeadLetter
+	for start := time.Now(); len(dls) == 0 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+		if dls, err = m.DeadLetters(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(dls) != 1 || dls[0].Attempts != 3 || dls[0].WebhookID != wh.ID || dls[0].Error == "" {
+		t.Fatal("expected a dead letter after 3 attempts:", dls)
+	}
+
+	// dead letters can be retried
+	r.mu.Lock()
+	r.fail = false
+	r.mu.Unlock()
+	if err := m.RetryDeadLetter(dls[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	r.wait(t)
+	if dls, err := m.DeadLetters(); err != nil {
+		t.Fatal(err)
+	} else if len(dls) != 0 {
+		t.Fatal("delivered dead letter should be removed")
+	}
+
+	// events are delivered in order, even if some are retried
+	r.mu.Lock()
+	r.failNext, r.received = 1, nil
+	r.mu.Unlock()
+	eb.Publish(events.TypeObjectCreated, events.Object{Key: "/a"})
+	eb.Publish(events.TypeObjectCreated, events.Object{Key: "/b"})
+	for i := 0; i < 3; i++ {
+		r.wait(t)
+	}
+	r.mu.Lock()
+	var keys []string
+	for _, e := range r.received {
+		var o events.Object
+		json.Unmarshal(e.Data, &o)
+		keys = append(keys, o.Key)
+	}
+	r.mu.Unlock()
+	if len(keys) != 2 || keys[0] != "/a" || keys[1] != "/b" {
+		t.Fatal("events delivered out of order:", keys)
+	}
+
+	if err := m.Delete(wh.ID); err != nil {
+		t.Fatal(err)
+	} else if err := m.Test(wh.ID); err == nil {
+		t.Fatal("expected test of deleted webhook to fail")
+	}
+}